@@ -0,0 +1,184 @@
+package caddydockerproxy
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// activeLoader is the docker loader started by this process, exposed through the admin API
+var activeLoader atomic.Pointer[DockerLoader]
+
+// AdminAPI exposes docker proxy state through caddy admin API
+type AdminAPI struct{}
+
+// CaddyModule returns the Caddy module information.
+func (AdminAPI) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.docker_proxy",
+		New: func() caddy.Module { return new(AdminAPI) },
+	}
+}
+
+// Routes returns the admin routes of docker proxy
+func (AdminAPI) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/docker-proxy/events",
+			Handler: loaderHandler(http.MethodGet, handleEvents),
+		},
+		{
+			Pattern: "/docker-proxy/inventory",
+			Handler: loaderHandler(http.MethodGet, handleInventory),
+		},
+		{
+			Pattern: "/docker-proxy/diff",
+			Handler: loaderHandler(http.MethodGet, handleDiff),
+		},
+		{
+			Pattern: "/docker-proxy/ready",
+			Handler: loaderHandler(http.MethodGet, handleReady),
+		},
+		{
+			Pattern: "/docker-proxy/reload",
+			Handler: loaderHandler(http.MethodPost, handleReload),
+		},
+		{
+			Pattern: "/docker-proxy/config",
+			Handler: loaderHandler(http.MethodGet, handleConfig),
+		},
+		{
+			Pattern: pushLoadPath,
+			Handler: methodHandler(http.MethodPost, handleLoad),
+		},
+	}
+}
+
+// methodHandler restricts an admin route to requests with method
+func methodHandler(method string, handle caddy.AdminHandlerFunc) caddy.AdminHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method != method {
+			return caddy.APIError{
+				HTTPStatus: http.StatusMethodNotAllowed,
+				Err:        fmt.Errorf("method not allowed"),
+			}
+		}
+		return handle(w, r)
+	}
+}
+
+// loaderHandler restricts an admin route to requests with method and passes the running
+// docker loader to handle, failing while there is none
+func loaderHandler(method string, handle func(w http.ResponseWriter, r *http.Request, loader *DockerLoader) error) caddy.AdminHandlerFunc {
+	return methodHandler(method, func(w http.ResponseWriter, r *http.Request) error {
+		loader := activeLoader.Load()
+		if loader == nil {
+			return caddy.APIError{
+				HTTPStatus: http.StatusServiceUnavailable,
+				Err:        fmt.Errorf("docker proxy controller is not running"),
+			}
+		}
+		return handle(w, r, loader)
+	})
+}
+
+func handleEvents(w http.ResponseWriter, r *http.Request, loader *DockerLoader) error {
+	return writeJSON(w, loader.eventsTracker.status())
+}
+
+func handleInventory(w http.ResponseWriter, r *http.Request, loader *DockerLoader) error {
+	return writeJSON(w, loader.generator.Inventory())
+}
+
+func handleDiff(w http.ResponseWriter, r *http.Request, loader *DockerLoader) error {
+	if !loader.options.ConfigDiffSummary {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        fmt.Errorf("config diff summary is not enabled"),
+		}
+	}
+	return writeJSON(w, loader.lastDiff.Load())
+}
+
+func handleReady(w http.ResponseWriter, r *http.Request, loader *DockerLoader) error {
+	if !loader.Ready() {
+		return caddy.APIError{
+			HTTPStatus: http.StatusServiceUnavailable,
+			Err:        fmt.Errorf("docker proxy controller is not ready"),
+		}
+	}
+	return writeJSON(w, map[string]bool{"ready": true})
+}
+
+// ReloadResult is the result of a reload triggered through the admin API
+type ReloadResult struct {
+	Version int64 `json:"version"`
+}
+
+func handleReload(w http.ResponseWriter, r *http.Request, loader *DockerLoader) error {
+	version, updated := loader.reload()
+	if !updated {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        fmt.Errorf("failed to generate config, keeping version %d", version),
+		}
+	}
+	return writeJSON(w, ReloadResult{Version: version})
+}
+
+func handleConfig(w http.ResponseWriter, r *http.Request, loader *DockerLoader) error {
+	status := loader.configStatus()
+	if status == nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusServiceUnavailable,
+			Err:        fmt.Errorf("no config generated yet"),
+		}
+	}
+	return writeJSON(w, status)
+}
+
+// handleLoad loads a JSON config like the caddy /load endpoint, also accepting gzip compressed
+// bodies, which caddy doesn't. Controllers send compressed configurations to it with CompressConfigPush
+func handleLoad(w http.ResponseWriter, r *http.Request) error {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return caddy.APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        fmt.Errorf("reading gzip body: %v", err),
+			}
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	}
+	config, err := io.ReadAll(body)
+	if err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("reading request body: %v", err),
+		}
+	}
+	if err := caddy.Load(config, false); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("loading config: %v", err),
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(value)
+}
+
+// Interface guards
+var (
+	_ caddy.AdminRouter = (*AdminAPI)(nil)
+)
@@ -0,0 +1,339 @@
+package caddydockerproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/generator"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveAdmin serves r with the docker proxy admin route matching its path
+func serveAdmin(w http.ResponseWriter, r *http.Request) error {
+	for _, route := range (AdminAPI{}).Routes() {
+		if route.Pattern == r.URL.Path {
+			return route.Handler.ServeHTTP(w, r)
+		}
+	}
+	return fmt.Errorf("no admin route for %s", r.URL.Path)
+}
+
+func TestAdminEvents(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.EventsChannel = make(chan events.Message, 30)
+	dockerClient.ErrorsChannel = make(chan error, 1)
+	loader := createTestLoader(t, dockerClient, nil)
+	loader.options.DockerSockets = []string{"unix:///var/run/docker.sock"}
+	activeLoader.Store(loader)
+	t.Cleanup(func() { activeLoader.Store(nil) })
+
+	done := make(chan struct{})
+	go func() {
+		loader.listenEvents(context.Background(), 0)
+		close(done)
+	}()
+
+	for i := 0; i < 25; i++ {
+		dockerClient.EventsChannel <- events.Message{
+			Type:   events.ContainerEventType,
+			Action: events.ActionStart,
+			Actor: events.Actor{
+				ID:         fmt.Sprintf("container-%d", i),
+				Attributes: map[string]string{"name": fmt.Sprintf("name-%d", i)},
+			},
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		events := loader.eventsTracker.status().RecentEvents
+		return len(events) > 0 && events[len(events)-1].Actor == "name-24"
+	}, time.Second, time.Millisecond)
+
+	status := getEventsStatus(t)
+	assert.True(t, status.Connected["unix:///var/run/docker.sock"])
+	assert.NotNil(t, status.LastEventTime)
+	assert.Len(t, status.RecentEvents, maxRecentEvents)
+	assert.Equal(t, "name-5", status.RecentEvents[0].Actor)
+	assert.Equal(t, "name-24", status.RecentEvents[maxRecentEvents-1].Actor)
+	assert.Equal(t, "container", status.RecentEvents[0].Type)
+	assert.Equal(t, "start", status.RecentEvents[0].Action)
+
+	dockerClient.ErrorsChannel <- errors.New("connection lost")
+	<-done
+
+	status = getEventsStatus(t)
+	assert.False(t, status.Connected["unix:///var/run/docker.sock"])
+}
+
+func TestAdminEvents_NotRunning(t *testing.T) {
+	activeLoader.Store(nil)
+
+	err := serveAdmin(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/docker-proxy/events", nil))
+
+	assert.Error(t, err)
+}
+
+func getEventsStatus(t *testing.T) EventsStatus {
+	recorder := httptest.NewRecorder()
+	err := serveAdmin(recorder, httptest.NewRequest(http.MethodGet, "/docker-proxy/events", nil))
+	assert.NoError(t, err)
+
+	status := EventsStatus{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	return status
+}
+
+func TestAdminInventory(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams 80}}",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.InventoryPath = filepath.Join(t.TempDir(), "inventory.json")
+	})
+	activeLoader.Store(loader)
+	t.Cleanup(func() { activeLoader.Store(nil) })
+
+	loader.update()
+
+	expectedInventory := []generator.InventoryRoute{
+		{
+			Source:    "container/container-172.17.0.2",
+			Hosts:     []string{"example.com"},
+			Upstreams: []string{"172.17.0.2:80"},
+			TLS:       "acme",
+		},
+	}
+
+	recorder := httptest.NewRecorder()
+	err := serveAdmin(recorder, httptest.NewRequest(http.MethodGet, "/docker-proxy/inventory", nil))
+	assert.NoError(t, err)
+	inventory := []generator.InventoryRoute{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &inventory))
+	assert.Equal(t, expectedInventory, inventory)
+
+	inventoryFile, err := os.ReadFile(loader.options.InventoryPath)
+	assert.NoError(t, err)
+	inventory = []generator.InventoryRoute{}
+	assert.NoError(t, json.Unmarshal(inventoryFile, &inventory))
+	assert.Equal(t, expectedInventory, inventory)
+}
+
+func TestAdminDiff(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "a.example.com",
+			"caddy.reverse_proxy": "{{upstreams 80}}",
+		}),
+		createContainer("172.17.0.3", map[string]string{
+			"caddy":               "b.example.com",
+			"caddy.reverse_proxy": "{{upstreams 80}}",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.ConfigDiffSummary = true
+	})
+	activeLoader.Store(loader)
+	t.Cleanup(func() { activeLoader.Store(nil) })
+
+	loader.update()
+
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.4", map[string]string{
+			"caddy":               "a.example.com",
+			"caddy.reverse_proxy": "{{upstreams 80}}",
+		}),
+		createContainer("172.17.0.5", map[string]string{
+			"caddy":               "c.example.com",
+			"caddy.reverse_proxy": "{{upstreams 80}}",
+		}),
+	}
+	loader.update()
+
+	recorder := httptest.NewRecorder()
+	err := serveAdmin(recorder, httptest.NewRequest(http.MethodGet, "/docker-proxy/diff", nil))
+	assert.NoError(t, err)
+	diff := generator.ConfigDiff{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &diff))
+	assert.Equal(t, int64(2), diff.Version)
+	assert.Equal(t, []string{"c.example.com"}, diff.AddedHosts)
+	assert.Equal(t, []string{"b.example.com"}, diff.RemovedHosts)
+	assert.Equal(t, []generator.UpstreamsChange{
+		{Host: "a.example.com", Added: []string{"172.17.0.4:80"}, Removed: []string{"172.17.0.2:80"}},
+	}, diff.ChangedUpstreams)
+}
+
+func TestAdminDiff_NotEnabled(t *testing.T) {
+	loader := createTestLoader(t, createDockerClientMock(), nil)
+	activeLoader.Store(loader)
+	t.Cleanup(func() { activeLoader.Store(nil) })
+
+	err := serveAdmin(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/docker-proxy/diff", nil))
+
+	assert.Error(t, err)
+}
+
+func TestAdminReady(t *testing.T) {
+	status := http.StatusInternalServerError
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer admin.Close()
+	host, port, err := net.SplitHostPort(admin.Listener.Addr().String())
+	assert.NoError(t, err)
+
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams 80}}",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.AdminPort, _ = strconv.Atoi(port)
+		options.PushRetryAttempts = 1
+	})
+	loader.serverResolver = &serverResolverMock{servers: []string{host}}
+	activeLoader.Store(loader)
+	t.Cleanup(func() { activeLoader.Store(nil) })
+
+	err = serveAdmin(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/docker-proxy/ready", nil))
+	assert.EqualError(t, err, "docker proxy controller is not ready")
+
+	loader.update()
+
+	assert.False(t, loader.Ready())
+
+	status = http.StatusOK
+	loader.update()
+
+	assert.True(t, loader.Ready())
+	recorder := httptest.NewRecorder()
+	err = serveAdmin(recorder, httptest.NewRequest(http.MethodGet, "/docker-proxy/ready", nil))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"ready": true}`, recorder.Body.String())
+}
+
+func TestReady_NoServers(t *testing.T) {
+	loader := createTestLoader(t, createDockerClientMock(), nil)
+	loader.serverResolver = &serverResolverMock{servers: []string{}}
+
+	assert.False(t, loader.Ready())
+
+	loader.update()
+
+	assert.True(t, loader.Ready())
+}
+
+func TestAdminReload(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams 80}}",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, nil)
+	loader.serverResolver = &serverResolverMock{servers: []string{}}
+	activeLoader.Store(loader)
+	t.Cleanup(func() { activeLoader.Store(nil) })
+
+	err := serveAdmin(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/docker-proxy/reload", nil))
+	assert.EqualError(t, err, "method not allowed")
+
+	// Manual reloads are serialized with timer driven updates
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			loader.update()
+		}()
+		go func() {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			assert.NoError(t, serveAdmin(recorder, httptest.NewRequest(http.MethodPost, "/docker-proxy/reload", nil)))
+			result := ReloadResult{}
+			assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+			assert.Equal(t, int64(1), result.Version)
+		}()
+	}
+	wg.Wait()
+
+	dockerClient.ContainersData[0].Labels["caddy"] = "example.org"
+	recorder := httptest.NewRecorder()
+	assert.NoError(t, serveAdmin(recorder, httptest.NewRequest(http.MethodPost, "/docker-proxy/reload", nil)))
+	assert.JSONEq(t, `{"version": 2}`, recorder.Body.String())
+}
+
+func TestAdminConfig(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, nil)
+	loader.serverResolver = &serverResolverMock{servers: []string{}}
+	activeLoader.Store(loader)
+	t.Cleanup(func() { activeLoader.Store(nil) })
+
+	err := serveAdmin(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/docker-proxy/config", nil))
+	assert.EqualError(t, err, "no config generated yet")
+
+	loader.update()
+	loader.serversVersions.Set("10.0.0.2", 1)
+	pushedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	loader.recordServerStatus("10.0.0.2", 1, nil, pushedAt)
+
+	recorder := httptest.NewRecorder()
+	err = serveAdmin(recorder, httptest.NewRequest(http.MethodGet, "/docker-proxy/config", nil))
+	assert.NoError(t, err)
+	status := ConfigStatus{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	assert.Equal(t, int64(1), status.Version)
+	assert.Equal(t, testCaddyfile, status.Caddyfile)
+	assert.JSONEq(t, string(loader.lastJSONConfig), string(status.Config))
+	assert.Equal(t, map[string]int64{"10.0.0.2": 1}, status.ServersVersions)
+	assert.Equal(t, map[string]ServerStatus{"10.0.0.2": {Version: 1, LastPush: &pushedAt}}, status.Servers)
+}
+
+func TestAdminLoad(t *testing.T) {
+	err := serveAdmin(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/docker-proxy/load", nil))
+	assert.EqualError(t, err, "method not allowed")
+
+	request := httptest.NewRequest(http.MethodPost, "/docker-proxy/load", strings.NewReader("not gzip"))
+	request.Header.Set("Content-Encoding", "gzip")
+	err = serveAdmin(httptest.NewRecorder(), request)
+	var apiErr caddy.APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.HTTPStatus)
+
+	body, _ := gzipBody([]byte("{invalid"))
+	request = httptest.NewRequest(http.MethodPost, "/docker-proxy/load", bytes.NewReader(body))
+	request.Header.Set("Content-Encoding", "gzip")
+	err = serveAdmin(httptest.NewRecorder(), request)
+	assert.ErrorContains(t, err, "loading config")
+}
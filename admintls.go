@@ -0,0 +1,206 @@
+package caddydockerproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+)
+
+// adminIdentityIssuer issues the certificates of admin endpoints served over https from the
+// local CA of the pki app, which the admin CA certificate is expected to be the root of
+var adminIdentityIssuer = json.RawMessage(`{"module":"internal"}`)
+
+// getAdminScheme returns the scheme of the admin endpoint of servers, defaulting to http
+func getAdminScheme(options *config.Options) string {
+	if options.AdminScheme == "" {
+		return config.AdminSchemeHTTP
+	}
+	return options.AdminScheme
+}
+
+// getAdminPort returns the port of the admin endpoint of servers, defaulting to 2019
+func getAdminPort(options *config.Options) string {
+	if options.AdminPort == 0 {
+		return "2019"
+	}
+	return strconv.Itoa(options.AdminPort)
+}
+
+// splitAdminAddress returns the host and admin port of a server. Servers are usually hosts using
+// the admin port, but servers discovered through SRV records are host:port addresses
+func splitAdminAddress(options *config.Options, server string) (string, string) {
+	if host, port, err := net.SplitHostPort(server); err == nil {
+		return host, port
+	}
+	return server, getAdminPort(options)
+}
+
+// getAdminLoadPath returns the path of the admin endpoint of servers loading configurations,
+// defaulting to /load
+func getAdminLoadPath(options *config.Options) string {
+	if options.AdminLoadPath == "" {
+		return "/load"
+	}
+	return options.AdminLoadPath
+}
+
+// getAdminLoadMethod returns the HTTP method configurations are sent to the load endpoint with,
+// defaulting to POST
+func getAdminLoadMethod(options *config.Options) string {
+	if options.AdminLoadMethod == "" {
+		return http.MethodPost
+	}
+	return options.AdminLoadMethod
+}
+
+// setAdminAuth authenticates a request to the admin endpoint of a server with AdminAuthToken as a
+// bearer token, or AdminAuthUser and AdminAuthPassword as basic auth credentials.
+// Requests are never logged with their headers, so credentials don't appear in logs
+func setAdminAuth(options *config.Options, req *http.Request) {
+	if options.AdminAuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+options.AdminAuthToken)
+	} else if options.AdminAuthUser != "" {
+		req.SetBasicAuth(options.AdminAuthUser, options.AdminAuthPassword)
+	}
+}
+
+// validateAdminPort checks that the admin port is a valid TCP port
+func validateAdminPort(options *config.Options) error {
+	if options.AdminPort < 0 || options.AdminPort > 65535 {
+		return fmt.Errorf("admin port %d out of range 1-65535", options.AdminPort)
+	}
+	return nil
+}
+
+// validateAdminLoad checks that the load path is absolute and the load method sends a body
+func validateAdminLoad(options *config.Options) error {
+	if path := getAdminLoadPath(options); !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("admin load path %q must start with /", path)
+	}
+	switch method := getAdminLoadMethod(options); method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return nil
+	default:
+		return fmt.Errorf("admin load method %q must be POST, PUT or PATCH", method)
+	}
+}
+
+// adminLoadOverrides returns the enabled options that send configurations elsewhere than a
+// custom load path or method
+func adminLoadOverrides(options *config.Options) []string {
+	if getAdminLoadPath(options) == "/load" && getAdminLoadMethod(options) == http.MethodPost {
+		return nil
+	}
+	var overrides []string
+	if options.HTTPOnlyReload {
+		overrides = append(overrides, "HTTPOnlyReload")
+	}
+	if options.ConditionalPush {
+		overrides = append(overrides, "ConditionalPush")
+	}
+	if options.CompressConfigPush {
+		overrides = append(overrides, "CompressConfigPush")
+	}
+	return overrides
+}
+
+// createAdminTLSConfig creates the TLS configuration used to push configurations to servers,
+// returning nil when the admin endpoint of servers is served over plain HTTP
+func createAdminTLSConfig(options *config.Options) (*tls.Config, error) {
+	if getAdminScheme(options) != config.AdminSchemeHTTPS {
+		return nil, nil
+	}
+	if options.AdminClientCert == "" || options.AdminClientKey == "" {
+		return nil, fmt.Errorf("admin scheme https requires an admin client certificate and key")
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(options.AdminClientCert, options.AdminClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("loading admin client certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if options.AdminCACert != "" {
+		caCert, err := os.ReadFile(options.AdminCACert)
+		if err != nil {
+			return nil, fmt.Errorf("loading admin CA certificate: %w", err)
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in admin CA certificate %s", options.AdminCACert)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	return tlsConfig, nil
+}
+
+// createAdminConfig creates the admin configuration of a server whose admin endpoint listens on
+// server, a host or a host:port address. Over https, the endpoint on host is a remote admin endpoint only accepting the admin client
+// certificate, and the plaintext endpoint keeps the default localhost address. Endpoints on
+// localhost stay plaintext, as they aren't reachable from other hosts
+func createAdminConfig(options *config.Options, server string) (*caddy.AdminConfig, error) {
+	if err := validateAdminPort(options); err != nil {
+		return nil, err
+	}
+	host, port := splitAdminAddress(options, server)
+	listen := "tcp/" + net.JoinHostPort(host, port)
+	if getAdminScheme(options) != config.AdminSchemeHTTPS || host == "localhost" {
+		return &caddy.AdminConfig{
+			Listen: listen,
+		}, nil
+	}
+
+	publicKeys, err := readCertificatesDER(options.AdminClientCert)
+	if err != nil {
+		return nil, err
+	}
+	return &caddy.AdminConfig{
+		Identity: &caddy.IdentityConfig{
+			Identifiers: []string{host},
+			IssuersRaw:  []json.RawMessage{adminIdentityIssuer},
+		},
+		Remote: &caddy.RemoteAdmin{
+			Listen: listen,
+			AccessControl: []*caddy.AdminAccess{
+				{PublicKeys: publicKeys},
+			},
+		},
+	}, nil
+}
+
+// readCertificatesDER reads the certificates of a PEM file as base64 encoded DER
+func readCertificatesDER(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading admin client certificate: %w", err)
+	}
+	certificates := []string{}
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			certificates = append(certificates, base64.StdEncoding.EncodeToString(block.Bytes))
+		}
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificate found in admin client certificate %s", path)
+	}
+	return certificates, nil
+}
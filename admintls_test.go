@@ -0,0 +1,234 @@
+package caddydockerproxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCreateAdminConfig_HTTP(t *testing.T) {
+	admin, err := createAdminConfig(&config.Options{}, "10.0.0.2")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &caddy.AdminConfig{Listen: "tcp/10.0.0.2:2019"}, admin)
+}
+
+func TestCreateAdminConfig_AdminPort(t *testing.T) {
+	admin, err := createAdminConfig(&config.Options{AdminPort: 2999}, "10.0.0.2")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &caddy.AdminConfig{Listen: "tcp/10.0.0.2:2999"}, admin)
+
+	_, err = createAdminConfig(&config.Options{AdminPort: 70000}, "10.0.0.2")
+
+	assert.EqualError(t, err, "admin port 70000 out of range 1-65535")
+}
+
+func TestCreateAdminConfig_HTTPS(t *testing.T) {
+	dir := t.TempDir()
+	_, clientCert := writeTestCertificates(t, dir)
+
+	admin, err := createAdminConfig(&config.Options{
+		AdminScheme:     config.AdminSchemeHTTPS,
+		AdminClientCert: filepath.Join(dir, "client.crt"),
+		AdminClientKey:  filepath.Join(dir, "client.key"),
+	}, "10.0.0.2")
+
+	assert.NoError(t, err)
+	assert.Empty(t, admin.Listen)
+	assert.Equal(t, []string{"10.0.0.2"}, admin.Identity.Identifiers)
+	assert.Equal(t, "tcp/10.0.0.2:2019", admin.Remote.Listen)
+	assert.Equal(t, []string{base64.StdEncoding.EncodeToString(clientCert.Raw)}, admin.Remote.AccessControl[0].PublicKeys)
+
+	admin, err = createAdminConfig(&config.Options{AdminScheme: config.AdminSchemeHTTPS}, "localhost")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &caddy.AdminConfig{Listen: "tcp/localhost:2019"}, admin)
+}
+
+func TestCreateAdminTLSConfig_Errors(t *testing.T) {
+	tlsConfig, err := createAdminTLSConfig(&config.Options{})
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	_, err = createAdminTLSConfig(&config.Options{AdminScheme: config.AdminSchemeHTTPS})
+	assert.EqualError(t, err, "admin scheme https requires an admin client certificate and key")
+
+	dir := t.TempDir()
+	writeTestCertificates(t, dir)
+	_, err = createAdminTLSConfig(&config.Options{
+		AdminScheme:     config.AdminSchemeHTTPS,
+		AdminCACert:     filepath.Join(dir, "client.key"),
+		AdminClientCert: filepath.Join(dir, "client.crt"),
+		AdminClientKey:  filepath.Join(dir, "client.key"),
+	})
+	assert.ErrorContains(t, err, "no certificate found in admin CA certificate")
+}
+
+func TestCreatePushClient_ClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca, _ := writeTestCertificates(t, dir)
+
+	var peerCertificates int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerCertificates = len(r.TLS.PeerCertificates)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+	writePEM(t, filepath.Join(dir, "server-ca.crt"), "CERTIFICATE", server.Certificate().Raw)
+
+	options := &config.Options{
+		AdminScheme:     config.AdminSchemeHTTPS,
+		AdminCACert:     filepath.Join(dir, "server-ca.crt"),
+		AdminClientCert: filepath.Join(dir, "client.crt"),
+		AdminClientKey:  filepath.Join(dir, "client.key"),
+	}
+	tlsConfig, err := createAdminTLSConfig(options)
+	assert.NoError(t, err)
+
+	resp, err := createPushClient(nil, tlsConfig, 0).Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 1, peerCertificates)
+
+	_, err = http.DefaultClient.Get(server.URL)
+	assert.Error(t, err)
+}
+
+// writeTestCertificates writes to dir a client certificate and key signed by a new CA,
+// returning the CA and client certificates
+func writeTestCertificates(t *testing.T, dir string) (*x509.Certificate, *x509.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	assert.NoError(t, err)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "controller"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, ca, &clientKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	clientCert, err := x509.ParseCertificate(clientDER)
+	assert.NoError(t, err)
+	clientKeyDER, err := x509.MarshalECPrivateKey(clientKey)
+	assert.NoError(t, err)
+
+	writePEM(t, filepath.Join(dir, "client.crt"), "CERTIFICATE", clientDER)
+	writePEM(t, filepath.Join(dir, "client.key"), "EC PRIVATE KEY", clientKeyDER)
+	return ca, clientCert
+}
+
+func writePEM(t *testing.T, path string, blockType string, der []byte) {
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	assert.NoError(t, err)
+}
+
+func TestSendConfig_AdminAuth(t *testing.T) {
+	var authorizations []string
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{})
+	loader.sendConfig(context.Background(), zap.NewNop(), "server", admin.URL, []byte(testConfigJSON))
+
+	loader.options.AdminAuthUser = "controller"
+	loader.options.AdminAuthPassword = "secret-password"
+	logs := captureLogs(func(log *zap.Logger) {
+		loader.sendConfig(context.Background(), log, "server", admin.URL, []byte(testConfigJSON))
+	})
+	assert.NotContains(t, logs, "secret-password")
+
+	loader.options.AdminAuthToken = "secret-token"
+	logs = captureLogs(func(log *zap.Logger) {
+		loader.sendConfig(context.Background(), log, "server", admin.URL, []byte(testConfigJSON))
+	})
+	assert.NotContains(t, logs, "secret-token")
+
+	assert.Equal(t, []string{
+		"",
+		"Basic Y29udHJvbGxlcjpzZWNyZXQtcGFzc3dvcmQ=",
+		"Bearer secret-token",
+	}, authorizations)
+}
+
+func TestSendConfig_AdminLoadEndpoint(t *testing.T) {
+	var requests []string
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{})
+	_, err := loader.sendConfig(context.Background(), zap.NewNop(), "server", admin.URL, []byte(testConfigJSON))
+	assert.NoError(t, err)
+
+	loader.options.AdminLoadPath = "/caddy/admin/load"
+	loader.options.AdminLoadMethod = http.MethodPut
+	_, err = loader.sendConfig(context.Background(), zap.NewNop(), "server", admin.URL, []byte(testConfigJSON))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"POST /load", "PUT /caddy/admin/load"}, requests)
+}
+
+func TestValidateAdminLoad(t *testing.T) {
+	assert.NoError(t, validateAdminLoad(&config.Options{}))
+	assert.NoError(t, validateAdminLoad(&config.Options{AdminLoadPath: "/admin/load", AdminLoadMethod: http.MethodPatch}))
+	assert.EqualError(t, validateAdminLoad(&config.Options{AdminLoadPath: "load"}), `admin load path "load" must start with /`)
+	assert.EqualError(t, validateAdminLoad(&config.Options{AdminLoadMethod: http.MethodGet}), `admin load method "GET" must be POST, PUT or PATCH`)
+}
+
+func TestAdminLoadOverrides(t *testing.T) {
+	assert.Empty(t, adminLoadOverrides(&config.Options{ConditionalPush: true}))
+	assert.Empty(t, adminLoadOverrides(&config.Options{AdminLoadPath: "/load", AdminLoadMethod: http.MethodPost, CompressConfigPush: true}))
+	assert.Empty(t, adminLoadOverrides(&config.Options{AdminLoadPath: "/caddy/load"}))
+	assert.Equal(t,
+		[]string{"HTTPOnlyReload", "ConditionalPush", "CompressConfigPush"},
+		adminLoadOverrides(&config.Options{AdminLoadMethod: http.MethodPut, HTTPOnlyReload: true, ConditionalPush: true, CompressConfigPush: true}))
+}
@@ -0,0 +1,55 @@
+package caddydockerproxy
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// serverBreaker is the circuit breaker state of a server. The circuit opens after
+// BreakerThreshold consecutive failed pushes, skipping the server until openUntil.
+// After that, the next push probes the server, closing the circuit when it succeeds
+// and opening it again for another cooldown when it fails
+type serverBreaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// breakerAllows checks whether a configuration can be sent to server, which it can unless its
+// circuit is open
+func (dockerLoader *DockerLoader) breakerAllows(server string, now time.Time) bool {
+	threshold := dockerLoader.options.BreakerThreshold
+	if threshold <= 0 {
+		return true
+	}
+	breaker := dockerLoader.serversBreakers.Get(server)
+	return breaker.failures < threshold || !now.Before(breaker.openUntil)
+}
+
+// recordPush updates the circuit breaker of server with the result of sending it a configuration
+func (dockerLoader *DockerLoader) recordPush(log *zap.Logger, server string, configured bool, now time.Time) {
+	threshold := dockerLoader.options.BreakerThreshold
+	if threshold <= 0 {
+		return
+	}
+
+	breaker := dockerLoader.serversBreakers.Get(server)
+	if configured {
+		if breaker.failures >= threshold {
+			log.Info("Circuit closed, server configured again", zap.String("server", server))
+		}
+		dockerLoader.serversBreakers.Delete(server)
+		return
+	}
+
+	breaker.failures++
+	if breaker.failures >= threshold {
+		breaker.openUntil = now.Add(dockerLoader.options.BreakerCooldown)
+		if breaker.failures == threshold {
+			log.Warn("Circuit opened, skipping server", zap.String("server", server), zap.Int("failures", breaker.failures), zap.Duration("cooldown", dockerLoader.options.BreakerCooldown))
+		} else {
+			log.Info("Probe failed, circuit stays open", zap.String("server", server), zap.Int("failures", breaker.failures))
+		}
+	}
+	dockerLoader.serversBreakers.Set(server, breaker)
+}
@@ -0,0 +1,84 @@
+package caddydockerproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	var requests atomic.Int32
+	var healthy atomic.Bool
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+
+	loader.updateServerAt("server", admin.URL)
+	loader.updateServerAt("server", admin.URL)
+	assert.Equal(t, int32(2), requests.Load())
+
+	// The circuit is open, the server is skipped
+	loader.updateServerAt("server", admin.URL)
+	assert.Equal(t, int32(2), requests.Load())
+	assert.False(t, loader.breakerAllows("server", time.Now()))
+
+	// After the cooldown, a successful probe closes the circuit
+	assert.True(t, loader.breakerAllows("server", time.Now().Add(2*time.Hour)))
+	breaker := loader.serversBreakers.Get("server")
+	breaker.openUntil = time.Now()
+	loader.serversBreakers.Set("server", breaker)
+	healthy.Store(true)
+
+	loader.updateServerAt("server", admin.URL)
+	assert.Equal(t, int32(3), requests.Load())
+	assert.Equal(t, int64(1), loader.serversVersions.Get("server"))
+	assert.Equal(t, serverBreaker{}, loader.serversBreakers.Get("server"))
+}
+
+func TestBreaker_FailedProbeReopens(t *testing.T) {
+	loader := CreateDockerLoader(&config.Options{
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Minute,
+	})
+	now := time.Now()
+
+	loader.recordPush(zap.NewNop(), "server", false, now)
+	assert.True(t, loader.breakerAllows("server", now))
+	loader.recordPush(zap.NewNop(), "server", false, now)
+	assert.False(t, loader.breakerAllows("server", now))
+
+	probeTime := now.Add(time.Minute)
+	assert.True(t, loader.breakerAllows("server", probeTime))
+	loader.recordPush(zap.NewNop(), "server", false, probeTime)
+	assert.False(t, loader.breakerAllows("server", probeTime.Add(30*time.Second)))
+	assert.True(t, loader.breakerAllows("server", probeTime.Add(time.Minute)))
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	loader := CreateDockerLoader(&config.Options{})
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		loader.recordPush(zap.NewNop(), "server", false, now)
+	}
+
+	assert.True(t, loader.breakerAllows("server", now))
+	assert.Equal(t, 0, loader.serversBreakers.Len())
+}
@@ -0,0 +1,45 @@
+package caddyfile
+
+import (
+	"bytes"
+	"os"
+	"strings"
+)
+
+var (
+	envOpen  = []byte("{$")
+	envClose = []byte("}")
+)
+
+// ExpandEnv replaces environment variable placeholders like {$NAME} or {$NAME:default} in a
+// Caddyfile, like caddy does when adapting a Caddyfile. Variables that aren't set are replaced
+// with their default, or an empty string. Values aren't expanded again
+func ExpandEnv(content []byte) []byte {
+	var result bytes.Buffer
+	for {
+		begin := bytes.Index(content, envOpen)
+		if begin < 0 {
+			break
+		}
+		end := bytes.Index(content[begin+len(envOpen):], envClose)
+		if end < 0 {
+			break
+		}
+		end += begin + len(envOpen)
+
+		result.Write(content[:begin])
+		if name := string(content[begin+len(envOpen) : end]); name == "" {
+			result.Write(content[begin : end+len(envClose)])
+		} else {
+			name, defaultValue, _ := strings.Cut(name, ":")
+			value, found := os.LookupEnv(name)
+			if !found {
+				value = defaultValue
+			}
+			result.WriteString(value)
+		}
+		content = content[end+len(envClose):]
+	}
+	result.Write(content)
+	return result.Bytes()
+}
@@ -0,0 +1,33 @@
+package caddyfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("SITE_DOMAIN", "example.com")
+	t.Setenv("SITE_EMPTY", "")
+	t.Setenv("SITE_NESTED", "{$SITE_DOMAIN}")
+
+	input := "{$SITE_DOMAIN} {\n" +
+		"\treverse_proxy {$SITE_UPSTREAM:backend:80}\n" +
+		"\theader X-Empty \"{$SITE_EMPTY:unused}\"\n" +
+		"\theader X-Nested {$SITE_NESTED}\n" +
+		"\theader X-Missing \"{$SITE_MISSING}\"\n" +
+		"\theader X-Placeholder {http.request.host} {$}\n" +
+		"}\n" +
+		"{$SITE_DOMAIN"
+
+	expected := "example.com {\n" +
+		"\treverse_proxy backend:80\n" +
+		"\theader X-Empty \"\"\n" +
+		"\theader X-Nested {$SITE_DOMAIN}\n" +
+		"\theader X-Missing \"\"\n" +
+		"\theader X-Placeholder {http.request.host} {$}\n" +
+		"}\n" +
+		"{$SITE_DOMAIN"
+
+	assert.Equal(t, expected, string(ExpandEnv([]byte(input))))
+}
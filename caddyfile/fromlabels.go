@@ -2,6 +2,7 @@ package caddyfile
 
 import (
 	"bytes"
+	"errors"
 	"math"
 	"regexp"
 	"strconv"
@@ -13,15 +14,25 @@ var labelParserRegex = regexp.MustCompile(`^(?:(.+)\.)?(?:(\d+)_)?([^.]+?)(?:_(\
 
 // FromLabels converts key value labels into a caddyfile
 func FromLabels(labels map[string]string, templateData interface{}, templateFuncs template.FuncMap) (*Container, error) {
+	return FromLabelsSkipping(labels, templateData, templateFuncs, nil)
+}
+
+// FromLabelsSkipping converts key value labels into a caddyfile like FromLabels, but leaves out
+// labels whose template fails to execute when skip returns true for the label and its error
+func FromLabelsSkipping(labels map[string]string, templateData interface{}, templateFuncs template.FuncMap, skip func(label string, err error) bool) (*Container, error) {
 	container := CreateContainer()
 
 	blocksByPath := map[string]*Block{}
 	for label, value := range labels {
-		block := getOrCreateBlock(container, label, blocksByPath)
 		argsText, err := processVariables(templateData, templateFuncs, value)
+		var execErr template.ExecError
+		if err != nil && skip != nil && errors.As(err, &execErr) && skip(label, err) {
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
+		block := getOrCreateBlock(container, label, blocksByPath)
 		args, err := parseArgs(argsText)
 		if err != nil {
 			return nil, err
@@ -67,7 +78,7 @@ func parsePath(path string) (string, int, string) {
 }
 
 func processVariables(data interface{}, funcs template.FuncMap, content string) (string, error) {
-	t, err := template.New("").Funcs(funcs).Parse(content)
+	t, err := template.New("").Option("missingkey=error").Funcs(funcs).Parse(content)
 	if err != nil {
 		return "", err
 	}
@@ -20,9 +20,11 @@ OuterLoop:
 	}
 }
 
+// mergeReverseProxyLike adds the upstreams of blockB to blockA, skipping upstreams blockA
+// already has, like the same service seen through more than one docker host
 func mergeReverseProxyLike(blockA *Block, blockB *Block) {
 	for index, key := range blockB.Keys[1:] {
-		if index > 0 || !isMatcher(key) {
+		if (index > 0 || !isMatcher(key)) && !hasKey(blockA.Keys[1:], key) {
 			blockA.AddKeys(key)
 		}
 	}
@@ -51,3 +53,12 @@ func blocksAreEqual(blockA *Block, blockB *Block) bool {
 	}
 	return true
 }
+
+func hasKey(keys []string, key string) bool {
+	for _, existing := range keys {
+		if existing == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package caddydockerproxy
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// diffContextLines is the number of unchanged lines shown around changes
+const diffContextLines = 3
+
+// maxDiffCells limits the memory used to diff the changed lines of two Caddyfiles. Beyond it,
+// changed lines are shown as all removed and then all added instead of interleaved
+const maxDiffCells = 4_000_000
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// logCaddyfileDiff logs the lines changed since the previous Caddyfile, generated as
+// previousVersion, as a unified diff with sensitive values redacted, when DebugCaddyfileLogging
+// is enabled
+func (dockerLoader *DockerLoader) logCaddyfileDiff(log *zap.Logger, previousCaddyfile []byte, previousVersion int64, caddyfile []byte) {
+	if !dockerLoader.options.DebugCaddyfileLogging || len(previousCaddyfile) == 0 {
+		return
+	}
+	redactDirectives := dockerLoader.options.RedactDirectives
+	diff := unifiedDiff(
+		string(redactCaddyfile(previousCaddyfile, redactDirectives)),
+		string(redactCaddyfile(caddyfile, redactDirectives)),
+		fmt.Sprintf("Caddyfile version %d", previousVersion),
+		fmt.Sprintf("Caddyfile version %d", dockerLoader.lastVersion),
+	)
+	log.Info("Caddyfile changes", zap.Int64("version", dockerLoader.lastVersion), zap.String("diff", diff))
+}
+
+// unifiedDiff returns a line based unified diff between two texts, empty when they are equal
+func unifiedDiff(from string, to string, fromName string, toName string) string {
+	lines := diffLines(splitLines(from), splitLines(to))
+
+	var buffer strings.Builder
+	fromLine, toLine := 1, 1
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			fromLine++
+			toLine++
+			start++
+			continue
+		}
+
+		// A hunk starts before the first change and ends after the last change
+		// followed by at most twice the context lines without changes
+		end := start
+		for next := start; next < len(lines) && next <= end+2*diffContextLines+1; next++ {
+			if lines[next].op != ' ' {
+				end = next
+			}
+		}
+		hunkStart := max(start-diffContextLines, 0)
+		hunkEnd := min(end+diffContextLines+1, len(lines))
+		context := start - hunkStart
+		fromLine -= context
+		toLine -= context
+
+		fromCount, toCount := 0, 0
+		for _, line := range lines[hunkStart:hunkEnd] {
+			if line.op != '+' {
+				fromCount++
+			}
+			if line.op != '-' {
+				toCount++
+			}
+		}
+
+		if buffer.Len() == 0 {
+			fmt.Fprintf(&buffer, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&buffer, "@@ -%s +%s @@\n", hunkRange(fromLine, fromCount), hunkRange(toLine, toCount))
+		for _, line := range lines[hunkStart:hunkEnd] {
+			buffer.WriteByte(line.op)
+			buffer.WriteString(line.text)
+			buffer.WriteByte('\n')
+		}
+
+		fromLine += fromCount
+		toLine += toCount
+		start = hunkEnd
+	}
+	return buffer.String()
+}
+
+// hunkRange formats the start and count of lines of a hunk. Hunks without lines in one of the
+// texts start at the line before them
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns the lines of from and to, marked as unchanged, removed or added, keeping
+// the longest common subsequence unchanged. Common leading and trailing lines are skipped
+// before computing it, as changes are usually a few lines of a large Caddyfile
+func diffLines(from []string, to []string) []diffLine {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	lines := []diffLine{}
+	for _, line := range from[:prefix] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	lines = append(lines, diffChangedLines(from[prefix:len(from)-suffix], to[prefix:len(to)-suffix])...)
+	for _, line := range from[len(from)-suffix:] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	return lines
+}
+
+func diffChangedLines(from []string, to []string) []diffLine {
+	lines := []diffLine{}
+	if len(from)*len(to) > maxDiffCells {
+		for _, line := range from {
+			lines = append(lines, diffLine{'-', line})
+		}
+		for _, line := range to {
+			lines = append(lines, diffLine{'+', line})
+		}
+		return lines
+	}
+
+	// common[i][j] is the length of the longest common subsequence of from[i:] and to[j:]
+	common := make([][]int, len(from)+1)
+	for i := range common {
+		common[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			lines = append(lines, diffLine{' ', from[i]})
+			i++
+			j++
+		case common[i+1][j] >= common[i][j+1]:
+			lines = append(lines, diffLine{'-', from[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', to[j]})
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		lines = append(lines, diffLine{'-', from[i]})
+	}
+	for ; j < len(to); j++ {
+		lines = append(lines, diffLine{'+', to[j]})
+	}
+	return lines
+}
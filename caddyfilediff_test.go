@@ -0,0 +1,86 @@
+package caddydockerproxy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	from := "a.example.com {\n" +
+		"	reverse_proxy 10.0.0.1:80\n" +
+		"}\n" +
+		"b.example.com {\n" +
+		"	reverse_proxy 10.0.0.2:80\n" +
+		"}\n" +
+		"c.example.com {\n" +
+		"	reverse_proxy 10.0.0.3:80\n" +
+		"}\n" +
+		"d.example.com {\n" +
+		"	reverse_proxy 10.0.0.4:80\n" +
+		"}\n"
+	to := "a.example.com {\n" +
+		"	reverse_proxy 10.0.0.1:80 10.0.0.5:80\n" +
+		"}\n" +
+		"b.example.com {\n" +
+		"	reverse_proxy 10.0.0.2:80\n" +
+		"}\n" +
+		"c.example.com {\n" +
+		"	reverse_proxy 10.0.0.3:80\n" +
+		"}\n" +
+		"e.example.com {\n" +
+		"	reverse_proxy 10.0.0.6:80\n" +
+		"}\n"
+
+	assert.Equal(t, "--- old\n"+
+		"+++ new\n"+
+		"@@ -1,5 +1,5 @@\n"+
+		" a.example.com {\n"+
+		"-	reverse_proxy 10.0.0.1:80\n"+
+		"+	reverse_proxy 10.0.0.1:80 10.0.0.5:80\n"+
+		" }\n"+
+		" b.example.com {\n"+
+		" 	reverse_proxy 10.0.0.2:80\n"+
+		"@@ -7,6 +7,6 @@\n"+
+		" c.example.com {\n"+
+		" 	reverse_proxy 10.0.0.3:80\n"+
+		" }\n"+
+		"-d.example.com {\n"+
+		"-	reverse_proxy 10.0.0.4:80\n"+
+		"+e.example.com {\n"+
+		"+	reverse_proxy 10.0.0.6:80\n"+
+		" }\n", unifiedDiff(from, to, "old", "new"))
+}
+
+func TestUnifiedDiff_AddedAndRemovedSites(t *testing.T) {
+	site := "a.example.com {\n\treverse_proxy 10.0.0.1:80\n}\n"
+
+	assert.Equal(t, "--- old\n+++ new\n@@ -0,0 +1,3 @@\n+a.example.com {\n+\treverse_proxy 10.0.0.1:80\n+}\n", unifiedDiff("", site, "old", "new"))
+	assert.Equal(t, "--- old\n+++ new\n@@ -1,3 +0,0 @@\n-a.example.com {\n-\treverse_proxy 10.0.0.1:80\n-}\n", unifiedDiff(site, "", "old", "new"))
+	assert.Equal(t, "", unifiedDiff(site, site, "old", "new"))
+}
+
+func TestLogCaddyfileDiff(t *testing.T) {
+	previous := "example.com {\n\treverse_proxy 172.17.0.2\n\tbasicauth {\n\t\tadmin secret-hash\n\t}\n}\n"
+	next := strings.Replace(previous, "172.17.0.2", "172.17.0.3", 1)
+
+	loader := CreateDockerLoader(&config.Options{DebugCaddyfileLogging: true})
+	// Refreshes without Caddyfile changes bumped the version since the previous Caddyfile
+	loader.lastVersion = 4
+	logs := captureLogs(func(log *zap.Logger) {
+		loader.logCaddyfileDiff(log, []byte(previous), 2, []byte(next))
+	})
+	assert.Contains(t, logs, "Caddyfile changes\t{\"version\": 4")
+	assert.Contains(t, logs, `--- Caddyfile version 2\n+++ Caddyfile version 4\n`)
+	assert.Contains(t, logs, `-\treverse_proxy 172.17.0.2\n+\treverse_proxy 172.17.0.3\n`)
+	assert.NotContains(t, logs, "secret-hash")
+
+	loader.options.DebugCaddyfileLogging = false
+	logs = captureLogs(func(log *zap.Logger) {
+		loader.logCaddyfileDiff(log, []byte(previous), 2, []byte(next))
+	})
+	assert.Empty(t, logs)
+}
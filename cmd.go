@@ -1,10 +1,14 @@
 package caddydockerproxy
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"net"
 	"os"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,70 +28,372 @@ func init() {
 		Func:  cmdFunc,
 		Usage: "<command>",
 		Short: "Run caddy as a docker proxy",
-		Flags: func() *flag.FlagSet {
-			fs := flag.NewFlagSet("docker-proxy", flag.ExitOnError)
+		Flags: createFlagSet("docker-proxy"),
+	})
+
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "docker-proxy-generate",
+		Func:  cmdGenerateFunc,
+		Usage: "[--caddyfile-path <path>] [--label-prefix <prefix>]",
+		Short: "Generate the Caddyfile from docker once and print it",
+		Long: `
+Connects to docker, generates the Caddyfile like docker-proxy does and prints it to stdout,
+without listening to docker events or configuring any server. It exits with a non-zero code
+when the Caddyfile can't be converted into a JSON config, which helps validating labels in CI.
+It accepts the same flags and environment variables as docker-proxy.`,
+		Flags: createFlagSet("docker-proxy-generate"),
+	})
+}
 
-			fs.Bool("mode", false,
-				"Which mode this instance should run: standalone | controller | server")
+// createFlagSet creates the flags of docker-proxy commands
+func createFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
 
-			fs.String("docker-sockets", "",
-				"Docker sockets comma separate")
+	fs.Bool("mode", false,
+		"Which mode this instance should run: standalone | controller | server")
 
-			fs.String("docker-certs-path", "",
-				"Docker socket certs path comma separate")
+	fs.String("docker-sockets", "",
+		"Docker sockets comma separate")
 
-			fs.String("docker-apis-version", "",
-				"Docker socket apis version comma separate")
+	fs.String("docker-certs-path", "",
+		"Docker socket certs path comma separate")
 
-			fs.String("controller-network", "",
-				"Network allowed to configure caddy server in CIDR notation. Ex: 10.200.200.0/24")
+	fs.String("docker-apis-version", "",
+		"Docker socket apis version comma separate")
 
-			fs.String("ingress-networks", "",
-				"Comma separated name of ingress networks connecting caddy servers to containers.\n"+
-					"When not defined, networks attached to controller container are considered ingress networks")
+	fs.String("controller-network", "",
+		"Network allowed to configure caddy server in CIDR notation. Ex: 10.200.200.0/24")
 
-			fs.String("caddyfile-path", "",
-				"Path to a base Caddyfile that will be extended with docker sites")
+	fs.String("ingress-networks", "",
+		"Comma separated name of ingress networks connecting caddy servers to containers.\n"+
+			"When not defined, networks attached to controller container are considered ingress networks")
 
-			fs.String("envfile", "",
-				"Environment file with environment variables in the KEY=VALUE format")
+	fs.String("caddyfile-path", "",
+		"Path to a base Caddyfile that will be extended with docker sites")
 
-			fs.String("label-prefix", generator.DefaultLabelPrefix,
-				"Prefix for Docker labels")
+	fs.String("envfile", "",
+		"Environment file with environment variables in the KEY=VALUE format")
 
-			fs.Bool("proxy-service-tasks", true,
-				"Proxy to service tasks instead of service load balancer")
+	fs.String("label-prefix", generator.DefaultLabelPrefix,
+		"Prefix for Docker labels")
 
-			fs.Bool("process-caddyfile", true,
-				"Process Caddyfile before loading it, removing invalid servers")
+	fs.Bool("proxy-service-tasks", true,
+		"Proxy to service tasks instead of service load balancer")
 
-			fs.Bool("scan-stopped-containers", false,
-				"Scan stopped containers and use its labels for caddyfile generation")
+	fs.Bool("process-caddyfile", true,
+		"Process Caddyfile before loading it, removing invalid servers")
 
-			fs.Duration("polling-interval", 30*time.Second,
-				"Interval caddy should manually check docker for a new caddyfile")
+	fs.Bool("scan-stopped-containers", false,
+		"Scan stopped containers and use its labels for caddyfile generation")
 
-			fs.Duration("event-throttle-interval", 100*time.Millisecond,
-				"Interval to throttle caddyfile updates triggered by docker events")
+	fs.Duration("polling-interval", 30*time.Second,
+		"Interval caddy should manually check docker for a new caddyfile")
 
-			return fs
-		}(),
-	})
+	fs.Duration("event-throttle-interval", 100*time.Millisecond,
+		"Time without docker events after which caddyfile is updated")
+
+	fs.Bool("debug-caddyfile-logging", false,
+		"Log the full Caddyfile and JSON config on every change along with the summary")
+
+	fs.Bool("log-full-config", false,
+		"Deprecated, use debug-caddyfile-logging")
+
+	fs.String("extra-route-sources", "",
+		"Comma separated paths of YAML files with additional routes merged with docker routes")
+
+	fs.Duration("route-removal-grace", 0,
+		"Time to keep routes of removed containers and services before removing them")
+
+	fs.Bool("verify-after-push", false,
+		"Fetch the config from servers after pushing it and warn if it doesn't match")
+
+	fs.Int("new-host-rate-limit", 0,
+		"Maximum number of new hostnames introduced per window, 0 means unlimited")
+
+	fs.Duration("new-host-rate-window", time.Hour,
+		"Window used to limit the number of new hostnames")
+
+	fs.String("push-source-addr", "",
+		"Local IP address used as source of configuration pushes to servers. Ex: 10.200.200.2")
+
+	fs.Bool("http-only-reload", false,
+		"Replace only the http app of servers when it is the only app that changed")
+
+	fs.Bool("terminal-routes", false,
+		"Convert route directives into mutually exclusive handle directives,\n"+
+			"preventing requests from falling through to routes of other services on the same site")
+
+	fs.Int("push-wave-size", 0,
+		"Maximum number of servers configured simultaneously, 0 means all servers at once")
+
+	fs.Duration("push-wave-delay", 0,
+		"Delay between waves of servers being configured")
+
+	fs.Bool("fail-on-route-collision", false,
+		"Ignore routes of services proxying the same site and matcher as a previous service")
+
+	fs.Bool("resolve-host-mode-upstreams", false,
+		"Use node address and published port as upstreams of services publishing ports in host mode")
+
+	fs.String("inventory-path", "",
+		"Path of a JSON file updated with the inventory of generated routes")
+
+	fs.String("on-no-exposed-ports", "",
+		"Handling of upstreams without port of containers exposing no ports: skip, error or default-port.\n"+
+			"When not defined, upstreams are generated without port")
+
+	fs.Int("no-exposed-ports-default-port", 80,
+		"Port used by upstreams of containers exposing no ports when on-no-exposed-ports is default-port")
+
+	fs.Int("empty-boot-retries", 0,
+		"Number of times generation is retried after startup while it yields an empty Caddyfile")
+
+	fs.Duration("empty-boot-retry-interval", 2*time.Second,
+		"Interval between generation retries while it yields an empty Caddyfile after startup")
+
+	fs.Bool("namespace-matchers", false,
+		"Suffix matcher names defined in labels with a hash of their container or service, avoiding collisions")
+
+	fs.String("global-site-prelude", "",
+		"Caddyfile directives added at the beginning of every site generated from labels")
+
+	fs.String("global-site-postlude", "",
+		"Caddyfile directives added at the end of every site generated from labels")
+
+	fs.Bool("confirm-with-health-probe", false,
+		"Consider a server configured only after its health probe passes, retrying on next update otherwise")
+
+	fs.String("health-probe-url", "",
+		"URL probed after configuring a server, {server} is replaced with the server address.\n"+
+			"Defaults to the /config/ endpoint of the admin API of the server")
+
+	fs.Duration("health-probe-timeout", 30*time.Second,
+		"Time to wait for the health probe of a server to pass")
+
+	fs.String("tls-conflict-policy", "first-wins",
+		"Handling of sites getting different tls directives from different containers or services:\n"+
+			"first-wins, error or most-specific-wins")
+
+	fs.String("access-log-format", "",
+		"Format of access logs of sites generated from labels: json or console.\n"+
+			"When not defined, sites don't log accesses unless configured by labels")
+
+	fs.String("access-log-omit-fields", "",
+		"Comma separated list of fields removed from access logs, like request>headers")
+
+	fs.Bool("config-diff-summary", false,
+		"Log and expose in admin API the hosts, upstreams and directives changed by each new config")
+
+	fs.Duration("inspect-cache-ttl", 0,
+		"Time Docker configs and nodes inspected during generation are cached, unless changed before.\n"+
+			"0 disables the cache")
+
+	fs.Int("inspect-concurrency", 1,
+		"Maximum number of concurrent Docker inspect requests during generation")
+
+	fs.String("hostname-allowlist", "",
+		"Comma separated list of regular expressions, site addresses of containers and services\n"+
+			"are only generated when their hostname fully matches one of them")
+
+	fs.Bool("tolerate-docker-permission-errors", false,
+		"Log Docker API permission errors as warnings and generate the Caddyfile from the objects that can be read,\n"+
+			"for Docker socket proxies that only allow some endpoints")
+
+	fs.String("published-port-strategy", "first-declared",
+		"Selection of the port of services publishing multiple ports in host mode:\n"+
+			"first-declared, lowest or target-matches-label")
+
+	fs.Bool("auto-hsts", false,
+		"Add Strict-Transport-Security header to sites served over HTTPS, unless label caddy_hsts is false")
+
+	fs.String("reconcile-cron", "",
+		"Cron expression scheduling updates that push the config to all servers even when unchanged,\n"+
+			"like \"0 3 * * *\". An optional leading field sets seconds")
+
+	fs.String("server-header", "",
+		"Value replacing the Server response header of all sites, removing it when set to empty.\n"+
+			"Sites setting their own Server header are left unchanged")
+
+	fs.Duration("route-drain-period", 0,
+		"Time routes removed from the config are kept answering 503, while requests to their upstreams drain.\n"+
+			"0 removes routes immediately")
+
+	fs.Duration("events-retry-base", time.Second,
+		"Delay before reconnecting to Docker events after an error, doubled on each consecutive error")
+
+	fs.Duration("events-retry-max", 30*time.Second,
+		"Maximum delay before reconnecting to Docker events")
+
+	fs.Duration("events-retry-reset-after", time.Minute,
+		"Time connected to Docker events after which the reconnection delay is reset")
+
+	fs.String("admin-scheme", "http",
+		"Scheme of the admin endpoint of servers: http or https.\n"+
+			"With https, servers only accept configurations from the admin client certificate")
+
+	fs.String("admin-ca-cert", "",
+		"Path of the CA certificate verifying the admin endpoint of servers. Defaults to system roots")
+
+	fs.String("admin-client-cert", "",
+		"Path of the client certificate used to push configurations to servers over https")
+
+	fs.String("admin-client-key", "",
+		"Path of the key of the admin client certificate")
+
+	fs.Int("admin-port", 2019,
+		"Port of the admin endpoint of servers")
+
+	fs.Int("push-retry-attempts", 3,
+		"Maximum attempts to send a configuration to a server when it can't be reached or responds with a server error")
+
+	fs.Duration("push-retry-delay", time.Second,
+		"Delay between attempts to send a configuration to a server")
+
+	fs.Duration("push-timeout", 30*time.Second,
+		"Maximum time spent sending a configuration to a server, including retries")
+
+	fs.Duration("admin-request-timeout", 30*time.Second,
+		"Maximum time waiting for a response of the admin endpoint of a server")
+
+	fs.Duration("event-debounce-max-wait", 2*time.Second,
+		"Maximum time caddyfile updates wait for docker events to stop arriving")
+
+	fs.String("caddyfile-dump-path", "",
+		"Path of a file where the generated Caddyfile is written every time it changes")
+
+	fs.Bool("validate-before-push", false,
+		"Validate configurations locally before sending them to servers, keeping the previous configuration when invalid")
+
+	fs.Int("push-concurrency", 10,
+		"Maximum number of servers receiving configurations in parallel, 0 means no limit")
+
+	fs.String("docker-host", "",
+		"Docker host URL used when no docker sockets are set, DOCKER_HOST env is used when empty")
+
+	fs.String("event-scopes", "",
+		"Comma separated scopes of docker events listened to, swarm and local when empty")
+
+	fs.String("event-types", "",
+		"Comma separated types of docker events listened to, service, container, config, node and network when empty")
+
+	fs.String("event-actions", "",
+		"Comma separated type:action pairs of docker events triggering updates, like container:start.\n"+
+			"Types of these events are listened to as well. Container create, start, stop, die and destroy,\n"+
+			"service create, update and remove, config create and remove,\n"+
+			"and network connect and disconnect when empty")
+
+	fs.String("redact-directives", "",
+		"Comma separated names of directives, and JSON config keys, whose values are redacted when logging configurations")
+
+	fs.Int("events-max-failures", 0,
+		"Consecutive failures of Docker events connections after which an error is logged, 0 means never")
+
+	fs.Bool("events-stop-on-max-failures", false,
+		"Stop reconnecting to Docker events after events-max-failures consecutive failures")
+
+	fs.String("extra-label-prefixes", "",
+		"Comma separated label prefixes used along with label-prefix, like the prefixes of different teams")
+
+	fs.String("scan-filters", "",
+		"Comma separated Docker API filters of scanned containers and services, like label=caddy_enabled=true")
+
+	fs.String("push-webhook-url", "",
+		"URL receiving a JSON POST when sending a configuration to a server fails")
+
+	fs.Bool("push-webhook-on-success", false,
+		"Also POST to push-webhook-url when a server is successfully configured")
+
+	fs.Duration("push-webhook-timeout", 5*time.Second,
+		"Timeout of requests to push-webhook-url")
+
+	fs.Duration("max-polling-interval", 0,
+		"Interval polling stretches to while events are received and updates succeed.\n"+
+			"Polling stays at polling-interval when it isn't greater")
+
+	fs.Duration("generation-timeout", 30*time.Second,
+		"Timeout of Docker API requests generating a Caddyfile, keeping the previous config when reached, 0 means no timeout")
+
+	fs.String("excluded-servers", "",
+		"Comma separated names or glob patterns of servers that are never sent configurations, like 10.0.1.*")
+
+	fs.String("leader-lock", "",
+		"Name of a swarm config used as a lock, so only the controller holding it sends configurations to servers.\n"+
+			"Requires the first docker host to be a swarm manager")
+
+	fs.Duration("leader-lease-duration", 30*time.Second,
+		"Time the leader keeps leader-lock without renewing it, other controllers take over after it")
+
+	fs.Int("breaker-threshold", 0,
+		"Consecutive failed pushes to a server after which it's skipped for breaker-cooldown, 0 disables it")
+
+	fs.Duration("breaker-cooldown", time.Minute,
+		"Time a server is skipped after breaker-threshold consecutive failed pushes, before it's tried again")
+
+	fs.Bool("compress-config-push", false,
+		"Compress configurations sent to servers with gzip, servers that don't support it are sent uncompressed configurations")
+
+	fs.String("admin-auth-user", "",
+		"User of basic auth credentials sent to the admin endpoint of servers, when it's behind an authenticating proxy")
+
+	fs.String("admin-auth-password", "",
+		"Password of basic auth credentials sent to the admin endpoint of servers")
+
+	fs.String("admin-auth-token", "",
+		"Bearer token sent to the admin endpoint of servers, instead of basic auth credentials")
+
+	fs.Bool("conditional-push", false,
+		"Only apply configurations to servers whose configuration didn't change since the last one sent to them,\n"+
+			"sending them again otherwise. Protects against configurations sent concurrently by other controllers")
+
+	fs.Bool("caddyfile-expand-env", false,
+		"Replace environment variables like {$NAME} or {$NAME:default} in the base Caddyfile before extending it")
+
+	fs.Int("polling-jitter", 0,
+		"Percentage of polling-interval polls are randomly shifted by, so controllers started together don't poll at the same time.\n"+
+			"The first update is also delayed by up to that percentage of polling-interval")
+
+	fs.Bool("fallback-to-env", false,
+		"Read caddy labels from environment variables named like them, for containers without caddy labels")
+
+	fs.String("admin-load-path", "/load",
+		"Path of the admin endpoint of servers loading configurations, for admin endpoints behind a proxy rewriting paths")
+
+	fs.String("admin-load-method", "POST",
+		"HTTP method used to send configurations to admin-load-path: POST, PUT or PATCH")
+
+	fs.String("servers-srv", "",
+		"DNS SRV record resolved on each update to the host:port admin endpoints of servers to push configurations to")
+
+	fs.String("servers-srv-mode", "merge",
+		"How servers-srv targets are combined with the servers found through labels:\n"+
+			"merge pushes to both, replace pushes only to servers-srv targets")
+
+	fs.Duration("min-update-interval", 0,
+		"Minimum time between the start of updates triggered by events or polling.\n"+
+			"Updates due sooner are delayed and coalesced into one. 0 disables it")
+
+	return fs
 }
 
 func cmdFunc(flags caddycmd.Flags) (int, error) {
 	caddy.TrapSignals()
 
-	options := createOptions(flags)
+	options, err := createOptions(flags)
+	if err != nil {
+		return 1, err
+	}
 	log := logger()
 
 	if options.Mode&config.Server == config.Server {
 		log.Info("Running caddy proxy server")
 
-		err := caddy.Run(&caddy.Config{
-			Admin: &caddy.AdminConfig{
-				Listen: getAdminListen(options),
-			},
+		admin, err := createAdminConfig(options, getAdminHost(options))
+		if err != nil {
+			return 1, err
+		}
+
+		err = caddy.Run(&caddy.Config{
+			Admin: admin,
 		})
 		if err != nil {
 			return 1, err
@@ -98,18 +404,40 @@ func cmdFunc(flags caddycmd.Flags) (int, error) {
 		log.Info("Running caddy proxy controller")
 		loader := CreateDockerLoader(options)
 		if err := loader.Start(); err != nil {
+			loader.Stop()
 			if err := caddy.Stop(); err != nil {
 				return 1, err
 			}
 
 			return 1, err
 		}
+		// Finish pushes in progress before the process exits
+		caddy.OnExit(func(context.Context) {
+			loader.Stop()
+		})
 	}
 
 	select {}
 }
 
-func getAdminListen(options *config.Options) string {
+func cmdGenerateFunc(flags caddycmd.Flags) (int, error) {
+	options, err := createOptions(flags)
+	if err != nil {
+		return 1, err
+	}
+	log := logger()
+
+	loader := CreateDockerLoader(options)
+	if err := loader.connect(log); err != nil {
+		return 1, err
+	}
+	if err := loader.printCaddyfile(log, os.Stdout); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+func getAdminHost(options *config.Options) string {
 	if options.ControllerNetwork != nil {
 		ifaces, err := net.Interfaces()
 		log := logger()
@@ -127,22 +455,22 @@ func getAdminListen(options *config.Options) string {
 				switch v := a.(type) {
 				case *net.IPAddr:
 					if options.ControllerNetwork.Contains(v.IP) {
-						return "tcp/" + v.IP.String() + ":2019"
+						return v.IP.String()
 					}
 					break
 				case *net.IPNet:
 					if options.ControllerNetwork.Contains(v.IP) {
-						return "tcp/" + v.IP.String() + ":2019"
+						return v.IP.String()
 					}
 					break
 				}
 			}
 		}
 	}
-	return "tcp/localhost:2019"
+	return "localhost"
 }
 
-func createOptions(flags caddycmd.Flags) *config.Options {
+func createOptions(flags caddycmd.Flags) (*config.Options, error) {
 	caddyfilePath := flags.String("caddyfile-path")
 	envFile := flags.String("envfile")
 	labelPrefixFlag := flags.String("label-prefix")
@@ -157,6 +485,92 @@ func createOptions(flags caddycmd.Flags) *config.Options {
 	dockerCertsPathFlag := flags.String("docker-certs-path")
 	dockerAPIsVersionFlag := flags.String("docker-apis-version")
 	ingressNetworksFlag := flags.String("ingress-networks")
+	debugCaddyfileLoggingFlag := flags.Bool("debug-caddyfile-logging")
+	logFullConfigFlag := flags.Bool("log-full-config")
+	extraRouteSourcesFlag := flags.String("extra-route-sources")
+	routeRemovalGraceFlag := flags.Duration("route-removal-grace")
+	verifyAfterPushFlag := flags.Bool("verify-after-push")
+	newHostRateLimitFlag := flags.Int("new-host-rate-limit")
+	newHostRateWindowFlag := flags.Duration("new-host-rate-window")
+	pushSourceAddrFlag := flags.String("push-source-addr")
+	httpOnlyReloadFlag := flags.Bool("http-only-reload")
+	terminalRoutesFlag := flags.Bool("terminal-routes")
+	pushWaveSizeFlag := flags.Int("push-wave-size")
+	pushWaveDelayFlag := flags.Duration("push-wave-delay")
+	failOnRouteCollisionFlag := flags.Bool("fail-on-route-collision")
+	resolveHostModeUpstreamsFlag := flags.Bool("resolve-host-mode-upstreams")
+	inventoryPathFlag := flags.String("inventory-path")
+	onNoExposedPortsFlag := flags.String("on-no-exposed-ports")
+	noExposedPortsDefaultPortFlag := flags.Int("no-exposed-ports-default-port")
+	emptyBootRetriesFlag := flags.Int("empty-boot-retries")
+	emptyBootRetryIntervalFlag := flags.Duration("empty-boot-retry-interval")
+	namespaceMatchersFlag := flags.Bool("namespace-matchers")
+	globalSitePreludeFlag := flags.String("global-site-prelude")
+	globalSitePostludeFlag := flags.String("global-site-postlude")
+	confirmWithHealthProbeFlag := flags.Bool("confirm-with-health-probe")
+	healthProbeURLFlag := flags.String("health-probe-url")
+	healthProbeTimeoutFlag := flags.Duration("health-probe-timeout")
+	tlsConflictPolicyFlag := flags.String("tls-conflict-policy")
+	accessLogFormatFlag := flags.String("access-log-format")
+	accessLogOmitFieldsFlag := flags.String("access-log-omit-fields")
+	configDiffSummaryFlag := flags.Bool("config-diff-summary")
+	inspectCacheTTLFlag := flags.Duration("inspect-cache-ttl")
+	inspectConcurrencyFlag := flags.Int("inspect-concurrency")
+	hostnameAllowlistFlag := flags.String("hostname-allowlist")
+	tolerateDockerPermissionErrorsFlag := flags.Bool("tolerate-docker-permission-errors")
+	publishedPortStrategyFlag := flags.String("published-port-strategy")
+	autoHSTSFlag := flags.Bool("auto-hsts")
+	reconcileCronFlag := flags.String("reconcile-cron")
+	serverHeaderFlag := flags.String("server-header")
+	routeDrainPeriodFlag := flags.Duration("route-drain-period")
+	eventsRetryBaseFlag := flags.Duration("events-retry-base")
+	eventsRetryMaxFlag := flags.Duration("events-retry-max")
+	eventsRetryResetAfterFlag := flags.Duration("events-retry-reset-after")
+	adminSchemeFlag := flags.String("admin-scheme")
+	adminCACertFlag := flags.String("admin-ca-cert")
+	adminClientCertFlag := flags.String("admin-client-cert")
+	adminClientKeyFlag := flags.String("admin-client-key")
+	adminPortFlag := flags.Int("admin-port")
+	pushRetryAttemptsFlag := flags.Int("push-retry-attempts")
+	pushRetryDelayFlag := flags.Duration("push-retry-delay")
+	pushTimeoutFlag := flags.Duration("push-timeout")
+	adminRequestTimeoutFlag := flags.Duration("admin-request-timeout")
+	eventDebounceMaxWaitFlag := flags.Duration("event-debounce-max-wait")
+	caddyfileDumpPathFlag := flags.String("caddyfile-dump-path")
+	validateBeforePushFlag := flags.Bool("validate-before-push")
+	pushConcurrencyFlag := flags.Int("push-concurrency")
+	dockerHostFlag := flags.String("docker-host")
+	eventScopesFlag := flags.String("event-scopes")
+	eventTypesFlag := flags.String("event-types")
+	eventActionsFlag := flags.String("event-actions")
+	redactDirectivesFlag := flags.String("redact-directives")
+	eventsMaxFailuresFlag := flags.Int("events-max-failures")
+	eventsStopOnMaxFailuresFlag := flags.Bool("events-stop-on-max-failures")
+	extraLabelPrefixesFlag := flags.String("extra-label-prefixes")
+	scanFiltersFlag := flags.String("scan-filters")
+	pushWebhookURLFlag := flags.String("push-webhook-url")
+	pushWebhookOnSuccessFlag := flags.Bool("push-webhook-on-success")
+	pushWebhookTimeoutFlag := flags.Duration("push-webhook-timeout")
+	maxPollingIntervalFlag := flags.Duration("max-polling-interval")
+	generationTimeoutFlag := flags.Duration("generation-timeout")
+	excludedServersFlag := flags.String("excluded-servers")
+	leaderLockFlag := flags.String("leader-lock")
+	leaderLeaseDurationFlag := flags.Duration("leader-lease-duration")
+	breakerThresholdFlag := flags.Int("breaker-threshold")
+	breakerCooldownFlag := flags.Duration("breaker-cooldown")
+	compressConfigPushFlag := flags.Bool("compress-config-push")
+	adminAuthUserFlag := flags.String("admin-auth-user")
+	adminAuthPasswordFlag := flags.String("admin-auth-password")
+	adminAuthTokenFlag := flags.String("admin-auth-token")
+	conditionalPushFlag := flags.Bool("conditional-push")
+	caddyfileExpandEnvFlag := flags.Bool("caddyfile-expand-env")
+	pollingJitterFlag := flags.Int("polling-jitter")
+	fallbackToEnvFlag := flags.Bool("fallback-to-env")
+	adminLoadPathFlag := flags.String("admin-load-path")
+	adminLoadMethodFlag := flags.String("admin-load-method")
+	serversSRVFlag := flags.String("servers-srv")
+	serversSRVModeFlag := flags.String("servers-srv-mode")
+	minUpdateIntervalFlag := flags.Duration("min-update-interval")
 
 	options := &config.Options{}
 
@@ -279,5 +693,810 @@ func createOptions(flags caddycmd.Flags) *config.Options {
 		options.EventThrottleInterval = eventThrottleIntervalFlag
 	}
 
-	return options
+	if debugCaddyfileLoggingEnv := os.Getenv("CADDY_DOCKER_DEBUG_CADDYFILE_LOGGING"); debugCaddyfileLoggingEnv != "" {
+		options.DebugCaddyfileLogging = isTrue.MatchString(debugCaddyfileLoggingEnv)
+	} else {
+		options.DebugCaddyfileLogging = debugCaddyfileLoggingFlag
+	}
+
+	logFullConfig := logFullConfigFlag
+	if logFullConfigEnv := os.Getenv("CADDY_DOCKER_LOG_FULL_CONFIG"); logFullConfigEnv != "" {
+		logFullConfig = isTrue.MatchString(logFullConfigEnv)
+	}
+	if logFullConfig {
+		log.Warn("CADDY_DOCKER_LOG_FULL_CONFIG and --log-full-config are deprecated, use CADDY_DOCKER_DEBUG_CADDYFILE_LOGGING or --debug-caddyfile-logging")
+		options.DebugCaddyfileLogging = true
+	}
+
+	if extraRouteSourcesEnv := os.Getenv("CADDY_DOCKER_EXTRA_ROUTE_SOURCES"); extraRouteSourcesEnv != "" {
+		options.ExtraRouteSources = strings.Split(extraRouteSourcesEnv, ",")
+	} else if extraRouteSourcesFlag != "" {
+		options.ExtraRouteSources = strings.Split(extraRouteSourcesFlag, ",")
+	}
+
+	if routeRemovalGraceEnv := os.Getenv("CADDY_DOCKER_ROUTE_REMOVAL_GRACE"); routeRemovalGraceEnv != "" {
+		if p, err := time.ParseDuration(routeRemovalGraceEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_ROUTE_REMOVAL_GRACE", zap.String("CADDY_DOCKER_ROUTE_REMOVAL_GRACE", routeRemovalGraceEnv), zap.Error(err))
+			options.RouteRemovalGrace = routeRemovalGraceFlag
+		} else {
+			options.RouteRemovalGrace = p
+		}
+	} else {
+		options.RouteRemovalGrace = routeRemovalGraceFlag
+	}
+
+	if verifyAfterPushEnv := os.Getenv("CADDY_DOCKER_VERIFY_AFTER_PUSH"); verifyAfterPushEnv != "" {
+		options.VerifyAfterPush = isTrue.MatchString(verifyAfterPushEnv)
+	} else {
+		options.VerifyAfterPush = verifyAfterPushFlag
+	}
+
+	if newHostRateLimitEnv := os.Getenv("CADDY_DOCKER_NEW_HOST_RATE_LIMIT"); newHostRateLimitEnv != "" {
+		if p, err := strconv.Atoi(newHostRateLimitEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_NEW_HOST_RATE_LIMIT", zap.String("CADDY_DOCKER_NEW_HOST_RATE_LIMIT", newHostRateLimitEnv), zap.Error(err))
+			options.NewHostRateLimit = newHostRateLimitFlag
+		} else {
+			options.NewHostRateLimit = p
+		}
+	} else {
+		options.NewHostRateLimit = newHostRateLimitFlag
+	}
+
+	if newHostRateWindowEnv := os.Getenv("CADDY_DOCKER_NEW_HOST_RATE_WINDOW"); newHostRateWindowEnv != "" {
+		if p, err := time.ParseDuration(newHostRateWindowEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_NEW_HOST_RATE_WINDOW", zap.String("CADDY_DOCKER_NEW_HOST_RATE_WINDOW", newHostRateWindowEnv), zap.Error(err))
+			options.NewHostRateWindow = newHostRateWindowFlag
+		} else {
+			options.NewHostRateWindow = p
+		}
+	} else {
+		options.NewHostRateWindow = newHostRateWindowFlag
+	}
+
+	if pushSourceAddrEnv := os.Getenv("CADDY_DOCKER_PUSH_SOURCE_ADDR"); pushSourceAddrEnv != "" {
+		if ip := net.ParseIP(pushSourceAddrEnv); ip == nil {
+			log.Error("Failed to parse CADDY_DOCKER_PUSH_SOURCE_ADDR", zap.String("CADDY_DOCKER_PUSH_SOURCE_ADDR", pushSourceAddrEnv))
+		} else {
+			options.PushSourceAddr = ip
+		}
+	} else if pushSourceAddrFlag != "" {
+		if ip := net.ParseIP(pushSourceAddrFlag); ip == nil {
+			log.Error("Failed to parse push-source-addr", zap.String("push-source-addr", pushSourceAddrFlag))
+		} else {
+			options.PushSourceAddr = ip
+		}
+	}
+
+	if httpOnlyReloadEnv := os.Getenv("CADDY_DOCKER_HTTP_ONLY_RELOAD"); httpOnlyReloadEnv != "" {
+		options.HTTPOnlyReload = isTrue.MatchString(httpOnlyReloadEnv)
+	} else {
+		options.HTTPOnlyReload = httpOnlyReloadFlag
+	}
+
+	if terminalRoutesEnv := os.Getenv("CADDY_DOCKER_TERMINAL_ROUTES"); terminalRoutesEnv != "" {
+		options.TerminalRoutes = isTrue.MatchString(terminalRoutesEnv)
+	} else {
+		options.TerminalRoutes = terminalRoutesFlag
+	}
+
+	if pushWaveSizeEnv := os.Getenv("CADDY_DOCKER_PUSH_WAVE_SIZE"); pushWaveSizeEnv != "" {
+		if p, err := strconv.Atoi(pushWaveSizeEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_PUSH_WAVE_SIZE", zap.String("CADDY_DOCKER_PUSH_WAVE_SIZE", pushWaveSizeEnv), zap.Error(err))
+			options.PushWaveSize = pushWaveSizeFlag
+		} else {
+			options.PushWaveSize = p
+		}
+	} else {
+		options.PushWaveSize = pushWaveSizeFlag
+	}
+
+	if pushWaveDelayEnv := os.Getenv("CADDY_DOCKER_PUSH_WAVE_DELAY"); pushWaveDelayEnv != "" {
+		if p, err := time.ParseDuration(pushWaveDelayEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_PUSH_WAVE_DELAY", zap.String("CADDY_DOCKER_PUSH_WAVE_DELAY", pushWaveDelayEnv), zap.Error(err))
+			options.PushWaveDelay = pushWaveDelayFlag
+		} else {
+			options.PushWaveDelay = p
+		}
+	} else {
+		options.PushWaveDelay = pushWaveDelayFlag
+	}
+
+	if failOnRouteCollisionEnv := os.Getenv("CADDY_DOCKER_FAIL_ON_ROUTE_COLLISION"); failOnRouteCollisionEnv != "" {
+		options.FailOnRouteCollision = isTrue.MatchString(failOnRouteCollisionEnv)
+	} else {
+		options.FailOnRouteCollision = failOnRouteCollisionFlag
+	}
+
+	if resolveHostModeUpstreamsEnv := os.Getenv("CADDY_DOCKER_RESOLVE_HOST_MODE_UPSTREAMS"); resolveHostModeUpstreamsEnv != "" {
+		options.ResolveHostModeUpstreams = isTrue.MatchString(resolveHostModeUpstreamsEnv)
+	} else {
+		options.ResolveHostModeUpstreams = resolveHostModeUpstreamsFlag
+	}
+
+	if inventoryPathEnv := os.Getenv("CADDY_DOCKER_INVENTORY_PATH"); inventoryPathEnv != "" {
+		options.InventoryPath = inventoryPathEnv
+	} else {
+		options.InventoryPath = inventoryPathFlag
+	}
+
+	var onNoExposedPorts string
+	if onNoExposedPortsEnv := os.Getenv("CADDY_DOCKER_ON_NO_EXPOSED_PORTS"); onNoExposedPortsEnv != "" {
+		onNoExposedPorts = onNoExposedPortsEnv
+	} else {
+		onNoExposedPorts = onNoExposedPortsFlag
+	}
+	switch onNoExposedPorts {
+	case "", config.NoExposedPortsSkip, config.NoExposedPortsError, config.NoExposedPortsDefaultPort:
+		options.OnNoExposedPorts = onNoExposedPorts
+	default:
+		log.Error("Invalid on-no-exposed-ports", zap.String("on-no-exposed-ports", onNoExposedPorts))
+	}
+
+	if noExposedPortsDefaultPortEnv := os.Getenv("CADDY_DOCKER_NO_EXPOSED_PORTS_DEFAULT_PORT"); noExposedPortsDefaultPortEnv != "" {
+		if p, err := strconv.Atoi(noExposedPortsDefaultPortEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_NO_EXPOSED_PORTS_DEFAULT_PORT", zap.String("CADDY_DOCKER_NO_EXPOSED_PORTS_DEFAULT_PORT", noExposedPortsDefaultPortEnv), zap.Error(err))
+			options.NoExposedPortsDefaultPort = noExposedPortsDefaultPortFlag
+		} else {
+			options.NoExposedPortsDefaultPort = p
+		}
+	} else {
+		options.NoExposedPortsDefaultPort = noExposedPortsDefaultPortFlag
+	}
+
+	if emptyBootRetriesEnv := os.Getenv("CADDY_DOCKER_EMPTY_BOOT_RETRIES"); emptyBootRetriesEnv != "" {
+		if p, err := strconv.Atoi(emptyBootRetriesEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_EMPTY_BOOT_RETRIES", zap.String("CADDY_DOCKER_EMPTY_BOOT_RETRIES", emptyBootRetriesEnv), zap.Error(err))
+			options.EmptyBootRetries = emptyBootRetriesFlag
+		} else {
+			options.EmptyBootRetries = p
+		}
+	} else {
+		options.EmptyBootRetries = emptyBootRetriesFlag
+	}
+
+	if emptyBootRetryIntervalEnv := os.Getenv("CADDY_DOCKER_EMPTY_BOOT_RETRY_INTERVAL"); emptyBootRetryIntervalEnv != "" {
+		if p, err := time.ParseDuration(emptyBootRetryIntervalEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_EMPTY_BOOT_RETRY_INTERVAL", zap.String("CADDY_DOCKER_EMPTY_BOOT_RETRY_INTERVAL", emptyBootRetryIntervalEnv), zap.Error(err))
+			options.EmptyBootRetryInterval = emptyBootRetryIntervalFlag
+		} else {
+			options.EmptyBootRetryInterval = p
+		}
+	} else {
+		options.EmptyBootRetryInterval = emptyBootRetryIntervalFlag
+	}
+
+	if namespaceMatchersEnv := os.Getenv("CADDY_DOCKER_NAMESPACE_MATCHERS"); namespaceMatchersEnv != "" {
+		options.NamespaceMatchers = isTrue.MatchString(namespaceMatchersEnv)
+	} else {
+		options.NamespaceMatchers = namespaceMatchersFlag
+	}
+
+	if globalSitePreludeEnv := os.Getenv("CADDY_DOCKER_GLOBAL_SITE_PRELUDE"); globalSitePreludeEnv != "" {
+		options.GlobalSitePrelude = globalSitePreludeEnv
+	} else {
+		options.GlobalSitePrelude = globalSitePreludeFlag
+	}
+
+	if globalSitePostludeEnv := os.Getenv("CADDY_DOCKER_GLOBAL_SITE_POSTLUDE"); globalSitePostludeEnv != "" {
+		options.GlobalSitePostlude = globalSitePostludeEnv
+	} else {
+		options.GlobalSitePostlude = globalSitePostludeFlag
+	}
+
+	if confirmWithHealthProbeEnv := os.Getenv("CADDY_DOCKER_CONFIRM_WITH_HEALTH_PROBE"); confirmWithHealthProbeEnv != "" {
+		options.ConfirmWithHealthProbe = isTrue.MatchString(confirmWithHealthProbeEnv)
+	} else {
+		options.ConfirmWithHealthProbe = confirmWithHealthProbeFlag
+	}
+
+	if healthProbeURLEnv := os.Getenv("CADDY_DOCKER_HEALTH_PROBE_URL"); healthProbeURLEnv != "" {
+		options.HealthProbeURL = healthProbeURLEnv
+	} else {
+		options.HealthProbeURL = healthProbeURLFlag
+	}
+
+	if healthProbeTimeoutEnv := os.Getenv("CADDY_DOCKER_HEALTH_PROBE_TIMEOUT"); healthProbeTimeoutEnv != "" {
+		if p, err := time.ParseDuration(healthProbeTimeoutEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_HEALTH_PROBE_TIMEOUT", zap.String("CADDY_DOCKER_HEALTH_PROBE_TIMEOUT", healthProbeTimeoutEnv), zap.Error(err))
+			options.HealthProbeTimeout = healthProbeTimeoutFlag
+		} else {
+			options.HealthProbeTimeout = p
+		}
+	} else {
+		options.HealthProbeTimeout = healthProbeTimeoutFlag
+	}
+
+	var tlsConflictPolicy string
+	if tlsConflictPolicyEnv := os.Getenv("CADDY_DOCKER_TLS_CONFLICT_POLICY"); tlsConflictPolicyEnv != "" {
+		tlsConflictPolicy = tlsConflictPolicyEnv
+	} else {
+		tlsConflictPolicy = tlsConflictPolicyFlag
+	}
+	switch tlsConflictPolicy {
+	case "", config.TLSConflictFirstWins, config.TLSConflictError, config.TLSConflictMostSpecificWins:
+		options.TLSConflictPolicy = tlsConflictPolicy
+	default:
+		log.Error("Invalid tls-conflict-policy", zap.String("tls-conflict-policy", tlsConflictPolicy))
+	}
+
+	var accessLogFormat string
+	if accessLogFormatEnv := os.Getenv("CADDY_DOCKER_ACCESS_LOG_FORMAT"); accessLogFormatEnv != "" {
+		accessLogFormat = accessLogFormatEnv
+	} else {
+		accessLogFormat = accessLogFormatFlag
+	}
+	switch accessLogFormat {
+	case "", "json", "console":
+		options.AccessLogFormat = accessLogFormat
+	default:
+		log.Error("Invalid access-log-format", zap.String("access-log-format", accessLogFormat))
+	}
+
+	if accessLogOmitFieldsEnv := os.Getenv("CADDY_DOCKER_ACCESS_LOG_OMIT_FIELDS"); accessLogOmitFieldsEnv != "" {
+		options.AccessLogOmitFields = strings.Split(accessLogOmitFieldsEnv, ",")
+	} else if accessLogOmitFieldsFlag != "" {
+		options.AccessLogOmitFields = strings.Split(accessLogOmitFieldsFlag, ",")
+	}
+
+	if configDiffSummaryEnv := os.Getenv("CADDY_DOCKER_CONFIG_DIFF_SUMMARY"); configDiffSummaryEnv != "" {
+		options.ConfigDiffSummary = isTrue.MatchString(configDiffSummaryEnv)
+	} else {
+		options.ConfigDiffSummary = configDiffSummaryFlag
+	}
+
+	if inspectCacheTTLEnv := os.Getenv("CADDY_DOCKER_INSPECT_CACHE_TTL"); inspectCacheTTLEnv != "" {
+		if p, err := time.ParseDuration(inspectCacheTTLEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_INSPECT_CACHE_TTL", zap.String("CADDY_DOCKER_INSPECT_CACHE_TTL", inspectCacheTTLEnv), zap.Error(err))
+			options.InspectCacheTTL = inspectCacheTTLFlag
+		} else {
+			options.InspectCacheTTL = p
+		}
+	} else {
+		options.InspectCacheTTL = inspectCacheTTLFlag
+	}
+
+	if inspectConcurrencyEnv := os.Getenv("CADDY_DOCKER_INSPECT_CONCURRENCY"); inspectConcurrencyEnv != "" {
+		if p, err := strconv.Atoi(inspectConcurrencyEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_INSPECT_CONCURRENCY", zap.String("CADDY_DOCKER_INSPECT_CONCURRENCY", inspectConcurrencyEnv), zap.Error(err))
+			options.InspectConcurrency = inspectConcurrencyFlag
+		} else {
+			options.InspectConcurrency = p
+		}
+	} else {
+		options.InspectConcurrency = inspectConcurrencyFlag
+	}
+
+	// An invalid allowlist fails startup instead of allowing all hostnames
+	var hostnameAllowlistErr error
+	if hostnameAllowlistEnv := os.Getenv("CADDY_DOCKER_HOSTNAME_ALLOWLIST"); hostnameAllowlistEnv != "" {
+		options.HostnameAllowlist, hostnameAllowlistErr = parseHostnamePatterns("CADDY_DOCKER_HOSTNAME_ALLOWLIST", hostnameAllowlistEnv)
+	} else if hostnameAllowlistFlag != "" {
+		options.HostnameAllowlist, hostnameAllowlistErr = parseHostnamePatterns("hostname-allowlist", hostnameAllowlistFlag)
+	}
+	if hostnameAllowlistErr != nil {
+		log.Error("Invalid hostname allowlist", zap.Error(hostnameAllowlistErr))
+		return nil, hostnameAllowlistErr
+	}
+
+	if tolerateDockerPermissionErrorsEnv := os.Getenv("CADDY_DOCKER_TOLERATE_DOCKER_PERMISSION_ERRORS"); tolerateDockerPermissionErrorsEnv != "" {
+		options.TolerateDockerPermissionErrors = isTrue.MatchString(tolerateDockerPermissionErrorsEnv)
+	} else {
+		options.TolerateDockerPermissionErrors = tolerateDockerPermissionErrorsFlag
+	}
+
+	var publishedPortStrategy string
+	if publishedPortStrategyEnv := os.Getenv("CADDY_DOCKER_PUBLISHED_PORT_STRATEGY"); publishedPortStrategyEnv != "" {
+		publishedPortStrategy = publishedPortStrategyEnv
+	} else {
+		publishedPortStrategy = publishedPortStrategyFlag
+	}
+	switch publishedPortStrategy {
+	case "", config.PublishedPortFirstDeclared, config.PublishedPortLowest, config.PublishedPortTargetMatchesLabel:
+		options.PublishedPortStrategy = publishedPortStrategy
+	default:
+		log.Error("Invalid published-port-strategy", zap.String("published-port-strategy", publishedPortStrategy))
+	}
+
+	if autoHSTSEnv := os.Getenv("CADDY_DOCKER_AUTO_HSTS"); autoHSTSEnv != "" {
+		options.AutoHSTS = isTrue.MatchString(autoHSTSEnv)
+	} else {
+		options.AutoHSTS = autoHSTSFlag
+	}
+
+	if reconcileCronEnv := os.Getenv("CADDY_DOCKER_RECONCILE_CRON"); reconcileCronEnv != "" {
+		options.ReconcileCron = reconcileCronEnv
+	} else {
+		options.ReconcileCron = reconcileCronFlag
+	}
+
+	if serverHeaderEnv, found := os.LookupEnv("CADDY_DOCKER_SERVER_HEADER"); found {
+		options.ServerHeader = &serverHeaderEnv
+	} else if flags.Changed("server-header") {
+		options.ServerHeader = &serverHeaderFlag
+	}
+
+	if routeDrainPeriodEnv := os.Getenv("CADDY_DOCKER_ROUTE_DRAIN_PERIOD"); routeDrainPeriodEnv != "" {
+		if p, err := time.ParseDuration(routeDrainPeriodEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_ROUTE_DRAIN_PERIOD", zap.String("CADDY_DOCKER_ROUTE_DRAIN_PERIOD", routeDrainPeriodEnv), zap.Error(err))
+			options.RouteDrainPeriod = routeDrainPeriodFlag
+		} else {
+			options.RouteDrainPeriod = p
+		}
+	} else {
+		options.RouteDrainPeriod = routeDrainPeriodFlag
+	}
+
+	if eventsRetryBaseEnv := os.Getenv("CADDY_DOCKER_EVENTS_RETRY_BASE"); eventsRetryBaseEnv != "" {
+		if p, err := time.ParseDuration(eventsRetryBaseEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_EVENTS_RETRY_BASE", zap.String("CADDY_DOCKER_EVENTS_RETRY_BASE", eventsRetryBaseEnv), zap.Error(err))
+			options.EventsRetryBase = eventsRetryBaseFlag
+		} else {
+			options.EventsRetryBase = p
+		}
+	} else {
+		options.EventsRetryBase = eventsRetryBaseFlag
+	}
+
+	if eventsRetryMaxEnv := os.Getenv("CADDY_DOCKER_EVENTS_RETRY_MAX"); eventsRetryMaxEnv != "" {
+		if p, err := time.ParseDuration(eventsRetryMaxEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_EVENTS_RETRY_MAX", zap.String("CADDY_DOCKER_EVENTS_RETRY_MAX", eventsRetryMaxEnv), zap.Error(err))
+			options.EventsRetryMax = eventsRetryMaxFlag
+		} else {
+			options.EventsRetryMax = p
+		}
+	} else {
+		options.EventsRetryMax = eventsRetryMaxFlag
+	}
+
+	if eventsRetryResetAfterEnv := os.Getenv("CADDY_DOCKER_EVENTS_RETRY_RESET_AFTER"); eventsRetryResetAfterEnv != "" {
+		if p, err := time.ParseDuration(eventsRetryResetAfterEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_EVENTS_RETRY_RESET_AFTER", zap.String("CADDY_DOCKER_EVENTS_RETRY_RESET_AFTER", eventsRetryResetAfterEnv), zap.Error(err))
+			options.EventsRetryResetAfter = eventsRetryResetAfterFlag
+		} else {
+			options.EventsRetryResetAfter = p
+		}
+	} else {
+		options.EventsRetryResetAfter = eventsRetryResetAfterFlag
+	}
+
+	var adminScheme string
+	if adminSchemeEnv := os.Getenv("CADDY_DOCKER_ADMIN_SCHEME"); adminSchemeEnv != "" {
+		adminScheme = adminSchemeEnv
+	} else {
+		adminScheme = adminSchemeFlag
+	}
+	switch adminScheme {
+	case "", config.AdminSchemeHTTP, config.AdminSchemeHTTPS:
+		options.AdminScheme = adminScheme
+	default:
+		log.Error("Invalid admin-scheme", zap.String("admin-scheme", adminScheme))
+	}
+
+	if adminCACertEnv := os.Getenv("CADDY_DOCKER_ADMIN_CA_CERT"); adminCACertEnv != "" {
+		options.AdminCACert = adminCACertEnv
+	} else {
+		options.AdminCACert = adminCACertFlag
+	}
+
+	if adminClientCertEnv := os.Getenv("CADDY_DOCKER_ADMIN_CLIENT_CERT"); adminClientCertEnv != "" {
+		options.AdminClientCert = adminClientCertEnv
+	} else {
+		options.AdminClientCert = adminClientCertFlag
+	}
+
+	if adminClientKeyEnv := os.Getenv("CADDY_DOCKER_ADMIN_CLIENT_KEY"); adminClientKeyEnv != "" {
+		options.AdminClientKey = adminClientKeyEnv
+	} else {
+		options.AdminClientKey = adminClientKeyFlag
+	}
+
+	if adminPortEnv := os.Getenv("CADDY_DOCKER_ADMIN_PORT"); adminPortEnv != "" {
+		if p, err := strconv.Atoi(adminPortEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_ADMIN_PORT", zap.String("CADDY_DOCKER_ADMIN_PORT", adminPortEnv), zap.Error(err))
+			options.AdminPort = adminPortFlag
+		} else {
+			options.AdminPort = p
+		}
+	} else {
+		options.AdminPort = adminPortFlag
+	}
+
+	if pushRetryAttemptsEnv := os.Getenv("CADDY_DOCKER_PUSH_RETRY_ATTEMPTS"); pushRetryAttemptsEnv != "" {
+		if p, err := strconv.Atoi(pushRetryAttemptsEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_PUSH_RETRY_ATTEMPTS", zap.String("CADDY_DOCKER_PUSH_RETRY_ATTEMPTS", pushRetryAttemptsEnv), zap.Error(err))
+			options.PushRetryAttempts = pushRetryAttemptsFlag
+		} else {
+			options.PushRetryAttempts = p
+		}
+	} else {
+		options.PushRetryAttempts = pushRetryAttemptsFlag
+	}
+
+	if pushRetryDelayEnv := os.Getenv("CADDY_DOCKER_PUSH_RETRY_DELAY"); pushRetryDelayEnv != "" {
+		if p, err := time.ParseDuration(pushRetryDelayEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_PUSH_RETRY_DELAY", zap.String("CADDY_DOCKER_PUSH_RETRY_DELAY", pushRetryDelayEnv), zap.Error(err))
+			options.PushRetryDelay = pushRetryDelayFlag
+		} else {
+			options.PushRetryDelay = p
+		}
+	} else {
+		options.PushRetryDelay = pushRetryDelayFlag
+	}
+
+	if pushTimeoutEnv := os.Getenv("CADDY_DOCKER_PUSH_TIMEOUT"); pushTimeoutEnv != "" {
+		if p, err := time.ParseDuration(pushTimeoutEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_PUSH_TIMEOUT", zap.String("CADDY_DOCKER_PUSH_TIMEOUT", pushTimeoutEnv), zap.Error(err))
+			options.PushTimeout = pushTimeoutFlag
+		} else {
+			options.PushTimeout = p
+		}
+	} else {
+		options.PushTimeout = pushTimeoutFlag
+	}
+
+	if adminRequestTimeoutEnv := os.Getenv("CADDY_DOCKER_ADMIN_REQUEST_TIMEOUT"); adminRequestTimeoutEnv != "" {
+		if p, err := time.ParseDuration(adminRequestTimeoutEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_ADMIN_REQUEST_TIMEOUT", zap.String("CADDY_DOCKER_ADMIN_REQUEST_TIMEOUT", adminRequestTimeoutEnv), zap.Error(err))
+			options.AdminRequestTimeout = adminRequestTimeoutFlag
+		} else {
+			options.AdminRequestTimeout = p
+		}
+	} else {
+		options.AdminRequestTimeout = adminRequestTimeoutFlag
+	}
+
+	if eventDebounceMaxWaitEnv := os.Getenv("CADDY_DOCKER_EVENT_DEBOUNCE_MAX_WAIT"); eventDebounceMaxWaitEnv != "" {
+		if p, err := time.ParseDuration(eventDebounceMaxWaitEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_EVENT_DEBOUNCE_MAX_WAIT", zap.String("CADDY_DOCKER_EVENT_DEBOUNCE_MAX_WAIT", eventDebounceMaxWaitEnv), zap.Error(err))
+			options.EventDebounceMaxWait = eventDebounceMaxWaitFlag
+		} else {
+			options.EventDebounceMaxWait = p
+		}
+	} else {
+		options.EventDebounceMaxWait = eventDebounceMaxWaitFlag
+	}
+
+	if caddyfileDumpPathEnv := os.Getenv("CADDY_DOCKER_CADDYFILE_DUMP_PATH"); caddyfileDumpPathEnv != "" {
+		options.CaddyfileDumpPath = caddyfileDumpPathEnv
+	} else {
+		options.CaddyfileDumpPath = caddyfileDumpPathFlag
+	}
+
+	if validateBeforePushEnv := os.Getenv("CADDY_DOCKER_VALIDATE_BEFORE_PUSH"); validateBeforePushEnv != "" {
+		options.ValidateBeforePush = isTrue.MatchString(validateBeforePushEnv)
+	} else {
+		options.ValidateBeforePush = validateBeforePushFlag
+	}
+
+	if pushConcurrencyEnv := os.Getenv("CADDY_DOCKER_PUSH_CONCURRENCY"); pushConcurrencyEnv != "" {
+		if p, err := strconv.Atoi(pushConcurrencyEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_PUSH_CONCURRENCY", zap.String("CADDY_DOCKER_PUSH_CONCURRENCY", pushConcurrencyEnv), zap.Error(err))
+			options.PushConcurrency = pushConcurrencyFlag
+		} else {
+			options.PushConcurrency = p
+		}
+	} else {
+		options.PushConcurrency = pushConcurrencyFlag
+	}
+
+	if dockerHostEnv := os.Getenv("CADDY_DOCKER_HOST"); dockerHostEnv != "" {
+		options.DockerHost = dockerHostEnv
+	} else {
+		options.DockerHost = dockerHostFlag
+	}
+
+	if eventScopesEnv := os.Getenv("CADDY_DOCKER_EVENT_SCOPES"); eventScopesEnv != "" {
+		options.EventScopes = strings.Split(eventScopesEnv, ",")
+	} else if eventScopesFlag != "" {
+		options.EventScopes = strings.Split(eventScopesFlag, ",")
+	}
+
+	if eventTypesEnv := os.Getenv("CADDY_DOCKER_EVENT_TYPES"); eventTypesEnv != "" {
+		options.EventTypes = strings.Split(eventTypesEnv, ",")
+	} else if eventTypesFlag != "" {
+		options.EventTypes = strings.Split(eventTypesFlag, ",")
+	}
+
+	if eventActionsEnv := os.Getenv("CADDY_DOCKER_EVENT_ACTIONS"); eventActionsEnv != "" {
+		options.EventActions = parseEventActions(log, "CADDY_DOCKER_EVENT_ACTIONS", eventActionsEnv)
+	} else if eventActionsFlag != "" {
+		options.EventActions = parseEventActions(log, "event-actions", eventActionsFlag)
+	}
+
+	if redactDirectivesEnv := os.Getenv("CADDY_DOCKER_REDACT_DIRECTIVES"); redactDirectivesEnv != "" {
+		options.RedactDirectives = strings.Split(redactDirectivesEnv, ",")
+	} else if redactDirectivesFlag != "" {
+		options.RedactDirectives = strings.Split(redactDirectivesFlag, ",")
+	}
+
+	if eventsMaxFailuresEnv := os.Getenv("CADDY_DOCKER_EVENTS_MAX_FAILURES"); eventsMaxFailuresEnv != "" {
+		if p, err := strconv.Atoi(eventsMaxFailuresEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_EVENTS_MAX_FAILURES", zap.String("CADDY_DOCKER_EVENTS_MAX_FAILURES", eventsMaxFailuresEnv), zap.Error(err))
+			options.EventsMaxFailures = eventsMaxFailuresFlag
+		} else {
+			options.EventsMaxFailures = p
+		}
+	} else {
+		options.EventsMaxFailures = eventsMaxFailuresFlag
+	}
+
+	if eventsStopOnMaxFailuresEnv := os.Getenv("CADDY_DOCKER_EVENTS_STOP_ON_MAX_FAILURES"); eventsStopOnMaxFailuresEnv != "" {
+		options.EventsStopOnMaxFailures = isTrue.MatchString(eventsStopOnMaxFailuresEnv)
+	} else {
+		options.EventsStopOnMaxFailures = eventsStopOnMaxFailuresFlag
+	}
+
+	if extraLabelPrefixesEnv := os.Getenv("CADDY_DOCKER_EXTRA_LABEL_PREFIXES"); extraLabelPrefixesEnv != "" {
+		options.ExtraLabelPrefixes = strings.Split(extraLabelPrefixesEnv, ",")
+	} else if extraLabelPrefixesFlag != "" {
+		options.ExtraLabelPrefixes = strings.Split(extraLabelPrefixesFlag, ",")
+	}
+
+	if scanFiltersEnv := os.Getenv("CADDY_DOCKER_SCAN_FILTERS"); scanFiltersEnv != "" {
+		options.ScanFilters = parseScanFilters(log, "CADDY_DOCKER_SCAN_FILTERS", scanFiltersEnv)
+	} else if scanFiltersFlag != "" {
+		options.ScanFilters = parseScanFilters(log, "scan-filters", scanFiltersFlag)
+	}
+
+	if pushWebhookURLEnv := os.Getenv("CADDY_DOCKER_PUSH_WEBHOOK_URL"); pushWebhookURLEnv != "" {
+		options.PushWebhookURL = pushWebhookURLEnv
+	} else {
+		options.PushWebhookURL = pushWebhookURLFlag
+	}
+
+	if pushWebhookOnSuccessEnv := os.Getenv("CADDY_DOCKER_PUSH_WEBHOOK_ON_SUCCESS"); pushWebhookOnSuccessEnv != "" {
+		options.PushWebhookOnSuccess = isTrue.MatchString(pushWebhookOnSuccessEnv)
+	} else {
+		options.PushWebhookOnSuccess = pushWebhookOnSuccessFlag
+	}
+
+	if pushWebhookTimeoutEnv := os.Getenv("CADDY_DOCKER_PUSH_WEBHOOK_TIMEOUT"); pushWebhookTimeoutEnv != "" {
+		if p, err := time.ParseDuration(pushWebhookTimeoutEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_PUSH_WEBHOOK_TIMEOUT", zap.String("CADDY_DOCKER_PUSH_WEBHOOK_TIMEOUT", pushWebhookTimeoutEnv), zap.Error(err))
+			options.PushWebhookTimeout = pushWebhookTimeoutFlag
+		} else {
+			options.PushWebhookTimeout = p
+		}
+	} else {
+		options.PushWebhookTimeout = pushWebhookTimeoutFlag
+	}
+
+	if maxPollingIntervalEnv := os.Getenv("CADDY_DOCKER_MAX_POLLING_INTERVAL"); maxPollingIntervalEnv != "" {
+		if p, err := time.ParseDuration(maxPollingIntervalEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_MAX_POLLING_INTERVAL", zap.String("CADDY_DOCKER_MAX_POLLING_INTERVAL", maxPollingIntervalEnv), zap.Error(err))
+			options.MaxPollingInterval = maxPollingIntervalFlag
+		} else {
+			options.MaxPollingInterval = p
+		}
+	} else {
+		options.MaxPollingInterval = maxPollingIntervalFlag
+	}
+
+	if generationTimeoutEnv := os.Getenv("CADDY_DOCKER_GENERATION_TIMEOUT"); generationTimeoutEnv != "" {
+		if p, err := time.ParseDuration(generationTimeoutEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_GENERATION_TIMEOUT", zap.String("CADDY_DOCKER_GENERATION_TIMEOUT", generationTimeoutEnv), zap.Error(err))
+			options.GenerationTimeout = generationTimeoutFlag
+		} else {
+			options.GenerationTimeout = p
+		}
+	} else {
+		options.GenerationTimeout = generationTimeoutFlag
+	}
+
+	if excludedServersEnv := os.Getenv("CADDY_DOCKER_EXCLUDED_SERVERS"); excludedServersEnv != "" {
+		options.ExcludedServers = parseServerPatterns(log, "CADDY_DOCKER_EXCLUDED_SERVERS", excludedServersEnv)
+	} else if excludedServersFlag != "" {
+		options.ExcludedServers = parseServerPatterns(log, "excluded-servers", excludedServersFlag)
+	}
+
+	if leaderLockEnv := os.Getenv("CADDY_DOCKER_LEADER_LOCK"); leaderLockEnv != "" {
+		options.LeaderLock = leaderLockEnv
+	} else {
+		options.LeaderLock = leaderLockFlag
+	}
+
+	if leaderLeaseDurationEnv := os.Getenv("CADDY_DOCKER_LEADER_LEASE_DURATION"); leaderLeaseDurationEnv != "" {
+		if p, err := time.ParseDuration(leaderLeaseDurationEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_LEADER_LEASE_DURATION", zap.String("CADDY_DOCKER_LEADER_LEASE_DURATION", leaderLeaseDurationEnv), zap.Error(err))
+			options.LeaderLeaseDuration = leaderLeaseDurationFlag
+		} else {
+			options.LeaderLeaseDuration = p
+		}
+	} else {
+		options.LeaderLeaseDuration = leaderLeaseDurationFlag
+	}
+	if options.LeaderLeaseDuration <= 0 {
+		log.Error("Leader lease duration must be positive, using default", zap.Duration("LeaderLeaseDuration", options.LeaderLeaseDuration))
+		options.LeaderLeaseDuration = 30 * time.Second
+	}
+
+	if breakerThresholdEnv := os.Getenv("CADDY_DOCKER_BREAKER_THRESHOLD"); breakerThresholdEnv != "" {
+		if p, err := strconv.Atoi(breakerThresholdEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_BREAKER_THRESHOLD", zap.String("CADDY_DOCKER_BREAKER_THRESHOLD", breakerThresholdEnv), zap.Error(err))
+			options.BreakerThreshold = breakerThresholdFlag
+		} else {
+			options.BreakerThreshold = p
+		}
+	} else {
+		options.BreakerThreshold = breakerThresholdFlag
+	}
+
+	if breakerCooldownEnv := os.Getenv("CADDY_DOCKER_BREAKER_COOLDOWN"); breakerCooldownEnv != "" {
+		if p, err := time.ParseDuration(breakerCooldownEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_BREAKER_COOLDOWN", zap.String("CADDY_DOCKER_BREAKER_COOLDOWN", breakerCooldownEnv), zap.Error(err))
+			options.BreakerCooldown = breakerCooldownFlag
+		} else {
+			options.BreakerCooldown = p
+		}
+	} else {
+		options.BreakerCooldown = breakerCooldownFlag
+	}
+
+	if compressConfigPushEnv := os.Getenv("CADDY_DOCKER_COMPRESS_CONFIG_PUSH"); compressConfigPushEnv != "" {
+		options.CompressConfigPush = isTrue.MatchString(compressConfigPushEnv)
+	} else {
+		options.CompressConfigPush = compressConfigPushFlag
+	}
+
+	if adminAuthUserEnv := os.Getenv("CADDY_DOCKER_ADMIN_AUTH_USER"); adminAuthUserEnv != "" {
+		options.AdminAuthUser = adminAuthUserEnv
+	} else {
+		options.AdminAuthUser = adminAuthUserFlag
+	}
+
+	if adminAuthPasswordEnv := os.Getenv("CADDY_DOCKER_ADMIN_AUTH_PASSWORD"); adminAuthPasswordEnv != "" {
+		options.AdminAuthPassword = adminAuthPasswordEnv
+	} else {
+		options.AdminAuthPassword = adminAuthPasswordFlag
+	}
+
+	if adminAuthTokenEnv := os.Getenv("CADDY_DOCKER_ADMIN_AUTH_TOKEN"); adminAuthTokenEnv != "" {
+		options.AdminAuthToken = adminAuthTokenEnv
+	} else {
+		options.AdminAuthToken = adminAuthTokenFlag
+	}
+	if options.AdminAuthToken != "" && options.AdminAuthUser != "" {
+		log.Warn("Both admin auth token and user are set, sending the token")
+	}
+
+	if conditionalPushEnv := os.Getenv("CADDY_DOCKER_CONDITIONAL_PUSH"); conditionalPushEnv != "" {
+		options.ConditionalPush = isTrue.MatchString(conditionalPushEnv)
+	} else {
+		options.ConditionalPush = conditionalPushFlag
+	}
+
+	if caddyfileExpandEnvEnv := os.Getenv("CADDY_DOCKER_CADDYFILE_EXPAND_ENV"); caddyfileExpandEnvEnv != "" {
+		options.ExpandCaddyfileEnv = isTrue.MatchString(caddyfileExpandEnvEnv)
+	} else {
+		options.ExpandCaddyfileEnv = caddyfileExpandEnvFlag
+	}
+
+	if pollingJitterEnv := os.Getenv("CADDY_DOCKER_POLLING_JITTER"); pollingJitterEnv != "" {
+		if p, err := strconv.Atoi(pollingJitterEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_POLLING_JITTER", zap.String("CADDY_DOCKER_POLLING_JITTER", pollingJitterEnv), zap.Error(err))
+			options.PollingJitter = pollingJitterFlag
+		} else {
+			options.PollingJitter = p
+		}
+	} else {
+		options.PollingJitter = pollingJitterFlag
+	}
+	if options.PollingJitter < 0 || options.PollingJitter > 100 {
+		log.Error("Polling jitter must be a percentage between 0 and 100, disabling it", zap.Int("PollingJitter", options.PollingJitter))
+		options.PollingJitter = 0
+	}
+
+	if fallbackToEnvEnv := os.Getenv("CADDY_DOCKER_FALLBACK_TO_ENV"); fallbackToEnvEnv != "" {
+		options.FallbackToEnv = isTrue.MatchString(fallbackToEnvEnv)
+	} else {
+		options.FallbackToEnv = fallbackToEnvFlag
+	}
+
+	if adminLoadPathEnv := os.Getenv("CADDY_DOCKER_ADMIN_LOAD_PATH"); adminLoadPathEnv != "" {
+		options.AdminLoadPath = adminLoadPathEnv
+	} else {
+		options.AdminLoadPath = adminLoadPathFlag
+	}
+
+	if adminLoadMethodEnv := os.Getenv("CADDY_DOCKER_ADMIN_LOAD_METHOD"); adminLoadMethodEnv != "" {
+		options.AdminLoadMethod = strings.ToUpper(adminLoadMethodEnv)
+	} else {
+		options.AdminLoadMethod = strings.ToUpper(adminLoadMethodFlag)
+	}
+
+	if serversSRVEnv := os.Getenv("CADDY_DOCKER_SERVERS_SRV"); serversSRVEnv != "" {
+		options.ServersSRV = serversSRVEnv
+	} else {
+		options.ServersSRV = serversSRVFlag
+	}
+
+	var serversSRVMode string
+	if serversSRVModeEnv := os.Getenv("CADDY_DOCKER_SERVERS_SRV_MODE"); serversSRVModeEnv != "" {
+		serversSRVMode = serversSRVModeEnv
+	} else {
+		serversSRVMode = serversSRVModeFlag
+	}
+	switch serversSRVMode {
+	case "", config.ServersSRVMerge, config.ServersSRVReplace:
+		options.ServersSRVMode = serversSRVMode
+	default:
+		log.Error("Invalid servers-srv-mode", zap.String("servers-srv-mode", serversSRVMode))
+	}
+
+	if minUpdateIntervalEnv := os.Getenv("CADDY_DOCKER_MIN_UPDATE_INTERVAL"); minUpdateIntervalEnv != "" {
+		if p, err := time.ParseDuration(minUpdateIntervalEnv); err != nil {
+			log.Error("Failed to parse CADDY_DOCKER_MIN_UPDATE_INTERVAL", zap.String("CADDY_DOCKER_MIN_UPDATE_INTERVAL", minUpdateIntervalEnv), zap.Error(err))
+			options.MinUpdateInterval = minUpdateIntervalFlag
+		} else {
+			options.MinUpdateInterval = p
+		}
+	} else {
+		options.MinUpdateInterval = minUpdateIntervalFlag
+	}
+
+	return options, nil
+}
+
+// parseEventActions parses comma separated type:action pairs of docker events
+func parseEventActions(log *zap.Logger, name string, value string) []string {
+	actions := []string{}
+	for _, typeAction := range strings.Split(value, ",") {
+		typeAction = strings.TrimSpace(typeAction)
+		if eventType, action, found := strings.Cut(typeAction, ":"); !found || eventType == "" || action == "" {
+			log.Error("Failed to parse "+name+", expected type:action", zap.String(name, typeAction))
+			continue
+		}
+		actions = append(actions, typeAction)
+	}
+	return actions
+}
+
+// parseScanFilters parses comma separated key=value Docker API filters
+func parseScanFilters(log *zap.Logger, name string, value string) []string {
+	scanFilters := []string{}
+	for _, filter := range strings.Split(value, ",") {
+		filter = strings.TrimSpace(filter)
+		if key, filterValue, found := strings.Cut(filter, "="); !found || key == "" || filterValue == "" {
+			log.Error("Failed to parse "+name+", expected key=value", zap.String(name, filter))
+			continue
+		}
+		scanFilters = append(scanFilters, filter)
+	}
+	return scanFilters
+}
+
+// parseServerPatterns parses comma separated server names or glob patterns, logging and
+// ignoring invalid patterns
+func parseServerPatterns(log *zap.Logger, name string, value string) []string {
+	patterns := []string{}
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			log.Error("Failed to parse "+name+", expected a server name or glob pattern", zap.String(name, pattern))
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// parseHostnamePatterns compiles comma separated regular expressions matching whole hostnames,
+// ignoring empty ones. It fails on invalid expressions, or when there is no expression
+func parseHostnamePatterns(name string, value string) ([]*regexp.Regexp, error) {
+	patterns := []*regexp.Regexp{}
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		compiled, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s pattern %q: %w", name, pattern, err)
+		}
+		patterns = append(patterns, compiled)
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("%s has no pattern", name)
+	}
+	return patterns, nil
 }
@@ -0,0 +1,28 @@
+package caddydockerproxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHostnamePatterns(t *testing.T) {
+	patterns, err := parseHostnamePatterns("hostname-allowlist", `[a-z]+\.example\.com, ,internal,`)
+	assert.NoError(t, err)
+	assert.Len(t, patterns, 2)
+	assert.True(t, patterns[0].MatchString("app.example.com"))
+	assert.False(t, patterns[0].MatchString("app.example.com.evil"))
+	assert.True(t, patterns[1].MatchString("internal"))
+	for _, pattern := range patterns {
+		assert.False(t, pattern.MatchString(""))
+	}
+}
+
+func TestParseHostnamePatterns_Invalid(t *testing.T) {
+	patterns, err := parseHostnamePatterns("hostname-allowlist", `internal,[a-z+\.example\.com`)
+	assert.ErrorContains(t, err, `parsing hostname-allowlist pattern "[a-z+\\.example\\.com"`)
+	assert.Nil(t, patterns)
+
+	_, err = parseHostnamePatterns("hostname-allowlist", ", ,")
+	assert.ErrorContains(t, err, "hostname-allowlist has no pattern")
+}
@@ -2,29 +2,169 @@ package config
 
 import (
 	"net"
+	"regexp"
 	"time"
 )
 
 // Options are the options for generator
 type Options struct {
-	CaddyfilePath          string
-	EnvFile                string
-	DockerSockets          []string
-	DockerCertsPath        []string
-	DockerAPIsVersion      []string
-	LabelPrefix            string
-	ControlledServersLabel string
-	ProxyServiceTasks      bool
-	ProcessCaddyfile       bool
-	ScanStoppedContainers  bool
-	PollingInterval        time.Duration
-	EventThrottleInterval  time.Duration
-	Mode                   Mode
-	Secret                 string
-	ControllerNetwork      *net.IPNet
-	IngressNetworks        []string
+	CaddyfilePath                  string
+	EnvFile                        string
+	DockerSockets                  []string
+	DockerCertsPath                []string
+	DockerAPIsVersion              []string
+	LabelPrefix                    string
+	ControlledServersLabel         string
+	ProxyServiceTasks              bool
+	ProcessCaddyfile               bool
+	ScanStoppedContainers          bool
+	PollingInterval                time.Duration
+	EventThrottleInterval          time.Duration
+	Mode                           Mode
+	Secret                         string
+	ControllerNetwork              *net.IPNet
+	IngressNetworks                []string
+	DebugCaddyfileLogging          bool
+	ExtraRouteSources              []string
+	RouteRemovalGrace              time.Duration
+	VerifyAfterPush                bool
+	NewHostRateLimit               int
+	NewHostRateWindow              time.Duration
+	PushSourceAddr                 net.IP
+	HTTPOnlyReload                 bool
+	TerminalRoutes                 bool
+	PushWaveSize                   int
+	PushWaveDelay                  time.Duration
+	FailOnRouteCollision           bool
+	ResolveHostModeUpstreams       bool
+	InventoryPath                  string
+	OnNoExposedPorts               string
+	NoExposedPortsDefaultPort      int
+	EmptyBootRetries               int
+	EmptyBootRetryInterval         time.Duration
+	NamespaceMatchers              bool
+	GlobalSitePrelude              string
+	GlobalSitePostlude             string
+	ConfirmWithHealthProbe         bool
+	HealthProbeURL                 string
+	HealthProbeTimeout             time.Duration
+	TLSConflictPolicy              string
+	AccessLogFormat                string
+	AccessLogOmitFields            []string
+	ConfigDiffSummary              bool
+	InspectCacheTTL                time.Duration
+	InspectConcurrency             int
+	HostnameAllowlist              []*regexp.Regexp
+	TolerateDockerPermissionErrors bool
+	PublishedPortStrategy          string
+	AutoHSTS                       bool
+	ReconcileCron                  string
+	// ServerHeader replaces the Server response header of all sites, or removes it when empty.
+	// When nil, the header is left unchanged
+	ServerHeader            *string
+	RouteDrainPeriod        time.Duration
+	EventsRetryBase         time.Duration
+	EventsRetryMax          time.Duration
+	EventsRetryResetAfter   time.Duration
+	AdminScheme             string
+	AdminCACert             string
+	AdminClientCert         string
+	AdminClientKey          string
+	AdminPort               int
+	PushRetryAttempts       int
+	PushRetryDelay          time.Duration
+	PushTimeout             time.Duration
+	AdminRequestTimeout     time.Duration
+	EventDebounceMaxWait    time.Duration
+	CaddyfileDumpPath       string
+	ValidateBeforePush      bool
+	PushConcurrency         int
+	DockerHost              string
+	EventScopes             []string
+	EventTypes              []string
+	EventActions            []string
+	RedactDirectives        []string
+	EventsMaxFailures       int
+	EventsStopOnMaxFailures bool
+	ExtraLabelPrefixes      []string
+	ScanFilters             []string
+	PushWebhookURL          string
+	PushWebhookOnSuccess    bool
+	PushWebhookTimeout      time.Duration
+	MaxPollingInterval      time.Duration
+	GenerationTimeout       time.Duration
+	ExcludedServers         []string
+	LeaderLock              string
+	LeaderLeaseDuration     time.Duration
+	BreakerThreshold        int
+	BreakerCooldown         time.Duration
+	CompressConfigPush      bool
+	AdminAuthUser           string
+	AdminAuthPassword       string
+	AdminAuthToken          string
+	ConditionalPush         bool
+	ExpandCaddyfileEnv      bool
+	PollingJitter           int
+	FallbackToEnv           bool
+	AdminLoadPath           string
+	AdminLoadMethod         string
+	ServersSRV              string
+	ServersSRVMode          string
+	MinUpdateInterval       time.Duration
 }
 
+// Policies for containers exposing no ports, used by OnNoExposedPorts.
+// When empty, upstreams are generated without port
+const (
+	// NoExposedPortsSkip ignores the container and logs a warning
+	NoExposedPortsSkip = "skip"
+	// NoExposedPortsError ignores the container and logs an error
+	NoExposedPortsError = "error"
+	// NoExposedPortsDefaultPort uses NoExposedPortsDefaultPort as upstreams port
+	NoExposedPortsDefaultPort = "default-port"
+)
+
+// Policies for sites getting different tls directives from different containers or services,
+// used by TLSConflictPolicy. When empty, the first one wins
+const (
+	// TLSConflictFirstWins keeps the tls directive of the first container or service
+	TLSConflictFirstWins = "first-wins"
+	// TLSConflictError ignores the later container or service and logs an error
+	TLSConflictError = "error"
+	// TLSConflictMostSpecificWins keeps the tls directive with more arguments and settings
+	TLSConflictMostSpecificWins = "most-specific-wins"
+)
+
+// Strategies for selecting the port of services publishing multiple ports in host mode,
+// used by PublishedPortStrategy. When empty, the first declared port is selected
+const (
+	// PublishedPortFirstDeclared selects the first port declared by the service
+	PublishedPortFirstDeclared = "first-declared"
+	// PublishedPortLowest selects the lowest published port
+	PublishedPortLowest = "lowest"
+	// PublishedPortTargetMatchesLabel selects the port published for the target port in
+	// label caddy_target_port, falling back to the first declared port
+	PublishedPortTargetMatchesLabel = "target-matches-label"
+)
+
+// Schemes of the admin endpoint of servers, used by AdminScheme. When empty, plain HTTP is used
+const (
+	// AdminSchemeHTTP pushes configurations to servers over plain HTTP
+	AdminSchemeHTTP = "http"
+	// AdminSchemeHTTPS pushes configurations to servers over HTTPS, authenticating the
+	// controller with a client certificate
+	AdminSchemeHTTPS = "https"
+)
+
+// How servers discovered through the SRV record of ServersSRV are combined with the servers
+// found by the generator, used by ServersSRVMode. When empty, they are merged
+const (
+	// ServersSRVMerge pushes configurations to servers found by the generator and SRV targets
+	ServersSRVMerge = "merge"
+	// ServersSRVReplace pushes configurations only to SRV targets
+	ServersSRVReplace = "replace"
+)
+
 // Mode represents how this instance should run
 type Mode int
 
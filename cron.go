@@ -0,0 +1,143 @@
+package caddydockerproxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression with fields minute, hour, day of month, month
+// and day of week, optionally preceded by a seconds field
+type cronSchedule struct {
+	seconds     uint64
+	minutes     uint64
+	hours       uint64
+	daysOfMonth uint64
+	months      uint64
+	daysOfWeek  uint64
+	// anyDay is true when day of month or day of week is *, requiring both to match.
+	// Otherwise matching any of them is enough, as in standard cron
+	anyDay bool
+}
+
+// parseCronSchedule parses expressions like "0 3 * * *" or, with seconds, "*/10 * * * * *".
+// Fields support *, values, ranges and steps, separated by commas
+func parseCronSchedule(expression string) (*cronSchedule, error) {
+	fields := strings.Fields(expression)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("expected 5 or 6 fields in cron expression %q, got %d", expression, len(fields))
+	}
+
+	schedule := &cronSchedule{
+		anyDay: strings.HasPrefix(fields[3], "*") || strings.HasPrefix(fields[5], "*"),
+	}
+	var err error
+	if schedule.seconds, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if schedule.minutes, err = parseCronField(fields[1], 0, 59); err != nil {
+		return nil, err
+	}
+	if schedule.hours, err = parseCronField(fields[2], 0, 23); err != nil {
+		return nil, err
+	}
+	if schedule.daysOfMonth, err = parseCronField(fields[3], 1, 31); err != nil {
+		return nil, err
+	}
+	if schedule.months, err = parseCronField(fields[4], 1, 12); err != nil {
+		return nil, err
+	}
+	if schedule.daysOfWeek, err = parseCronField(fields[5], 0, 7); err != nil {
+		return nil, err
+	}
+	// Both 0 and 7 are sunday
+	if schedule.daysOfWeek&(1<<7) != 0 {
+		schedule.daysOfWeek |= 1
+	}
+	return schedule, nil
+}
+
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangeSpec, step := item, 1
+		if index := strings.Index(item, "/"); index >= 0 {
+			rangeSpec = item[:index]
+			parsedStep, err := strconv.Atoi(item[index+1:])
+			if err != nil || parsedStep <= 0 {
+				return 0, fmt.Errorf("invalid step in cron field %q", field)
+			}
+			step = parsedStep
+		}
+
+		start, end := min, max
+		if rangeSpec != "*" {
+			startText, endText, isRange := strings.Cut(rangeSpec, "-")
+			var err error
+			if start, err = strconv.Atoi(startText); err != nil {
+				return 0, fmt.Errorf("invalid value in cron field %q", field)
+			}
+			if isRange {
+				if end, err = strconv.Atoi(endText); err != nil {
+					return 0, fmt.Errorf("invalid value in cron field %q", field)
+				}
+			} else if step == 1 {
+				end = start
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("value out of range %d-%d in cron field %q", min, max, field)
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+// next returns the first time after t matching the schedule, or zero time when
+// nothing matches within the next five years
+func (schedule *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Second).Add(time.Second)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if schedule.months&(1<<t.Month()) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !schedule.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if schedule.hours&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if schedule.minutes&(1<<t.Minute()) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		if schedule.seconds&(1<<t.Second()) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (schedule *cronSchedule) matchesDay(t time.Time) bool {
+	matchesDayOfMonth := schedule.daysOfMonth&(1<<t.Day()) != 0
+	matchesDayOfWeek := schedule.daysOfWeek&(1<<t.Weekday()) != 0
+	if schedule.anyDay {
+		return matchesDayOfMonth && matchesDayOfWeek
+	}
+	return matchesDayOfMonth || matchesDayOfWeek
+}
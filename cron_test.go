@@ -0,0 +1,98 @@
+package caddydockerproxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCronSchedule_Invalid(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		_, err := parseCronSchedule(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	from := time.Date(2024, 3, 15, 10, 20, 30, 500, time.UTC)
+	tests := []struct {
+		expression string
+		expected   time.Time
+	}{
+		{"* * * * * *", time.Date(2024, 3, 15, 10, 20, 31, 0, time.UTC)},
+		{"*/15 * * * * *", time.Date(2024, 3, 15, 10, 20, 45, 0, time.UTC)},
+		{"* * * * *", time.Date(2024, 3, 15, 10, 21, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 3, 16, 3, 0, 0, 0, time.UTC)},
+		{"30 9-17/4 * * *", time.Date(2024, 3, 15, 13, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 20 * 1", time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 1,7 *", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		schedule, err := parseCronSchedule(test.expression)
+		assert.NoError(t, err, test.expression)
+		assert.Equal(t, test.expected, schedule.next(from), test.expression)
+	}
+}
+
+func TestCronSchedule_NextNeverMatches(t *testing.T) {
+	schedule, err := parseCronSchedule("0 0 31 2 *")
+	assert.NoError(t, err)
+	assert.True(t, schedule.next(time.Now()).IsZero())
+}
+
+func TestRunReconcileSchedule_ForcesUpdate(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.ReconcileCron = "* * * * * *"
+	})
+	loader.update()
+	assert.Equal(t, int64(1), loader.lastVersion)
+
+	updated := make(chan time.Time, 1)
+	loader.timer.Stop()
+	loader.timer = time.AfterFunc(time.Hour, func() {
+		loader.update()
+		updated <- time.Now()
+	})
+
+	schedule, err := parseCronSchedule(loader.options.ReconcileCron)
+	assert.NoError(t, err)
+	scheduled := schedule.next(time.Now())
+	stop := make(chan struct{})
+	defer close(stop)
+	go loader.runReconcileSchedule(schedule, stop)
+
+	select {
+	case reconciledAt := <-updated:
+		assert.False(t, reconciledAt.Before(scheduled))
+		assert.Equal(t, int64(2), loader.lastVersion)
+		assert.False(t, loader.reconcileDue.Load())
+	case <-time.After(3 * time.Second):
+		assert.Fail(t, "Scheduled reconciliation didn't run")
+	}
+}
@@ -0,0 +1,44 @@
+package caddydockerproxy
+
+import (
+	"sync"
+	"time"
+)
+
+// eventsDebounce groups docker events arriving in bursts into a single update, triggered once
+// no event arrives for the quiet period, or maxWait after the first event of a continuous burst
+type eventsDebounce struct {
+	mutex        sync.Mutex
+	quiet        time.Duration
+	maxWait      time.Duration
+	pendingSince time.Time
+}
+
+func newEventsDebounce(quiet time.Duration, maxWait time.Duration) *eventsDebounce {
+	return &eventsDebounce{
+		quiet:   quiet,
+		maxWait: maxWait,
+	}
+}
+
+// delay records an event received at now, returning the delay until the update handling it
+func (debounce *eventsDebounce) delay(now time.Time) time.Duration {
+	debounce.mutex.Lock()
+	defer debounce.mutex.Unlock()
+
+	if debounce.pendingSince.IsZero() {
+		debounce.pendingSince = now
+	}
+	if debounce.maxWait <= 0 {
+		return debounce.quiet
+	}
+	return max(min(debounce.quiet, debounce.pendingSince.Add(debounce.maxWait).Sub(now)), 0)
+}
+
+// reset starts a new burst, called when an update starts handling the pending events
+func (debounce *eventsDebounce) reset() {
+	debounce.mutex.Lock()
+	defer debounce.mutex.Unlock()
+
+	debounce.pendingSince = time.Time{}
+}
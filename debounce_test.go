@@ -0,0 +1,38 @@
+package caddydockerproxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventsDebounce_QuietPeriod(t *testing.T) {
+	debounce := newEventsDebounce(100*time.Millisecond, time.Second)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 100*time.Millisecond, debounce.delay(start))
+	assert.Equal(t, 100*time.Millisecond, debounce.delay(start.Add(50*time.Millisecond)))
+	assert.Equal(t, 100*time.Millisecond, debounce.delay(start.Add(500*time.Millisecond)))
+}
+
+func TestEventsDebounce_MaxWait(t *testing.T) {
+	debounce := newEventsDebounce(100*time.Millisecond, time.Second)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	debounce.delay(start)
+	assert.Equal(t, 50*time.Millisecond, debounce.delay(start.Add(950*time.Millisecond)))
+	assert.Equal(t, time.Duration(0), debounce.delay(start.Add(1500*time.Millisecond)))
+
+	// An update handles the pending events, so the next event starts a new burst
+	debounce.reset()
+	assert.Equal(t, 100*time.Millisecond, debounce.delay(start.Add(1600*time.Millisecond)))
+}
+
+func TestEventsDebounce_NoMaxWait(t *testing.T) {
+	debounce := newEventsDebounce(100*time.Millisecond, 0)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	debounce.delay(start)
+	assert.Equal(t, 100*time.Millisecond, debounce.delay(start.Add(time.Hour)))
+}
@@ -20,6 +20,9 @@ type Client interface {
 	NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error)
 	ConfigList(ctx context.Context, options types.ConfigListOptions) ([]swarm.Config, error)
 	ConfigInspectWithRaw(ctx context.Context, id string) (swarm.Config, []byte, error)
+	ConfigCreate(ctx context.Context, config swarm.ConfigSpec) (types.ConfigCreateResponse, error)
+	ConfigUpdate(ctx context.Context, id string, version swarm.Version, config swarm.ConfigSpec) error
+	NodeInspectWithRaw(ctx context.Context, nodeID string) (swarm.Node, []byte, error)
 	Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error)
 }
 
@@ -70,6 +73,18 @@ func (wrapper *clientWrapper) ConfigInspectWithRaw(ctx context.Context, id strin
 	return wrapper.client.ConfigInspectWithRaw(ctx, id)
 }
 
+func (wrapper *clientWrapper) ConfigCreate(ctx context.Context, config swarm.ConfigSpec) (types.ConfigCreateResponse, error) {
+	return wrapper.client.ConfigCreate(ctx, config)
+}
+
+func (wrapper *clientWrapper) ConfigUpdate(ctx context.Context, id string, version swarm.Version, config swarm.ConfigSpec) error {
+	return wrapper.client.ConfigUpdate(ctx, id, version, config)
+}
+
+func (wrapper *clientWrapper) NodeInspectWithRaw(ctx context.Context, nodeID string) (swarm.Node, []byte, error) {
+	return wrapper.client.NodeInspectWithRaw(ctx, nodeID)
+}
+
 func (wrapper *clientWrapper) Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error) {
 	return wrapper.client.Events(ctx, options)
 }
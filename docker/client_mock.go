@@ -2,10 +2,12 @@ package docker
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
 )
 
 // ClientMock allows easily mocking of docker client data
@@ -14,22 +16,45 @@ type ClientMock struct {
 	ServicesData         []swarm.Service
 	ConfigsData          []swarm.Config
 	TasksData            []swarm.Task
+	NodesData            []swarm.Node
 	NetworksData         []types.NetworkResource
 	InfoData             types.Info
 	ContainerInspectData map[string]types.ContainerJSON
 	NetworkInspectData   map[string]types.NetworkResource
 	EventsChannel        chan events.Message
 	ErrorsChannel        chan error
+	ContainerListError   error
+	ServiceListError     error
+	ConfigListError      error
+	ConfigInspectError   error
 }
 
 // ContainerList list all containers
 func (mock *ClientMock) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
-	return mock.ContainersData, nil
+	if mock.ContainerListError != nil {
+		return nil, mock.ContainerListError
+	}
+	matchingContainers := []types.Container{}
+	for _, container := range mock.ContainersData {
+		if options.Filters.MatchKVList("label", container.Labels) {
+			matchingContainers = append(matchingContainers, container)
+		}
+	}
+	return matchingContainers, nil
 }
 
 // ServiceList list all services
 func (mock *ClientMock) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
-	return mock.ServicesData, nil
+	if mock.ServiceListError != nil {
+		return nil, mock.ServiceListError
+	}
+	matchingServices := []swarm.Service{}
+	for _, service := range mock.ServicesData {
+		if options.Filters.MatchKVList("label", service.Spec.Labels) {
+			matchingServices = append(matchingServices, service)
+		}
+	}
+	return matchingServices, nil
 }
 
 // TaskList list all tasks
@@ -49,6 +74,9 @@ func (mock *ClientMock) TaskList(ctx context.Context, options types.TaskListOpti
 
 // ConfigList list all configs
 func (mock *ClientMock) ConfigList(ctx context.Context, options types.ConfigListOptions) ([]swarm.Config, error) {
+	if mock.ConfigListError != nil {
+		return nil, mock.ConfigListError
+	}
 	return mock.ConfigsData, nil
 }
 
@@ -74,6 +102,9 @@ func (mock *ClientMock) NetworkInspect(ctx context.Context, networkID string, op
 
 // ConfigInspectWithRaw return sinformation about a specific config
 func (mock *ClientMock) ConfigInspectWithRaw(ctx context.Context, id string) (swarm.Config, []byte, error) {
+	if mock.ConfigInspectError != nil {
+		return swarm.Config{}, nil, mock.ConfigInspectError
+	}
 	for _, config := range mock.ConfigsData {
 		if config.ID == id {
 			return config, nil, nil
@@ -82,6 +113,48 @@ func (mock *ClientMock) ConfigInspectWithRaw(ctx context.Context, id string) (sw
 	return swarm.Config{}, nil, nil
 }
 
+// ConfigCreate creates a config, failing with a conflict when a config with the same name exists
+func (mock *ClientMock) ConfigCreate(ctx context.Context, config swarm.ConfigSpec) (types.ConfigCreateResponse, error) {
+	for _, existing := range mock.ConfigsData {
+		if existing.Spec.Name == config.Name {
+			return types.ConfigCreateResponse{}, errdefs.Conflict(fmt.Errorf("config %s already exists", config.Name))
+		}
+	}
+	id := fmt.Sprintf("CONFIG%d", len(mock.ConfigsData)+1)
+	mock.ConfigsData = append(mock.ConfigsData, swarm.Config{
+		ID:   id,
+		Meta: swarm.Meta{Version: swarm.Version{Index: 1}},
+		Spec: config,
+	})
+	return types.ConfigCreateResponse{ID: id}, nil
+}
+
+// ConfigUpdate updates a config, failing when version isn't its current version
+func (mock *ClientMock) ConfigUpdate(ctx context.Context, id string, version swarm.Version, config swarm.ConfigSpec) error {
+	for i, existing := range mock.ConfigsData {
+		if existing.ID != id {
+			continue
+		}
+		if existing.Version != version {
+			return fmt.Errorf("update out of sequence")
+		}
+		mock.ConfigsData[i].Version.Index++
+		mock.ConfigsData[i].Spec = config
+		return nil
+	}
+	return errdefs.NotFound(fmt.Errorf("config %s not found", id))
+}
+
+// NodeInspectWithRaw returns information about a specific node
+func (mock *ClientMock) NodeInspectWithRaw(ctx context.Context, nodeID string) (swarm.Node, []byte, error) {
+	for _, node := range mock.NodesData {
+		if node.ID == nodeID {
+			return node, nil, nil
+		}
+	}
+	return swarm.Node{}, nil, fmt.Errorf("node %s not found", nodeID)
+}
+
 // Events listen for events in docker
 func (mock *ClientMock) Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error) {
 	return mock.EventsChannel, mock.ErrorsChannel
@@ -0,0 +1,96 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// CycleCache is implemented by clients caching responses during a generation cycle
+type CycleCache interface {
+	// StartCycle drops responses cached during the previous cycle
+	StartCycle()
+}
+
+// CycleCacheClient caches successful inspect responses of a client until the next cycle starts,
+// so objects inspected several times during a generation are fetched once from the daemon
+type CycleCacheClient struct {
+	Client
+	mutex   sync.Mutex
+	entries map[string]interface{}
+}
+
+type rawResponse[T any] struct {
+	value T
+	raw   []byte
+}
+
+// WrapCycleCache creates a client caching inspect responses of client during a cycle
+func WrapCycleCache(client Client) *CycleCacheClient {
+	return &CycleCacheClient{
+		Client:  client,
+		entries: map[string]interface{}{},
+	}
+}
+
+// StartCycle drops responses cached during the previous cycle
+func (c *CycleCacheClient) StartCycle() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	clear(c.entries)
+}
+
+// ContainerInspect returns information about a specific container
+func (c *CycleCacheClient) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	return cycleCached(c, "container/"+containerID, func() (types.ContainerJSON, error) {
+		return c.Client.ContainerInspect(ctx, containerID)
+	})
+}
+
+// NetworkInspect returns information about a specific network
+func (c *CycleCacheClient) NetworkInspect(ctx context.Context, networkID string, options types.NetworkInspectOptions) (types.NetworkResource, error) {
+	key := fmt.Sprintf("network/%s/%s/%t", networkID, options.Scope, options.Verbose)
+	return cycleCached(c, key, func() (types.NetworkResource, error) {
+		return c.Client.NetworkInspect(ctx, networkID, options)
+	})
+}
+
+// ConfigInspectWithRaw returns information about a specific config
+func (c *CycleCacheClient) ConfigInspectWithRaw(ctx context.Context, id string) (swarm.Config, []byte, error) {
+	response, err := cycleCached(c, "config/"+id, func() (rawResponse[swarm.Config], error) {
+		config, raw, err := c.Client.ConfigInspectWithRaw(ctx, id)
+		return rawResponse[swarm.Config]{config, raw}, err
+	})
+	return response.value, response.raw, err
+}
+
+// NodeInspectWithRaw returns information about a specific node
+func (c *CycleCacheClient) NodeInspectWithRaw(ctx context.Context, nodeID string) (swarm.Node, []byte, error) {
+	response, err := cycleCached(c, "node/"+nodeID, func() (rawResponse[swarm.Node], error) {
+		node, raw, err := c.Client.NodeInspectWithRaw(ctx, nodeID)
+		return rawResponse[swarm.Node]{node, raw}, err
+	})
+	return response.value, response.raw, err
+}
+
+// cycleCached returns the response cached at key during the current cycle, or fetches and caches it.
+// Errors aren't cached, so failed calls are retried
+func cycleCached[T any](c *CycleCacheClient, key string, fetch func() (T, error)) (T, error) {
+	c.mutex.Lock()
+	entry, found := c.entries[key]
+	c.mutex.Unlock()
+	if found {
+		return entry.(T), nil
+	}
+
+	value, err := fetch()
+	if err == nil {
+		c.mutex.Lock()
+		c.entries[key] = value
+		c.mutex.Unlock()
+	}
+	return value, err
+}
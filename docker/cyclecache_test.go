@@ -0,0 +1,68 @@
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingClient struct {
+	Client
+	calls map[string]int
+}
+
+func (c *countingClient) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	c.calls["container/"+containerID]++
+	return c.Client.ContainerInspect(ctx, containerID)
+}
+
+func (c *countingClient) NodeInspectWithRaw(ctx context.Context, nodeID string) (swarm.Node, []byte, error) {
+	c.calls["node/"+nodeID]++
+	return c.Client.NodeInspectWithRaw(ctx, nodeID)
+}
+
+func TestCycleCache_CachesWithinCycle(t *testing.T) {
+	mock := &ClientMock{
+		ContainerInspectData: map[string]types.ContainerJSON{
+			"CONTAINER1": {ContainerJSONBase: &types.ContainerJSONBase{ID: "CONTAINER1"}},
+		},
+		NodesData: []swarm.Node{
+			{ID: "NODE1", Status: swarm.NodeStatus{Addr: "192.168.1.10"}},
+		},
+	}
+	counting := &countingClient{Client: mock, calls: map[string]int{}}
+	client := WrapCycleCache(counting)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		container, err := client.ContainerInspect(ctx, "CONTAINER1")
+		assert.NoError(t, err)
+		assert.Equal(t, "CONTAINER1", container.ID)
+
+		node, _, err := client.NodeInspectWithRaw(ctx, "NODE1")
+		assert.NoError(t, err)
+		assert.Equal(t, "192.168.1.10", node.Status.Addr)
+	}
+	assert.Equal(t, 1, counting.calls["container/CONTAINER1"])
+	assert.Equal(t, 1, counting.calls["node/NODE1"])
+
+	client.StartCycle()
+	_, _, err := client.NodeInspectWithRaw(ctx, "NODE1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, counting.calls["node/NODE1"])
+}
+
+func TestCycleCache_DoesNotCacheErrors(t *testing.T) {
+	counting := &countingClient{Client: &ClientMock{}, calls: map[string]int{}}
+	client := WrapCycleCache(counting)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, _, err := client.NodeInspectWithRaw(ctx, "MISSING")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 2, counting.calls["node/MISSING"])
+}
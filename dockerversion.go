@@ -0,0 +1,26 @@
+package caddydockerproxy
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/versions"
+)
+
+// minDockerAPIVersion is the oldest Docker API supported, the first one with swarm configs
+const minDockerAPIVersion = "1.30"
+
+// checkDockerAPIVersion fails when the API version of a Docker daemon, read from its ping, is older
+// than minDockerAPIVersion, instead of letting requests fail later during generation. The version
+// of the client isn't checked, as it isn't negotiated when pinned with DockerAPIsVersion
+func checkDockerAPIVersion(socket string, ping types.Ping) error {
+	version := ping.APIVersion
+	if version == "" {
+		// Daemons older than API 1.25 don't report their version, like for negotiation
+		version = "1.24"
+	}
+	if versions.LessThan(version, minDockerAPIVersion) {
+		return fmt.Errorf("docker daemon at %s supports API version %s, older than the minimum supported %s, upgrade docker", socket, version, minDockerAPIVersion)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package caddydockerproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCheckDockerAPIVersion(t *testing.T) {
+	assert.NoError(t, checkDockerAPIVersion("unix:///var/run/docker.sock", types.Ping{APIVersion: "1.44"}))
+	assert.NoError(t, checkDockerAPIVersion("unix:///var/run/docker.sock", types.Ping{APIVersion: "1.30"}))
+
+	err := checkDockerAPIVersion("unix:///var/run/docker.sock", types.Ping{APIVersion: "1.29"})
+	assert.EqualError(t, err, "docker daemon at unix:///var/run/docker.sock supports API version 1.29, older than the minimum supported 1.30, upgrade docker")
+
+	err = checkDockerAPIVersion("unix:///var/run/docker.sock", types.Ping{})
+	assert.EqualError(t, err, "docker daemon at unix:///var/run/docker.sock supports API version 1.24, older than the minimum supported 1.30, upgrade docker")
+}
+
+func TestConnect_PinnedClientVersionOldDaemon(t *testing.T) {
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.29")
+	}))
+	defer daemon.Close()
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("DOCKER_CERT_PATH", "")
+	t.Setenv("DOCKER_API_VERSION", "")
+
+	socket := "tcp://" + daemon.Listener.Addr().String()
+	loader := CreateDockerLoader(&config.Options{
+		DockerSockets:     []string{socket},
+		DockerAPIsVersion: []string{"1.44"},
+	})
+
+	err := loader.connect(zap.NewNop())
+	assert.EqualError(t, err, "docker daemon at "+socket+" supports API version 1.29, older than the minimum supported 1.30, upgrade docker")
+}
@@ -0,0 +1,190 @@
+package caddydockerproxy
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+)
+
+// maxRecentEvents bounds how many docker events are kept for debugging
+const maxRecentEvents = 20
+
+// defaultEventScopes are the scopes of docker events listened to when EventScopes is empty
+var defaultEventScopes = []string{"swarm", "local"}
+
+// defaultEventTypes are the types of docker events listened to when EventTypes is empty
+var defaultEventTypes = []string{"service", "container", "config", "node", "network"}
+
+// defaultEventActions are the type:action pairs of docker events triggering updates when EventActions is empty
+var defaultEventActions = []string{
+	"container:create",
+	"container:start",
+	"container:stop",
+	"container:die",
+	"container:destroy",
+	"service:create",
+	"service:update",
+	"service:remove",
+	"config:create",
+	"config:remove",
+	"network:connect",
+	"network:disconnect",
+}
+
+// eventFilter selects the docker events listened to and the ones triggering updates
+type eventFilter struct {
+	scopes  []string
+	types   []string
+	actions map[string]map[string]bool
+}
+
+func newEventFilter(options *config.Options) *eventFilter {
+	filter := &eventFilter{
+		scopes:  options.EventScopes,
+		actions: map[string]map[string]bool{},
+	}
+	if len(filter.scopes) == 0 {
+		filter.scopes = defaultEventScopes
+	}
+	types := options.EventTypes
+	if len(types) == 0 {
+		types = defaultEventTypes
+	}
+	actions := options.EventActions
+	if len(actions) == 0 {
+		actions = defaultEventActions
+	}
+
+	for _, eventType := range types {
+		filter.addType(eventType)
+	}
+	for _, typeAction := range actions {
+		eventType, action, _ := strings.Cut(typeAction, ":")
+		filter.addType(eventType)
+		filter.actions[eventType][action] = true
+	}
+	return filter
+}
+
+func (filter *eventFilter) addType(eventType string) {
+	if _, exists := filter.actions[eventType]; !exists {
+		filter.types = append(filter.types, eventType)
+		filter.actions[eventType] = map[string]bool{}
+	}
+}
+
+// args returns the filters of docker events subscriptions, without scopes when noScope is set
+func (filter *eventFilter) args(noScope bool) filters.Args {
+	args := filters.NewArgs()
+	if !noScope {
+		for _, scope := range filter.scopes {
+			args.Add("scope", scope)
+		}
+	}
+	for _, eventType := range filter.types {
+		args.Add("type", eventType)
+	}
+	return args
+}
+
+// triggersUpdate checks whether event should trigger an update
+func (filter *eventFilter) triggersUpdate(event events.Message) bool {
+	return filter.actions[string(event.Type)][string(event.Action)]
+}
+
+// EventSummary is a short description of a docker event
+type EventSummary struct {
+	Time         time.Time `json:"time"`
+	DockerSocket string    `json:"docker_socket"`
+	Type         string    `json:"type"`
+	Action       string    `json:"action"`
+	Actor        string    `json:"actor"`
+}
+
+// EventsStatus describes docker events subscriptions and the most recent events received
+type EventsStatus struct {
+	Connected     map[string]bool `json:"connected"`
+	LastEventTime *time.Time      `json:"last_event_time,omitempty"`
+	RecentEvents  []EventSummary  `json:"recent_events"`
+}
+
+type eventsTracker struct {
+	mutex         sync.RWMutex
+	connected     map[string]bool
+	lastEventTime time.Time
+	recentEvents  []EventSummary
+	next          int
+}
+
+func newEventsTracker() *eventsTracker {
+	return &eventsTracker{
+		connected:    map[string]bool{},
+		recentEvents: make([]EventSummary, 0, maxRecentEvents),
+	}
+}
+
+func (tracker *eventsTracker) setConnected(dockerSocket string, connected bool) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.connected[dockerSocket] = connected
+}
+
+func (tracker *eventsTracker) record(dockerSocket string, event events.Message) {
+	actor := event.Actor.Attributes["name"]
+	if actor == "" {
+		actor = event.Actor.ID
+	}
+	summary := EventSummary{
+		Time:         time.Now(),
+		DockerSocket: dockerSocket,
+		Type:         string(event.Type),
+		Action:       string(event.Action),
+		Actor:        actor,
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.lastEventTime = summary.Time
+	if len(tracker.recentEvents) < maxRecentEvents {
+		tracker.recentEvents = append(tracker.recentEvents, summary)
+	} else {
+		tracker.recentEvents[tracker.next] = summary
+	}
+	tracker.next = (tracker.next + 1) % maxRecentEvents
+}
+
+// lastEvent returns when the last event was received, zero before any
+func (tracker *eventsTracker) lastEvent() time.Time {
+	tracker.mutex.RLock()
+	defer tracker.mutex.RUnlock()
+	return tracker.lastEventTime
+}
+
+// status returns a copy of the current state, with recent events ordered from oldest to newest
+func (tracker *eventsTracker) status() EventsStatus {
+	tracker.mutex.RLock()
+	defer tracker.mutex.RUnlock()
+
+	status := EventsStatus{
+		Connected:    map[string]bool{},
+		RecentEvents: make([]EventSummary, 0, len(tracker.recentEvents)),
+	}
+	for dockerSocket, connected := range tracker.connected {
+		status.Connected[dockerSocket] = connected
+	}
+	if !tracker.lastEventTime.IsZero() {
+		lastEventTime := tracker.lastEventTime
+		status.LastEventTime = &lastEventTime
+	}
+	if len(tracker.recentEvents) < maxRecentEvents {
+		status.RecentEvents = append(status.RecentEvents, tracker.recentEvents...)
+	} else {
+		status.RecentEvents = append(status.RecentEvents, tracker.recentEvents[tracker.next:]...)
+		status.RecentEvents = append(status.RecentEvents, tracker.recentEvents[:tracker.next]...)
+	}
+	return status
+}
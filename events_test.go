@@ -0,0 +1,42 @@
+package caddydockerproxy
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventFilter_Defaults(t *testing.T) {
+	filter := newEventFilter(&config.Options{})
+
+	args := filter.args(false)
+	assert.ElementsMatch(t, []string{"swarm", "local"}, args.Get("scope"))
+	assert.ElementsMatch(t, []string{"service", "container", "config", "node", "network"}, args.Get("type"))
+	assert.Empty(t, filter.args(true).Get("scope"))
+
+	assert.True(t, filter.triggersUpdate(events.Message{Type: events.ContainerEventType, Action: events.ActionStart}))
+	assert.True(t, filter.triggersUpdate(events.Message{Type: events.ServiceEventType, Action: events.ActionUpdate}))
+	assert.False(t, filter.triggersUpdate(events.Message{Type: events.ContainerEventType, Action: events.ActionExecStart}))
+	assert.False(t, filter.triggersUpdate(events.Message{Type: events.NodeEventType, Action: events.ActionUpdate}))
+	assert.True(t, filter.triggersUpdate(events.Message{Type: events.NetworkEventType, Action: events.ActionConnect}))
+	assert.False(t, filter.triggersUpdate(events.Message{Type: events.NetworkEventType, Action: events.ActionCreate}))
+}
+
+func TestEventFilter_Custom(t *testing.T) {
+	filter := newEventFilter(&config.Options{
+		EventScopes:  []string{"local"},
+		EventTypes:   []string{"container"},
+		EventActions: []string{"container:start", "network:create"},
+	})
+
+	args := filter.args(false)
+	assert.Equal(t, []string{"local"}, args.Get("scope"))
+	assert.ElementsMatch(t, []string{"container", "network"}, args.Get("type"))
+
+	assert.True(t, filter.triggersUpdate(events.Message{Type: events.ContainerEventType, Action: events.ActionStart}))
+	assert.True(t, filter.triggersUpdate(events.Message{Type: events.NetworkEventType, Action: events.ActionCreate}))
+	assert.False(t, filter.triggersUpdate(events.Message{Type: events.NetworkEventType, Action: events.ActionConnect}))
+	assert.False(t, filter.triggersUpdate(events.Message{Type: events.ContainerEventType, Action: events.ActionStop}))
+}
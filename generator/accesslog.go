@@ -0,0 +1,54 @@
+package generator
+
+import (
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+)
+
+// getAccessLogDirective creates the log directive added to sites generated from labels,
+// writing access logs with AccessLogFormat and without AccessLogOmitFields.
+// Returns nil when AccessLogFormat is not set
+func (g *CaddyfileGenerator) getAccessLogDirective() *caddyfile.Block {
+	if g.options.AccessLogFormat == "" {
+		return nil
+	}
+
+	format := caddyfile.CreateBlock()
+	if len(g.options.AccessLogOmitFields) == 0 {
+		format.AddKeys("format", g.options.AccessLogFormat)
+	} else {
+		format.AddKeys("format", "filter")
+		wrap := caddyfile.CreateBlock()
+		wrap.AddKeys("wrap", g.options.AccessLogFormat)
+		format.AddBlock(wrap)
+		fields := caddyfile.CreateBlock()
+		fields.AddKeys("fields")
+		for _, field := range g.options.AccessLogOmitFields {
+			omitField := caddyfile.CreateBlock()
+			omitField.AddKeys(field, "delete")
+			fields.AddBlock(omitField)
+		}
+		format.AddBlock(fields)
+	}
+
+	directive := caddyfile.CreateBlock()
+	directive.AddKeys("log")
+	directive.AddBlock(format)
+	return directive
+}
+
+// addAccessLog adds the access log directive to sites of a container or service
+// that don't configure their own log
+func addAccessLog(container *caddyfile.Container, directive *caddyfile.Block) {
+	if directive == nil {
+		return
+	}
+	for _, block := range container.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		if len(block.GetAllByFirstKey("log")) > 0 {
+			continue
+		}
+		block.AddBlock(cloneBlock(directive))
+	}
+}
@@ -0,0 +1,100 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/docker/docker/api/types"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLog_JSON(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("a", "172.17.0.2", map[string]string{
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s"):               "a.testdomain.com",
+		}),
+		createContainer("b", "172.17.0.3", map[string]string{
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s"):               "b.testdomain.com",
+		}),
+	}
+
+	const expectedCaddyfile = "a.testdomain.com {\n" +
+		"	log {\n" +
+		"		format json\n" +
+		"	}\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n" +
+		"b.testdomain.com {\n" +
+		"	log {\n" +
+		"		format json\n" +
+		"	}\n" +
+		"	reverse_proxy 172.17.0.3:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.AccessLogFormat = "json"
+	}, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"encoder":{"format":"json"}`)
+	assert.Contains(t, string(configJSON), `"logs":{"logger_names":{"a.testdomain.com":["log0"],"b.testdomain.com":["log1"]}}`)
+}
+
+func TestAccessLog_OmitFields(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("a", "172.17.0.2", map[string]string{
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s"):               "a.testdomain.com",
+		}),
+	}
+
+	const expectedCaddyfile = "a.testdomain.com {\n" +
+		"	log {\n" +
+		"		format filter {\n" +
+		"			fields {\n" +
+		"				request>headers delete\n" +
+		"				resp_headers delete\n" +
+		"			}\n" +
+		"			wrap json\n" +
+		"		}\n" +
+		"	}\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.AccessLogFormat = "json"
+		options.AccessLogOmitFields = []string{"request>headers", "resp_headers"}
+	}, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"encoder":{"fields":{"request\u003eheaders":{"filter":"delete"},"resp_headers":{"filter":"delete"}},"format":"filter","wrap":{"format":"json"}}`)
+}
+
+func TestAccessLog_KeepsLabelsLog(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("a", "172.17.0.2", map[string]string{
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s"):               "a.testdomain.com",
+			fmtLabel("%s.log.output"):    "stdout",
+		}),
+	}
+
+	const expectedCaddyfile = "a.testdomain.com {\n" +
+		"	log {\n" +
+		"		output stdout\n" +
+		"	}\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.AccessLogFormat = "json"
+	}, expectedCaddyfile, commonLogs)
+}
@@ -0,0 +1,64 @@
+package generator
+
+import (
+	"net"
+	"strings"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"go.uber.org/zap"
+)
+
+// filterAllowedHostnames removes site addresses whose hostnames don't match any pattern of
+// HostnameAllowlist from a container or service caddyfile, and sites left without addresses.
+// Addresses without hostname, like :8080, are checked as an empty hostname
+func (g *CaddyfileGenerator) filterAllowedHostnames(sourceCaddyfile *caddyfile.Container, owner string, logger *zap.Logger) {
+	if len(g.options.HostnameAllowlist) == 0 {
+		return
+	}
+	for _, block := range append([]*caddyfile.Block{}, sourceCaddyfile.Children...) {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		keys := []string{}
+		for _, key := range block.Keys {
+			address := strings.TrimSpace(strings.TrimSuffix(key, ","))
+			if address == "" {
+				continue
+			}
+			hostname := getAddressHostname(address)
+			if !g.isHostnameAllowed(hostname) {
+				logger.Warn("Hostname not allowed, skipping site address", zap.String("hostname", hostname), zap.String("address", address), zap.String("owner", owner))
+				continue
+			}
+			keys = append(keys, address)
+		}
+		if len(keys) == 0 {
+			sourceCaddyfile.Remove(block)
+			continue
+		}
+		block.Keys = keys
+	}
+}
+
+func (g *CaddyfileGenerator) isHostnameAllowed(hostname string) bool {
+	for _, pattern := range g.options.HostnameAllowlist {
+		if pattern.MatchString(hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// getAddressHostname returns the hostname of a site address, without scheme, port and path
+func getAddressHostname(address string) string {
+	if index := strings.Index(address, "://"); index >= 0 {
+		address = address[index+3:]
+	}
+	if index := strings.Index(address, "/"); index >= 0 {
+		address = address[:index]
+	}
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	return strings.ToLower(address)
+}
@@ -0,0 +1,70 @@
+package generator
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostnameAllowlist(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("allowed", "172.17.0.2", map[string]string{
+			fmtLabel("%s"):               "app.example.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+		createContainer("mixed", "172.17.0.3", map[string]string{
+			fmtLabel("%s"):               "http://other.example.com:8080, typo.exmaple.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+		createContainer("skipped", "172.17.0.4", map[string]string{
+			fmtLabel("%s"):               "evil.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+	}
+
+	const expectedCaddyfile = "app.example.com {\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n" +
+		"http://other.example.com:8080 {\n" +
+		"	reverse_proxy 172.17.0.3:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`WARN	Hostname not allowed, skipping site address	{"hostname": "typo.exmaple.com", "address": "typo.exmaple.com", "owner": "container/mixed"}` + newLine +
+		`WARN	Hostname not allowed, skipping site address	{"hostname": "evil.com", "address": "evil.com", "owner": "container/skipped"}` + newLine
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.HostnameAllowlist = []*regexp.Regexp{
+			regexp.MustCompile(`^(?:[a-z0-9-]+\.example\.com)$`),
+			regexp.MustCompile(`^(?:internal)$`),
+		}
+	}, expectedCaddyfile, expectedLogs)
+}
+
+func TestHostnameAllowlist_Default(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("any", "172.17.0.2", map[string]string{
+			fmtLabel("%s"):               "evil.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+	}
+
+	const expectedCaddyfile = "evil.com {\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+}
+
+func TestGetAddressHostname(t *testing.T) {
+	assert.Equal(t, "example.com", getAddressHostname("example.com"))
+	assert.Equal(t, "example.com", getAddressHostname("https://Example.com:8443/api/*"))
+	assert.Equal(t, "*.example.com", getAddressHostname("*.example.com"))
+	assert.Equal(t, "", getAddressHostname(":8080"))
+	assert.Equal(t, "::1", getAddressHostname("[::1]:8080"))
+}
@@ -0,0 +1,119 @@
+package generator
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"go.uber.org/zap"
+)
+
+// sortContainers sorts containers by name and then by ID, making the order in which
+// their caddyfiles are merged deterministic
+func sortContainers(containers []types.Container) {
+	sort.SliceStable(containers, func(i, j int) bool {
+		nameI, nameJ := getContainerName(&containers[i]), getContainerName(&containers[j])
+		if nameI != nameJ {
+			return nameI < nameJ
+		}
+		return containers[i].ID < containers[j].ID
+	})
+}
+
+// sortServices sorts services by name and then by ID, making the order in which
+// their caddyfiles are merged deterministic
+func sortServices(services []swarm.Service) {
+	sort.SliceStable(services, func(i, j int) bool {
+		if services[i].Spec.Name != services[j].Spec.Name {
+			return services[i].Spec.Name < services[j].Spec.Name
+		}
+		return services[i].ID < services[j].ID
+	})
+}
+
+// sortTasks sorts tasks by ID, making the order of their upstreams deterministic
+func sortTasks(tasks []swarm.Task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].ID < tasks[j].ID
+	})
+}
+
+func getContainerName(container *types.Container) string {
+	if len(container.Names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(container.Names[0], "/")
+}
+
+// getContainerRouteOwner identifies the application a container belongs to.
+// Replicas of the same compose service share routes without colliding
+func getContainerRouteOwner(container *types.Container) string {
+	project, hasProject := container.Labels["com.docker.compose.project"]
+	service, hasService := container.Labels["com.docker.compose.service"]
+	if hasProject && hasService {
+		return "compose/" + project + "/" + service
+	}
+	if name := getContainerName(container); name != "" {
+		return "container/" + name
+	}
+	return "container/" + container.ID
+}
+
+// checkRouteCollisions registers the routes of a container or service, detecting routes with
+// the same site address and matcher already registered by another owner. The first owner
+// in sort order wins. Returns false when routes collide and FailOnRouteCollision is enabled
+func (g *CaddyfileGenerator) checkRouteCollisions(routeOwners map[string]string, owner string, sourceCaddyfile *caddyfile.Container, logger *zap.Logger) bool {
+	routes := getRouteKeys(sourceCaddyfile)
+
+	collided := false
+	for _, route := range routes {
+		if existingOwner, exists := routeOwners[route]; exists && existingOwner != owner {
+			collided = true
+			if g.options.FailOnRouteCollision {
+				logger.Error("Route collision, ignoring routes", zap.String("route", route), zap.String("owner", existingOwner), zap.String("ignored", owner))
+			} else {
+				logger.Warn("Route collision", zap.String("route", route), zap.String("owner", existingOwner), zap.String("colliding", owner))
+			}
+		}
+	}
+	if collided && g.options.FailOnRouteCollision {
+		return false
+	}
+
+	for _, route := range routes {
+		if _, exists := routeOwners[route]; !exists {
+			routeOwners[route] = owner
+		}
+	}
+	return true
+}
+
+// getRouteKeys returns the site address and matcher of every proxy directive and route block in sites
+func getRouteKeys(container *caddyfile.Container) []string {
+	routes := []string{}
+	for _, block := range container.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		site := strings.Join(block.Keys, " ")
+		for _, directive := range block.Children {
+			switch directive.GetFirstKey() {
+			case "reverse_proxy", "php_fastcgi":
+				matcher := "*"
+				if len(directive.Keys) > 1 && isRouteMatcher(directive.Keys[1]) {
+					matcher = directive.Keys[1]
+				}
+				routes = append(routes, site+" "+matcher)
+			case "route", "handle", "handle_path":
+				routes = append(routes, site+" "+strings.Join(directive.Keys, " "))
+			}
+		}
+	}
+	return routes
+}
+
+func isRouteMatcher(value string) bool {
+	return value == "*" || strings.HasPrefix(value, "/") || strings.HasPrefix(value, "@")
+}
@@ -0,0 +1,124 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollisions_WarnsAndResolvesDeterministically(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("app-b", "172.17.0.3", map[string]string{
+			fmtLabel("%s"):               "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+		createContainer("app-a", "172.17.0.2", map[string]string{
+			fmtLabel("%s"):               "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2:80 172.17.0.3:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`WARN	Route collision	{"route": "service.testdomain.com *", "owner": "container/app-a", "colliding": "container/app-b"}` + newLine
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
+}
+
+func TestCollisions_FailOnRouteCollision(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("app-b", "172.17.0.3", map[string]string{
+			fmtLabel("%s"):               "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+		createContainer("app-a", "172.17.0.2", map[string]string{
+			fmtLabel("%s"):               "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`ERROR	Route collision, ignoring routes	{"route": "service.testdomain.com *", "owner": "container/app-a", "ignored": "container/app-b"}` + newLine
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.FailOnRouteCollision = true
+	}, expectedCaddyfile, expectedLogs)
+}
+
+func TestCollisions_ComposeReplicasDontCollide(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("project-app-2", "172.17.0.3", map[string]string{
+			fmtLabel("%s"):               "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			"com.docker.compose.project": "project",
+			"com.docker.compose.service": "app",
+		}),
+		createContainer("project-app-1", "172.17.0.2", map[string]string{
+			fmtLabel("%s"):               "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			"com.docker.compose.project": "project",
+			"com.docker.compose.service": "app",
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2:80 172.17.0.3:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.FailOnRouteCollision = true
+	}, expectedCaddyfile, expectedLogs)
+}
+
+func TestCollisions_DifferentMatchersDontCollide(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("app-a", "172.17.0.2", map[string]string{
+			fmtLabel("%s"):               "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "/api/* {{upstreams 80}}",
+		}),
+		createContainer("app-b", "172.17.0.3", map[string]string{
+			fmtLabel("%s"):               "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy /api/* 172.17.0.2:80\n" +
+		"	reverse_proxy 172.17.0.3:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.FailOnRouteCollision = true
+	}, expectedCaddyfile, expectedLogs)
+}
+
+func TestCollisions_SortContainersByNameThenID(t *testing.T) {
+	containers := []types.Container{
+		{ID: "ID-3", Names: []string{"/b"}},
+		{ID: "ID-2", Names: []string{"/a"}},
+		{ID: "ID-1", Names: []string{"/b"}},
+	}
+
+	sortContainers(containers)
+
+	assert.Equal(t, "ID-2", containers[0].ID)
+	assert.Equal(t, "ID-1", containers[1].ID)
+	assert.Equal(t, "ID-3", containers[2].ID)
+}
@@ -1,17 +1,42 @@
 package generator
 
 import (
+	"errors"
+	"sort"
+
 	"github.com/docker/docker/api/types"
 	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
 	"go.uber.org/zap"
 )
 
+// errNoExposedPorts is returned when upstreams without port are generated for a container
+// that exposes no ports and OnNoExposedPorts is skip or error
+var errNoExposedPorts = errors.New("container exposes no ports")
+
 func (g *CaddyfileGenerator) getContainerCaddyfile(container *types.Container, logger *zap.Logger) (*caddyfile.Container, error) {
 	caddyLabels := g.filterLabels(container.Labels)
 
 	return labelsToCaddyfile(caddyLabels, container, func() ([]string, error) {
 		return g.getContainerIPAddresses(container, logger, true)
-	})
+	}, func() (int, error) {
+		return g.getContainerDefaultPort(container)
+	}, logger)
+}
+
+// getContainerDefaultPort returns the port added to upstreams without an explicit port,
+// according to OnNoExposedPorts when the container exposes no ports
+func (g *CaddyfileGenerator) getContainerDefaultPort(container *types.Container) (int, error) {
+	if len(container.Ports) > 0 {
+		return 0, nil
+	}
+	switch g.options.OnNoExposedPorts {
+	case config.NoExposedPortsSkip, config.NoExposedPortsError:
+		return 0, errNoExposedPorts
+	case config.NoExposedPortsDefaultPort:
+		return g.options.NoExposedPortsDefaultPort, nil
+	}
+	return 0, nil
 }
 
 func (g *CaddyfileGenerator) getContainerIPAddresses(container *types.Container, logger *zap.Logger, onlyIngressIps bool) ([]string, error) {
@@ -19,7 +44,15 @@ func (g *CaddyfileGenerator) getContainerIPAddresses(container *types.Container,
 
 	ingressNetworkFromLabel, overrideNetwork := container.Labels[IngressNetworkLabel]
 
-	for networkName, network := range container.NetworkSettings.Networks {
+	// Networks are a map, sort them so upstreams are listed in the same order on every generation
+	networkNames := make([]string, 0, len(container.NetworkSettings.Networks))
+	for networkName := range container.NetworkSettings.Networks {
+		networkNames = append(networkNames, networkName)
+	}
+	sort.Strings(networkNames)
+
+	for _, networkName := range networkNames {
+		network := container.NetworkSettings.Networks[networkName]
 		include := false
 
 		if !onlyIngressIps  {
@@ -1,11 +1,17 @@
 package generator
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 
+	"github.com/caddyserver/caddy/v2/caddyconfig"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/network"
 	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 )
 
 func TestContainers_TemplateData(t *testing.T) {
@@ -386,3 +392,604 @@ func TestContainers_WithSnippets(t *testing.T) {
 
 	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
 }
+
+func TestContainers_BindAddress(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "pinned.testdomain.com",
+				fmtLabel("%s.bind"):          "10.0.0.1",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			},
+		},
+		{
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.3",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "other.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			},
+		},
+	}
+
+	const expectedCaddyfile = "other.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.3:80\n" +
+		"}\n" +
+		"pinned.testdomain.com {\n" +
+		"	bind 10.0.0.1\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"listen":["10.0.0.1:443"]`)
+	assert.Contains(t, string(configJSON), `"listen":[":443"]`)
+}
+
+func TestContainers_MaintenancePage(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):                       "service.testdomain.com",
+				fmtLabel("%s.reverse_proxy"):         "{{upstreams 80}}",
+				fmtLabel("%s.handle_errors"):         "502 503 504",
+				fmtLabel("%s.handle_errors.respond"): "\"Down for maintenance\" 503",
+			},
+		},
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	handle_errors 502 503 504 {\n" +
+		"		respond \"Down for maintenance\" 503\n" +
+		"	}\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+
+	config := struct {
+		Apps struct {
+			HTTP struct {
+				Servers map[string]struct {
+					Routes []interface{} `json:"routes"`
+					Errors struct {
+						Routes []interface{} `json:"routes"`
+					} `json:"errors"`
+				} `json:"servers"`
+			} `json:"http"`
+		} `json:"apps"`
+	}{}
+	assert.NoError(t, json.Unmarshal(configJSON, &config))
+	server := config.Apps.HTTP.Servers["srv0"]
+	assert.Len(t, server.Routes, 1)
+	assert.Len(t, server.Errors.Routes, 1)
+	assert.Contains(t, string(configJSON), `"body":"Down for maintenance"`)
+}
+
+func TestContainers_UpstreamTLSServerName(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):                                         "service.testdomain.com",
+				fmtLabel("%s.reverse_proxy"):                           "{{upstreams https 8443}}",
+				fmtLabel("%s.reverse_proxy.transport"):                 "http",
+				fmtLabel("%s.reverse_proxy.transport.tls_server_name"): "backend.internal",
+			},
+		},
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy https://172.17.0.2:8443 {\n" +
+		"		transport http {\n" +
+		"			tls_server_name backend.internal\n" +
+		"		}\n" +
+		"	}\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"tls":{"server_name":"backend.internal"}`)
+	assert.Contains(t, string(configJSON), `"dial":"172.17.0.2:8443"`)
+}
+
+func TestContainers_TerminalRoutes(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):                       "service.testdomain.com",
+				fmtLabel("%s.route"):                 "/api/*",
+				fmtLabel("%s.route.0_header"):        "X-Service api",
+				fmtLabel("%s.route.1_reverse_proxy"): "{{upstreams 80}}",
+			},
+		},
+		{
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.3",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):                       "service.testdomain.com",
+				fmtLabel("%s.route"):                 "/*",
+				fmtLabel("%s.route.0_header"):        "X-Service web",
+				fmtLabel("%s.route.1_reverse_proxy"): "{{upstreams 80}}",
+			},
+		},
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	handle /* {\n" +
+		"		header X-Service web\n" +
+		"		reverse_proxy 172.17.0.3:80\n" +
+		"	}\n" +
+		"	handle /api/* {\n" +
+		"		header X-Service api\n" +
+		"		reverse_proxy 172.17.0.2:80\n" +
+		"	}\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.TerminalRoutes = true
+	}, expectedCaddyfile, expectedLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+
+	config := struct {
+		Apps struct {
+			HTTP struct {
+				Servers map[string]struct {
+					Routes []struct {
+						Handle []struct {
+							Routes []struct {
+								Group string `json:"group"`
+								Match []struct {
+									Path []string `json:"path"`
+								} `json:"match"`
+							} `json:"routes"`
+						} `json:"handle"`
+					} `json:"routes"`
+				} `json:"servers"`
+			} `json:"http"`
+		} `json:"apps"`
+	}{}
+	assert.NoError(t, json.Unmarshal(configJSON, &config))
+	routes := config.Apps.HTTP.Servers["srv0"].Routes[0].Handle[0].Routes
+	assert.Len(t, routes, 2)
+	assert.NotEmpty(t, routes[0].Group)
+	assert.Equal(t, routes[0].Group, routes[1].Group)
+	assert.Equal(t, []string{"/api/*"}, routes[0].Match[0].Path)
+	assert.Equal(t, []string{"/*"}, routes[1].Match[0].Path)
+}
+
+func TestContainers_ForwardedHeaders(t *testing.T) {
+	adaptReverseProxy := func(labels map[string]string) string {
+		dockerClient := createBasicDockerClientMock()
+		dockerClient.ContainersData = []types.Container{
+			{
+				NetworkSettings: &types.SummaryNetworkSettings{
+					Networks: map[string]*network.EndpointSettings{
+						"caddy-network": {
+							IPAddress: "172.17.0.2",
+							NetworkID: caddyNetworkID,
+						},
+					},
+				},
+				Labels: labels,
+			},
+		}
+		generator := CreateGenerator([]docker.Client{dockerClient}, createDockerUtilsMock(), &config.Options{
+			LabelPrefix: DefaultLabelPrefix,
+		})
+		caddyfile, _, _ := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+		configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt(caddyfile, nil)
+		assert.NoError(t, err)
+		return string(configJSON)
+	}
+
+	overwrite := adaptReverseProxy(map[string]string{
+		fmtLabel("%s"):                           "service.testdomain.com",
+		fmtLabel("%s.reverse_proxy"):             "{{upstreams 80}}",
+		fmtLabel("%s.reverse_proxy.0_header_up"): "X-Forwarded-For {remote_host}",
+		fmtLabel("%s.reverse_proxy.1_header_up"): "X-Forwarded-Host {host}",
+	})
+	assert.Contains(t, overwrite, `"X-Forwarded-For":["{http.request.remote.host}"]`)
+	assert.Contains(t, overwrite, `"X-Forwarded-Host":["{http.request.host}"]`)
+	assert.NotContains(t, overwrite, `"trusted_proxies"`)
+
+	preserve := adaptReverseProxy(map[string]string{
+		fmtLabel("%s"):                               "service.testdomain.com",
+		fmtLabel("%s.reverse_proxy"):                 "{{upstreams 80}}",
+		fmtLabel("%s.reverse_proxy.trusted_proxies"): "private_ranges",
+	})
+	assert.Contains(t, preserve, `"trusted_proxies":["192.168.0.0/16"`)
+	assert.NotContains(t, preserve, `"headers"`)
+
+	strip := adaptReverseProxy(map[string]string{
+		fmtLabel("%s"):                         "service.testdomain.com",
+		fmtLabel("%s.reverse_proxy"):           "{{upstreams 80}}",
+		fmtLabel("%s.reverse_proxy.header_up"): "-X-Forwarded-*",
+	})
+	assert.Contains(t, strip, `"delete":["X-Forwarded-*"]`)
+}
+
+func TestContainers_HTTPSRedirect(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "public.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+				HTTPSRedirectLabel:           "true",
+			},
+		},
+		{
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.3",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "internal.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+				HTTPSRedirectLabel:           "false",
+			},
+		},
+	}
+
+	const expectedCaddyfile = "http://public.testdomain.com {\n" +
+		"	redir https://{host}{uri} permanent\n" +
+		"}\n" +
+		"internal.testdomain.com http://internal.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.3:80\n" +
+		"}\n" +
+		"public.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
+
+	// Redirect is forced even when automatic redirects are disabled globally
+	globalCaddyfile := "{\n\tauto_https disable_redirects\n}\n" + expectedCaddyfile
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(globalCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"Location":["https://{http.request.host}{http.request.uri}"]`)
+	assert.Contains(t, string(configJSON), `"listen":[":80"]`)
+}
+
+func TestGetHTTPAddresses(t *testing.T) {
+	addresses := getHTTPAddresses([]string{"a.testdomain.com,", "https://b.testdomain.com", "c.testdomain.com:443/api", "d.testdomain.com:8443", "http://e.testdomain.com", ":443"})
+
+	assert.Equal(t, []string{"http://a.testdomain.com", "http://b.testdomain.com", "http://c.testdomain.com/api"}, addresses)
+}
+
+func createContainersWithoutExposedPorts() *docker.ClientMock {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			ID: "CONTAINER-ID",
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "noports.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+			},
+		},
+		{
+			ID: "EXPOSED-CONTAINER-ID",
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.3",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Ports: []types.Port{
+				{PrivatePort: 8080, Type: "tcp"},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "exposed.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+			},
+		},
+		{
+			ID: "EXPLICIT-PORT-CONTAINER-ID",
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.4",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "explicit.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams https 8443}}",
+			},
+		},
+	}
+	return dockerClient
+}
+
+const exposedContainersCaddyfile = "explicit.testdomain.com {\n" +
+	"	reverse_proxy https://172.17.0.4:8443\n" +
+	"}\n" +
+	"exposed.testdomain.com {\n" +
+	"	reverse_proxy 172.17.0.3\n" +
+	"}\n"
+
+func TestContainers_NoExposedPortsDefault(t *testing.T) {
+	const expectedCaddyfile = exposedContainersCaddyfile +
+		"noports.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2\n" +
+		"}\n"
+
+	testGeneration(t, createContainersWithoutExposedPorts(), nil, expectedCaddyfile, commonLogs)
+}
+
+func TestContainers_NoExposedPortsSkip(t *testing.T) {
+	const expectedLogs = commonLogs +
+		`WARN	Skipping container without exposed ports	{"container": "CONTAINER-ID"}` + newLine
+
+	testGeneration(t, createContainersWithoutExposedPorts(), func(options *config.Options) {
+		options.OnNoExposedPorts = config.NoExposedPortsSkip
+	}, exposedContainersCaddyfile, expectedLogs)
+}
+
+func TestContainers_NoExposedPortsError(t *testing.T) {
+	const expectedLogs = commonLogs +
+		`ERROR	Container has no exposed ports	{"container": "CONTAINER-ID"}` + newLine
+
+	testGeneration(t, createContainersWithoutExposedPorts(), func(options *config.Options) {
+		options.OnNoExposedPorts = config.NoExposedPortsError
+	}, exposedContainersCaddyfile, expectedLogs)
+}
+
+func TestContainers_NoExposedPortsDefaultPort(t *testing.T) {
+	const expectedCaddyfile = exposedContainersCaddyfile +
+		"noports.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2:3000\n" +
+		"}\n"
+
+	testGeneration(t, createContainersWithoutExposedPorts(), func(options *config.Options) {
+		options.OnNoExposedPorts = config.NoExposedPortsDefaultPort
+		options.NoExposedPortsDefaultPort = 3000
+	}, expectedCaddyfile, commonLogs)
+}
+
+func TestContainers_RetryOnStatus(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):                                                           "service.testdomain.com",
+				fmtLabel("%s.reverse_proxy"):                                             "{{upstreams 80}}",
+				fmtLabel("%s.reverse_proxy.lb_retries"):                                  "2",
+				fmtLabel("%s.reverse_proxy.fail_duration"):                               "30s",
+				fmtLabel("%s.reverse_proxy.unhealthy_status"):                            "502 503",
+				fmtLabel("%s.reverse_proxy.@retry.status"):                               "502 503",
+				fmtLabel("%s.reverse_proxy.handle_response"):                             "@retry",
+				fmtLabel("%s.reverse_proxy.handle_response.reverse_proxy"):               "{{upstreams 80}}",
+				fmtLabel("%s.reverse_proxy.handle_response.reverse_proxy.fail_duration"): "30s",
+			},
+		},
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2:80 {\n" +
+		"		@retry {\n" +
+		"			status 502 503\n" +
+		"		}\n" +
+		"		fail_duration 30s\n" +
+		"		handle_response @retry {\n" +
+		"			reverse_proxy 172.17.0.2:80 {\n" +
+		"				fail_duration 30s\n" +
+		"			}\n" +
+		"		}\n" +
+		"		lb_retries 2\n" +
+		"		unhealthy_status 502 503\n" +
+		"	}\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"retries":2`)
+	assert.Contains(t, string(configJSON), `"unhealthy_status":[502,503]`)
+	assert.Contains(t, string(configJSON), `"handle_response":[{"match":{"status_code":[502,503]}`)
+}
+
+func TestContainers_ExtraLabelPrefixes(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("app-a", "172.17.0.2", map[string]string{
+			fmtLabel("%s"):               "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+		createContainer("app-b", "172.17.0.3", map[string]string{
+			"team-b":                 "team-b.testdomain.com",
+			"team-b.reverse_proxy":   "{{upstreams 80}}",
+			"team-b_1":               "service.testdomain.com",
+			"team-b_1.reverse_proxy": "{{upstreams 80}}",
+		}),
+		createContainer("app-c", "172.17.0.4", map[string]string{
+			"team-c":               "team-c.testdomain.com",
+			"team-c.reverse_proxy": "{{upstreams 80}}",
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2:80 172.17.0.3:80\n" +
+		"}\n" +
+		"team-b.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.3:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`WARN	Route collision	{"route": "service.testdomain.com *", "owner": "container/app-a", "colliding": "container/app-b"}` + newLine
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.ExtraLabelPrefixes = []string{"team-b"}
+	}, expectedCaddyfile, expectedLogs)
+}
+
+func TestContainers_ScanFilters(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("app-a", "172.17.0.2", map[string]string{
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s"):               "a.testdomain.com",
+			"caddy_enabled":              "true",
+		}),
+		createContainer("app-b", "172.17.0.3", map[string]string{
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s"):               "b.testdomain.com",
+		}),
+	}
+
+	const expectedCaddyfile = "a.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.ScanFilters = []string{"label=caddy_enabled=true"}
+	}, expectedCaddyfile, commonLogs)
+}
+
+func TestContainers_TemplateMetadata(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("app-a", "172.17.0.2", map[string]string{
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s"):               `{{label "com.example.domain"}}`,
+			fmtLabel("%s.respond"):       `/info "{{name}} {{index .Labels "com.example.env"}}"`,
+			"com.example.domain":         "a.testdomain.com",
+			"com.example.env":            "prod",
+		}),
+	}
+
+	const expectedCaddyfile = "a.testdomain.com {\n" +
+		"	respond /info \"app-a prod\"\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+}
+
+func TestContainers_TemplateMissingDataSkipsLabel(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("app-a", "172.17.0.2", map[string]string{
+			fmtLabel("%s"):               "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s.header"):        `X-Env {{label "com.example.env"}}`,
+		}),
+		createContainer("app-b", "172.17.0.3", map[string]string{
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s"):               "b.testdomain.com",
+			fmtLabel("%s.respond"):       `/info {{.Labels.missing}}`,
+		}),
+	}
+
+	const expectedCaddyfile = "b.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.3:80\n" +
+		"}\n" +
+		"service.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`ERROR	Skipping label referencing missing data in its template	{"name": "app-a", "label": "caddy.header", "error": "template: :1:8: executing \"\" at <label \"com.example.env\">: error calling label: label not defined: com.example.env"}` + newLine +
+		`ERROR	Skipping label referencing missing data in its template	{"name": "app-b", "label": "caddy.respond", "error": "template: :1:15: executing \"\" at <.Labels.missing>: map has no entry for key \"missing\""}` + newLine
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
+}
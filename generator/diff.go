@@ -0,0 +1,162 @@
+package generator
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+)
+
+// ConfigDiff summarizes what changed between two generated Caddyfiles
+type ConfigDiff struct {
+	Version           int64             `json:"version"`
+	AddedHosts        []string          `json:"addedHosts"`
+	RemovedHosts      []string          `json:"removedHosts"`
+	ChangedUpstreams  []UpstreamsChange `json:"changedUpstreams"`
+	AddedDirectives   []DirectiveChange `json:"addedDirectives"`
+	RemovedDirectives []DirectiveChange `json:"removedDirectives"`
+}
+
+// UpstreamsChange lists upstreams added to and removed from a host
+type UpstreamsChange struct {
+	Host    string   `json:"host"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// DirectiveChange identifies a directive of a host, by its name and arguments.
+// Proxy directives are identified by their name and matcher, ignoring upstreams
+type DirectiveChange struct {
+	Host      string `json:"host"`
+	Directive string `json:"directive"`
+}
+
+type hostSummary struct {
+	upstreams  map[string]bool
+	directives map[string]bool
+}
+
+// DiffCaddyfiles compares the hosts, upstreams and directives of two generated Caddyfiles
+func DiffCaddyfiles(previous []byte, next []byte) (*ConfigDiff, error) {
+	previousHosts, err := summarizeHosts(previous)
+	if err != nil {
+		return nil, err
+	}
+	nextHosts, err := summarizeHosts(next)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ConfigDiff{
+		AddedHosts:        []string{},
+		RemovedHosts:      []string{},
+		ChangedUpstreams:  []UpstreamsChange{},
+		AddedDirectives:   []DirectiveChange{},
+		RemovedDirectives: []DirectiveChange{},
+	}
+	for _, host := range getSortedKeys(previousHosts) {
+		if _, exists := nextHosts[host]; !exists {
+			diff.RemovedHosts = append(diff.RemovedHosts, host)
+		}
+	}
+	for _, host := range getSortedKeys(nextHosts) {
+		nextSummary := nextHosts[host]
+		previousSummary, exists := previousHosts[host]
+		if !exists {
+			diff.AddedHosts = append(diff.AddedHosts, host)
+			previousSummary = &hostSummary{upstreams: map[string]bool{}, directives: map[string]bool{}}
+		}
+		added, removed := diffSets(previousSummary.upstreams, nextSummary.upstreams)
+		if exists && (len(added) > 0 || len(removed) > 0) {
+			diff.ChangedUpstreams = append(diff.ChangedUpstreams, UpstreamsChange{Host: host, Added: added, Removed: removed})
+		}
+		added, removed = diffSets(previousSummary.directives, nextSummary.directives)
+		for _, directive := range added {
+			diff.AddedDirectives = append(diff.AddedDirectives, DirectiveChange{Host: host, Directive: directive})
+		}
+		for _, directive := range removed {
+			diff.RemovedDirectives = append(diff.RemovedDirectives, DirectiveChange{Host: host, Directive: directive})
+		}
+	}
+	for _, host := range diff.RemovedHosts {
+		for _, directive := range getSortedKeys(previousHosts[host].directives) {
+			diff.RemovedDirectives = append(diff.RemovedDirectives, DirectiveChange{Host: host, Directive: directive})
+		}
+	}
+	return diff, nil
+}
+
+// IsEmpty returns if nothing changed
+func (diff *ConfigDiff) IsEmpty() bool {
+	return len(diff.AddedHosts) == 0 && len(diff.RemovedHosts) == 0 && len(diff.ChangedUpstreams) == 0 &&
+		len(diff.AddedDirectives) == 0 && len(diff.RemovedDirectives) == 0
+}
+
+func summarizeHosts(caddyfileContent []byte) (map[string]*hostSummary, error) {
+	container, err := caddyfile.Unmarshal(caddyfileContent)
+	if err != nil {
+		return nil, err
+	}
+	hosts := map[string]*hostSummary{}
+	for _, block := range container.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		for _, key := range block.Keys {
+			host := strings.TrimSpace(strings.TrimSuffix(key, ","))
+			if host == "" {
+				continue
+			}
+			summary, exists := hosts[host]
+			if !exists {
+				summary = &hostSummary{upstreams: map[string]bool{}, directives: map[string]bool{}}
+				hosts[host] = summary
+			}
+			for _, route := range findProxyRoutes(block.Container, "") {
+				for _, upstream := range route.Upstreams {
+					summary.upstreams[upstream] = true
+				}
+			}
+			for _, directive := range block.Children {
+				summary.directives[getDirectiveIdentity(directive)] = true
+			}
+		}
+	}
+	return hosts, nil
+}
+
+func getDirectiveIdentity(directive *caddyfile.Block) string {
+	switch directive.GetFirstKey() {
+	case "reverse_proxy", "php_fastcgi":
+		if len(directive.Keys) > 1 && isRouteMatcher(directive.Keys[1]) {
+			return directive.Keys[0] + " " + directive.Keys[1]
+		}
+		return directive.Keys[0]
+	}
+	return strings.Join(directive.Keys, " ")
+}
+
+func diffSets(previous map[string]bool, next map[string]bool) ([]string, []string) {
+	added := []string{}
+	removed := []string{}
+	for _, value := range getSortedKeys(next) {
+		if !previous[value] {
+			added = append(added, value)
+		}
+	}
+	for _, value := range getSortedKeys(previous) {
+		if !next[value] {
+			removed = append(removed, value)
+		}
+	}
+	return added, removed
+}
+
+func getSortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
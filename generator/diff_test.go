@@ -0,0 +1,55 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffCaddyfiles(t *testing.T) {
+	previous := "a.testdomain.com {\n" +
+		"	encode gzip\n" +
+		"	reverse_proxy 172.17.0.2:80 172.17.0.3:80\n" +
+		"}\n" +
+		"b.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.4:80\n" +
+		"}\n"
+	next := "a.testdomain.com {\n" +
+		"	header X-Frame-Options DENY\n" +
+		"	reverse_proxy 172.17.0.3:80 172.17.0.5:80\n" +
+		"}\n" +
+		"c.testdomain.com {\n" +
+		"	reverse_proxy /api/* 172.17.0.6:80\n" +
+		"}\n"
+
+	diff, err := DiffCaddyfiles([]byte(previous), []byte(next))
+
+	assert.NoError(t, err)
+	assert.Equal(t, &ConfigDiff{
+		AddedHosts:   []string{"c.testdomain.com"},
+		RemovedHosts: []string{"b.testdomain.com"},
+		ChangedUpstreams: []UpstreamsChange{
+			{Host: "a.testdomain.com", Added: []string{"172.17.0.5:80"}, Removed: []string{"172.17.0.2:80"}},
+		},
+		AddedDirectives: []DirectiveChange{
+			{Host: "a.testdomain.com", Directive: "header X-Frame-Options DENY"},
+			{Host: "c.testdomain.com", Directive: "reverse_proxy /api/*"},
+		},
+		RemovedDirectives: []DirectiveChange{
+			{Host: "a.testdomain.com", Directive: "encode gzip"},
+			{Host: "b.testdomain.com", Directive: "reverse_proxy"},
+		},
+	}, diff)
+	assert.False(t, diff.IsEmpty())
+}
+
+func TestDiffCaddyfiles_Unchanged(t *testing.T) {
+	caddyfile := "a.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n"
+
+	diff, err := DiffCaddyfiles([]byte(caddyfile), []byte(caddyfile))
+
+	assert.NoError(t, err)
+	assert.True(t, diff.IsEmpty())
+}
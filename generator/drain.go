@@ -0,0 +1,116 @@
+package generator
+
+import (
+	"strings"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+)
+
+// KeepRemovedRoutes adds to next the routes of previous that next removes, returning the
+// resulting Caddyfile and the removed routes. Kept routes proxy to no upstream, answering new
+// requests with 503 while ongoing requests to their upstreams drain. Upstreams removed from
+// routes that still exist are not kept either
+func KeepRemovedRoutes(previous []byte, next []byte) ([]byte, []string, error) {
+	previousBlock, err := caddyfile.Unmarshal(previous)
+	if err != nil {
+		return nil, nil, err
+	}
+	nextBlock, err := caddyfile.Unmarshal(next)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nextSites := map[string]*caddyfile.Block{}
+	for _, block := range nextBlock.Children {
+		if isSiteBlock(block) {
+			nextSites[strings.Join(block.Keys, " ")] = block
+		}
+	}
+
+	removed := []string{}
+	for _, previousSite := range previousBlock.Children {
+		if !isSiteBlock(previousSite) {
+			continue
+		}
+		site := strings.Join(previousSite.Keys, " ")
+		nextSite, exists := nextSites[site]
+		if !exists {
+			stopUpstreamTraffic(previousSite)
+			nextBlock.AddBlock(previousSite)
+			removed = append(removed, site)
+			continue
+		}
+
+		nextRoutes := map[string]bool{}
+		for _, directive := range nextSite.Children {
+			if route := getDirectiveRoute(directive); route != "" {
+				nextRoutes[route] = true
+			}
+		}
+		for _, directive := range previousSite.Children {
+			route := getDirectiveRoute(directive)
+			if route == "" || nextRoutes[route] {
+				continue
+			}
+			stopUpstreamTraffic(directive)
+			nextSite.AddBlock(directive)
+			addMissingMatchers(previousSite, nextSite, directive)
+			removed = append(removed, site+" "+route)
+		}
+	}
+
+	if len(removed) == 0 {
+		return next, removed, nil
+	}
+	return nextBlock.Marshal(), removed, nil
+}
+
+func isSiteBlock(block *caddyfile.Block) bool {
+	return !block.IsGlobalBlock() && !block.IsSnippet() && !block.IsMatcher()
+}
+
+// getDirectiveRoute identifies route directives of a site like getRouteKeys,
+// returning empty for other directives
+func getDirectiveRoute(directive *caddyfile.Block) string {
+	switch directive.GetFirstKey() {
+	case "reverse_proxy", "php_fastcgi":
+		matcher := "*"
+		if len(directive.Keys) > 1 && isRouteMatcher(directive.Keys[1]) {
+			matcher = directive.Keys[1]
+		}
+		return directive.GetFirstKey() + " " + matcher
+	case "route", "handle", "handle_path":
+		return strings.Join(directive.Keys, " ")
+	}
+	return ""
+}
+
+// stopUpstreamTraffic removes the upstreams of the reverse_proxy and php_fastcgi directives
+// of block, keeping their matchers. Proxies without upstreams respond 503 to new requests
+func stopUpstreamTraffic(block *caddyfile.Block) {
+	switch block.GetFirstKey() {
+	case "reverse_proxy", "php_fastcgi":
+		keys := []string{block.GetFirstKey()}
+		if len(block.Keys) > 1 && isRouteMatcher(block.Keys[1]) {
+			keys = append(keys, block.Keys[1])
+		}
+		block.Keys = keys
+		block.Children = []*caddyfile.Block{}
+		return
+	}
+	for _, child := range block.Children {
+		stopUpstreamTraffic(child)
+	}
+}
+
+// addMissingMatchers copies to nextSite the named matchers of previousSite used by directive
+func addMissingMatchers(previousSite *caddyfile.Block, nextSite *caddyfile.Block, directive *caddyfile.Block) {
+	for _, key := range directive.Keys[1:] {
+		if !strings.HasPrefix(key, "@") || len(nextSite.GetAllByFirstKey(key)) > 0 {
+			continue
+		}
+		for _, matcher := range previousSite.GetAllByFirstKey(key) {
+			nextSite.AddBlock(matcher)
+		}
+	}
+}
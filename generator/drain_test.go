@@ -0,0 +1,91 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepRemovedRoutes(t *testing.T) {
+	const previous = "{\n" +
+		"	email admin@example.com\n" +
+		"}\n" +
+		"api.example.com {\n" +
+		"	@admin path /admin/*\n" +
+		"	reverse_proxy @admin 10.0.0.5:80\n" +
+		"	reverse_proxy 10.0.0.1:80 10.0.0.2:80\n" +
+		"}\n" +
+		"old.example.com {\n" +
+		"	reverse_proxy 10.0.0.3:80\n" +
+		"}\n"
+	const next = "{\n" +
+		"	email admin@example.com\n" +
+		"}\n" +
+		"api.example.com {\n" +
+		"	reverse_proxy 10.0.0.1:80\n" +
+		"}\n" +
+		"new.example.com {\n" +
+		"	reverse_proxy 10.0.0.4:80\n" +
+		"}\n"
+
+	drained, removed, err := KeepRemovedRoutes([]byte(previous), []byte(next))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "{\n"+
+		"	email admin@example.com\n"+
+		"}\n"+
+		"api.example.com {\n"+
+		"	@admin path /admin/*\n"+
+		"	reverse_proxy 10.0.0.1:80\n"+
+		"	reverse_proxy @admin\n"+
+		"}\n"+
+		"new.example.com {\n"+
+		"	reverse_proxy 10.0.0.4:80\n"+
+		"}\n"+
+		"old.example.com {\n"+
+		"	reverse_proxy\n"+
+		"}\n", string(drained))
+	assert.Equal(t, []string{"api.example.com reverse_proxy @admin", "old.example.com"}, removed)
+}
+
+func TestKeepRemovedRoutes_NothingRemoved(t *testing.T) {
+	const previous = "api.example.com {\n" +
+		"	reverse_proxy 10.0.0.1:80 10.0.0.2:80\n" +
+		"}\n"
+	const next = "api.example.com {\n" +
+		"	reverse_proxy 10.0.0.1:80\n" +
+		"}\n"
+
+	drained, removed, err := KeepRemovedRoutes([]byte(previous), []byte(next))
+
+	assert.NoError(t, err)
+	assert.Equal(t, next, string(drained))
+	assert.Empty(t, removed)
+}
+
+func TestKeepRemovedRoutes_StopsUpstreamTraffic(t *testing.T) {
+	const previous = "app.example.com {\n" +
+		"	handle /api/* {\n" +
+		"		reverse_proxy 10.0.0.1:80 {\n" +
+		"			to 10.0.0.2:80\n" +
+		"		}\n" +
+		"	}\n" +
+		"	php_fastcgi /blog/* 10.0.0.3:9000\n" +
+		"	reverse_proxy 10.0.0.4:80\n" +
+		"}\n"
+	const next = "app.example.com {\n" +
+		"	reverse_proxy 10.0.0.4:80\n" +
+		"}\n"
+
+	drained, removed, err := KeepRemovedRoutes([]byte(previous), []byte(next))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "app.example.com {\n"+
+		"	handle /api/* {\n"+
+		"		reverse_proxy\n"+
+		"	}\n"+
+		"	reverse_proxy 10.0.0.4:80\n"+
+		"	php_fastcgi /blog/*\n"+
+		"}\n", string(drained))
+	assert.Equal(t, []string{"app.example.com handle /api/*", "app.example.com php_fastcgi /blog/*"}, removed)
+}
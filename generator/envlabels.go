@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"go.uber.org/zap"
+)
+
+// withEnvLabels returns the container with caddy labels read from its environment variables,
+// named like labels, when FallbackToEnv is enabled and it has no caddy labels. Environment
+// variables can't change without recreating a container, so they are inspected once per container
+func (g *CaddyfileGenerator) withEnvLabels(ctx context.Context, clientIndex int, dockerClient docker.Client, container types.Container, envLabels map[string]map[string]string, logger *zap.Logger) types.Container {
+	if !g.options.FallbackToEnv || len(g.filterLabels(container.Labels)) > 0 {
+		return container
+	}
+
+	key := envLabelsKey(clientIndex, container.ID)
+	caddyEnv, cached := g.envLabels[key]
+	if !cached {
+		containerJSON, err := dockerClient.ContainerInspect(ctx, container.ID)
+		if err != nil {
+			g.logDockerError(logger, "Failed to inspect container environment", "containers", err, zap.String("container", container.ID))
+			return container
+		}
+		caddyEnv = map[string]string{}
+		if containerJSON.Config != nil {
+			for _, variable := range containerJSON.Config.Env {
+				if name, value, found := strings.Cut(variable, "="); found && g.labelRegex.MatchString(name) {
+					caddyEnv[name] = value
+				}
+			}
+		}
+	}
+	envLabels[key] = caddyEnv
+	if len(caddyEnv) == 0 {
+		return container
+	}
+
+	labels := make(map[string]string, len(container.Labels)+len(caddyEnv))
+	for name, value := range container.Labels {
+		labels[name] = value
+	}
+	for name, value := range caddyEnv {
+		labels[name] = value
+	}
+	container.Labels = labels
+	return container
+}
+
+func envLabelsKey(clientIndex int, containerID string) string {
+	return fmt.Sprintf("%d/%s", clientIndex, containerID)
+}
@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// containerInspectCounter counts inspects of each container
+type containerInspectCounter struct {
+	*docker.ClientMock
+	inspects map[string]int
+}
+
+func (mock *containerInspectCounter) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	mock.inspects[containerID]++
+	return mock.ClientMock.ContainerInspect(ctx, containerID)
+}
+
+func createEnvDockerClientMock() *docker.ClientMock {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("ENV-CONTAINER", "172.17.0.2", map[string]string{
+			"maintainer": "someone",
+		}),
+		createContainer("LABELED-CONTAINER", "172.17.0.3", map[string]string{
+			fmtLabel("%s"):               "labeled.example.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 8080}}",
+		}),
+	}
+	env := []string{
+		"PATH=/usr/bin",
+		fmtLabel("%s") + "=env.example.com",
+		fmtLabel("%s.reverse_proxy") + "={{upstreams 80}}",
+		"CADDY_LIKE=not a label",
+	}
+	dockerClient.ContainerInspectData["ENV-CONTAINER"] = types.ContainerJSON{Config: &container.Config{Env: env}}
+	dockerClient.ContainerInspectData["LABELED-CONTAINER"] = types.ContainerJSON{Config: &container.Config{Env: []string{
+		fmtLabel("%s") + "=ignored.example.com",
+	}}}
+	return dockerClient
+}
+
+func TestContainers_FallbackToEnv(t *testing.T) {
+	// Labels win over environment variables
+	const expectedCaddyfile = "env.example.com {\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"}\n" +
+		"labeled.example.com {\n" +
+		"	reverse_proxy 172.17.0.3:8080\n" +
+		"}\n"
+
+	testGeneration(t, createEnvDockerClientMock(), func(options *config.Options) {
+		options.FallbackToEnv = true
+	}, expectedCaddyfile, commonLogs)
+}
+
+func TestContainers_FallbackToEnvDisabled(t *testing.T) {
+	const expectedCaddyfile = "labeled.example.com {\n" +
+		"	reverse_proxy 172.17.0.3:8080\n" +
+		"}\n"
+
+	testGeneration(t, createEnvDockerClientMock(), nil, expectedCaddyfile, commonLogs)
+}
+
+func TestContainers_FallbackToEnvInspectsOnce(t *testing.T) {
+	dockerClient := &containerInspectCounter{ClientMock: createEnvDockerClientMock(), inspects: map[string]int{}}
+	options := &config.Options{LabelPrefix: DefaultLabelPrefix, FallbackToEnv: true}
+	generator := CreateGenerator([]docker.Client{dockerClient}, createDockerUtilsMock(), options)
+
+	for i := 0; i < 3; i++ {
+		caddyfile, _, err := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+		assert.NoError(t, err)
+		assert.Contains(t, string(caddyfile), "env.example.com")
+	}
+
+	assert.Equal(t, 1, dockerClient.inspects["ENV-CONTAINER"])
+	assert.Equal(t, 0, dockerClient.inspects["LABELED-CONTAINER"])
+}
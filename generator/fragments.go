@@ -0,0 +1,83 @@
+package generator
+
+import (
+	"math"
+	"strings"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"go.uber.org/zap"
+)
+
+// siteFragments holds the directives added to every site generated from labels
+type siteFragments struct {
+	prelude  []*caddyfile.Block
+	postlude []*caddyfile.Block
+}
+
+// getSiteFragments parses the global site prelude and postlude options.
+// Fragments that fail to parse are logged and ignored
+func (g *CaddyfileGenerator) getSiteFragments(logger *zap.Logger) *siteFragments {
+	fragments := &siteFragments{}
+	prelude, err := parseSiteFragment(g.options.GlobalSitePrelude, math.MinInt)
+	if err != nil {
+		logger.Error("Failed to parse global site prelude", zap.Error(err))
+	} else {
+		fragments.prelude = prelude
+	}
+	postlude, err := parseSiteFragment(g.options.GlobalSitePostlude, math.MaxInt)
+	if err != nil {
+		logger.Error("Failed to parse global site postlude", zap.Error(err))
+	} else {
+		fragments.postlude = postlude
+	}
+	return fragments
+}
+
+// parseSiteFragment parses the directives of a caddyfile fragment, ordering them before or
+// after label directives, which are sorted by their order suffix and then by name
+func parseSiteFragment(fragment string, order int) ([]*caddyfile.Block, error) {
+	if strings.TrimSpace(fragment) == "" {
+		return nil, nil
+	}
+	container, err := caddyfile.Unmarshal([]byte("fragment {\n" + fragment + "\n}"))
+	if err != nil {
+		return nil, err
+	}
+	directives := []*caddyfile.Block{}
+	for _, block := range container.Children {
+		for _, directive := range block.Children {
+			directive.Order = order
+			directives = append(directives, directive)
+		}
+	}
+	return directives, nil
+}
+
+// addTo adds the prelude and postlude directives to all sites of a container or service
+func (fragments *siteFragments) addTo(container *caddyfile.Container) {
+	if len(fragments.prelude) == 0 && len(fragments.postlude) == 0 {
+		return
+	}
+	for _, block := range container.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		for _, directive := range fragments.prelude {
+			block.AddBlock(cloneBlock(directive))
+		}
+		for _, directive := range fragments.postlude {
+			block.AddBlock(cloneBlock(directive))
+		}
+	}
+}
+
+// cloneBlock deep copies a block, so sites merged later don't share directives
+func cloneBlock(block *caddyfile.Block) *caddyfile.Block {
+	clone := caddyfile.CreateBlock()
+	clone.Order = block.Order
+	clone.AddKeys(block.Keys...)
+	for _, child := range block.Children {
+		clone.AddBlock(cloneBlock(child))
+	}
+	return clone
+}
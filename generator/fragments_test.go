@@ -0,0 +1,82 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+)
+
+func TestSiteFragments_AddedToEverySite(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("a", "172.17.0.2", map[string]string{
+			fmtLabel("%s"):               "a.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s.header"):        "X-Service a",
+		}),
+		createContainer("b", "172.17.0.3", map[string]string{
+			fmtLabel("%s"):               "b.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s.header"):        "X-Service b",
+		}),
+		createContainer("c", "172.17.0.4", map[string]string{
+			fmtLabel("%s"):               "b.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s.header"):        "X-Service c",
+		}),
+	}
+
+	const expectedCaddyfile = "a.testdomain.com {\n" +
+		"	header X-Request-ID {http.request.uuid}\n" +
+		"	log {\n" +
+		"		format json\n" +
+		"	}\n" +
+		"	header X-Service a\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"	header -Server\n" +
+		"}\n" +
+		"b.testdomain.com {\n" +
+		"	header X-Request-ID {http.request.uuid}\n" +
+		"	log {\n" +
+		"		format json\n" +
+		"	}\n" +
+		"	header X-Service b\n" +
+		"	header X-Service c\n" +
+		"	reverse_proxy 172.17.0.3:80 172.17.0.4:80\n" +
+		"	header -Server\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`WARN	Route collision	{"route": "b.testdomain.com *", "owner": "container/b", "colliding": "container/c"}` + newLine
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.GlobalSitePrelude = "header X-Request-ID {http.request.uuid}\nlog {\n\tformat json\n}"
+		options.GlobalSitePostlude = "header -Server"
+	}, expectedCaddyfile, expectedLogs)
+}
+
+func TestSiteFragments_InvalidFragment(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("a", "172.17.0.2", map[string]string{
+			fmtLabel("%s"):               "a.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s.header"):        "X-Service a",
+		}),
+	}
+
+	const expectedCaddyfile = "a.testdomain.com {\n" +
+		"	header X-Service a\n" +
+		"	reverse_proxy 172.17.0.2:80\n" +
+		"	header -Server\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`ERROR	Failed to parse global site prelude	{"error": "Unexpected token '}' at line 3"}` + newLine
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.GlobalSitePrelude = "}"
+		options.GlobalSitePostlude = "header -Server"
+	}, expectedCaddyfile, expectedLogs)
+}
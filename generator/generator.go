@@ -3,13 +3,19 @@ package generator
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
 	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
@@ -23,6 +29,15 @@ const DefaultLabelPrefix = "caddy"
 
 const IngressNetworkLabel = "caddy_ingress_network"
 
+// IngressNetworksLabel lists, on the caddy container, additional ingress networks
+const IngressNetworksLabel = "caddy_ingress_networks"
+
+// ForceRefreshLabel marks containers and services whose config must be pushed on every update
+const ForceRefreshLabel = "caddy_force_refresh"
+
+// EmptyCaddyfile is generated when there is nothing to configure
+const EmptyCaddyfile = "# Empty caddyfile"
+
 const swarmAvailabilityCacheInterval = 1 * time.Minute
 
 // CaddyfileGenerator generates caddyfile from docker configuration
@@ -32,13 +47,47 @@ type CaddyfileGenerator struct {
 	dockerClients        []docker.Client
 	dockerUtils          docker.Utils
 	ingressNetworks      map[string]bool
+	ingressNetworksMutex sync.RWMutex
+	ingressNetworksStale atomic.Bool
 	swarmIsAvailable     []bool
 	swarmIsAvailableTime time.Time
+	routeSources         []RouteSource
+	forcedRefresh        []string
+	seenSources          map[string]*seenSource
+	inventory            []InventoryRoute
+	inventoryMutex       sync.RWMutex
+	inspectCaches        []*inspectCache
+	scanFilters          filters.Args
+	envLabels            map[string]map[string]string
+	permissionErr        error
 }
 
 // CreateGenerator creates a new generator
 func CreateGenerator(dockerClients []docker.Client, dockerUtils docker.Utils, options *config.Options) *CaddyfileGenerator {
-	var labelRegexString = fmt.Sprintf("^%s(_\\d+)?(\\.|$)", options.LabelPrefix)
+	prefixes := []string{}
+	for _, prefix := range LabelPrefixes(options) {
+		prefixes = append(prefixes, regexp.QuoteMeta(prefix))
+	}
+	var labelRegexString = fmt.Sprintf("^(?:%s)(_\\d+)?(\\.|$)", strings.Join(prefixes, "|"))
+
+	routeSources := []RouteSource{}
+	for _, path := range options.ExtraRouteSources {
+		routeSources = append(routeSources, CreateFileRouteSource(path))
+	}
+
+	var inspectCaches []*inspectCache
+	if options.InspectCacheTTL > 0 {
+		for range dockerClients {
+			inspectCaches = append(inspectCaches, newInspectCache(options.InspectCacheTTL))
+		}
+	}
+
+	scanFilters := filters.NewArgs()
+	for _, filter := range options.ScanFilters {
+		if key, value, found := strings.Cut(filter, "="); found {
+			scanFilters.Add(key, value)
+		}
+	}
 
 	return &CaddyfileGenerator{
 		options:          options,
@@ -46,29 +95,71 @@ func CreateGenerator(dockerClients []docker.Client, dockerUtils docker.Utils, op
 		dockerClients:    dockerClients,
 		swarmIsAvailable: make([]bool, len(dockerClients)),
 		dockerUtils:      dockerUtils,
+		routeSources:     routeSources,
+		seenSources:      map[string]*seenSource{},
+		inspectCaches:    inspectCaches,
+		scanFilters:      scanFilters,
 	}
 }
 
-// GenerateCaddyfile generates a caddy file config from docker metadata
-func (g *CaddyfileGenerator) GenerateCaddyfile(logger *zap.Logger) ([]byte, []string) {
+// IsCaddyLabel checks whether label is a caddy label, starting with one of the label prefixes
+func (g *CaddyfileGenerator) IsCaddyLabel(label string) bool {
+	return g.labelRegex.MatchString(label)
+}
+
+// LabelPrefixes returns the label prefixes of caddy labels, LabelPrefix followed by ExtraLabelPrefixes
+func LabelPrefixes(options *config.Options) []string {
+	prefixes := []string{options.LabelPrefix}
+	for _, prefix := range options.ExtraLabelPrefixes {
+		if prefix = strings.TrimSpace(prefix); prefix != "" && prefix != options.LabelPrefix {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// GenerateCaddyfile generates a caddy file config from docker metadata. When ctx is done before
+// all docker metadata is fetched, or docker API refuses a request and permission errors aren't
+// tolerated, it returns an error instead of a partial config
+func (g *CaddyfileGenerator) GenerateCaddyfile(ctx context.Context, logger *zap.Logger) ([]byte, []string, error) {
 	var caddyfileBuffer bytes.Buffer
+	g.permissionErr = nil
 
-	if g.ingressNetworks == nil {
-		ingressNetworks, err := g.getIngressNetworks(logger)
+	for _, dockerClient := range g.dockerClients {
+		if cycleCache, ok := dockerClient.(docker.CycleCache); ok {
+			cycleCache.StartCycle()
+		}
+	}
+
+	if stale := g.ingressNetworksStale.Swap(false); g.ingressNetworks == nil || stale {
+		ingressNetworks, err := g.getIngressNetworks(ctx, logger)
 		if err == nil {
+			g.ingressNetworksMutex.Lock()
 			g.ingressNetworks = ingressNetworks
+			g.ingressNetworksMutex.Unlock()
 		} else {
 			logger.Error("Failed to get ingress networks", zap.Error(err))
+			g.ingressNetworksStale.Store(stale)
 		}
 	}
 
 	if time.Since(g.swarmIsAvailableTime) > swarmAvailabilityCacheInterval {
-		g.checkSwarmAvailability(logger, time.Time.IsZero(g.swarmIsAvailableTime))
-		g.swarmIsAvailableTime = time.Now()
+		g.checkSwarmAvailability(ctx, logger, time.Time.IsZero(g.swarmIsAvailableTime))
+		if ctx.Err() == nil {
+			g.swarmIsAvailableTime = time.Now()
+		}
 	}
 
 	caddyfileBlock := caddyfile.CreateContainer()
 	controlledServers := []string{}
+	forcedRefresh := []string{}
+	seenSources := map[string]bool{}
+	routeOwners := map[string]string{}
+	tlsOwners := map[string]*tlsOwner{}
+	inventory := []InventoryRoute{}
+	siteFragments := g.getSiteFragments(logger)
+	accessLog := g.getAccessLogDirective()
+	envLabels := map[string]map[string]string{}
 
 	// Add caddyfile from path
 	if g.options.CaddyfilePath != "" {
@@ -76,6 +167,9 @@ func (g *CaddyfileGenerator) GenerateCaddyfile(logger *zap.Logger) ([]byte, []st
 		if err != nil {
 			logger.Error("Failed to read Caddyfile", zap.String("path", g.options.CaddyfilePath), zap.Error(err))
 		} else {
+			if g.options.ExpandCaddyfileEnv {
+				dat = caddyfile.ExpandEnv(dat)
+			}
 			block, err := caddyfile.Unmarshal(dat)
 			if err != nil {
 				logger.Error("Failed to parse Caddyfile", zap.String("path", g.options.CaddyfilePath), zap.Error(err))
@@ -91,35 +185,45 @@ func (g *CaddyfileGenerator) GenerateCaddyfile(logger *zap.Logger) ([]byte, []st
 
 		// Add Caddyfile from swarm configs
 		if g.swarmIsAvailable[i] {
-			configs, err := dockerClient.ConfigList(context.Background(), types.ConfigListOptions{})
+			configs, err := dockerClient.ConfigList(ctx, types.ConfigListOptions{})
 			if err == nil {
+				caddyConfigs := []swarm.Config{}
 				for _, config := range configs {
-					if _, hasLabel := config.Spec.Labels[g.options.LabelPrefix]; hasLabel {
-						fullConfig, _, err := dockerClient.ConfigInspectWithRaw(context.Background(), config.ID)
-						if err != nil {
-							logger.Error("Failed to inspect Swarm Config", zap.String("config", config.Spec.Name), zap.Error(err))
+					for _, prefix := range LabelPrefixes(g.options) {
+						if _, hasLabel := config.Spec.Labels[prefix]; hasLabel {
+							caddyConfigs = append(caddyConfigs, config)
+							break
+						}
+					}
+				}
+				fullConfigs, errs := g.inspectConfigs(ctx, i, dockerClient, caddyConfigs)
+				for index, config := range caddyConfigs {
+					fullConfig, err := fullConfigs[index], errs[index]
+					if err != nil {
+						g.logDockerError(logger, "Failed to inspect Swarm Config", "configs", err, zap.String("config", config.Spec.Name))
 
+					} else {
+						block, err := caddyfile.Unmarshal(fullConfig.Spec.Data)
+						if err != nil {
+							logger.Error("Failed to parse Swarm Config caddyfile format", zap.String("config", config.Spec.Name), zap.Error(err))
 						} else {
-							block, err := caddyfile.Unmarshal(fullConfig.Spec.Data)
-							if err != nil {
-								logger.Error("Failed to parse Swarm Config caddyfile format", zap.String("config", config.Spec.Name), zap.Error(err))
-							} else {
-								caddyfileBlock.Merge(block)
-							}
+							caddyfileBlock.Merge(block)
 						}
 					}
 				}
 			} else {
-				logger.Error("Failed to get Swarm configs", zap.Error(err))
+				g.logDockerError(logger, "Failed to get Swarm configs", "configs", err)
 			}
 		} else {
 			logger.Debug("Skipping swarm config caddyfiles because swarm is not available")
 		}
 
 		// Add containers
-		containers, err := dockerClient.ContainerList(context.Background(), types.ContainerListOptions{All: g.options.ScanStoppedContainers})
+		containers, err := dockerClient.ContainerList(ctx, types.ContainerListOptions{All: g.options.ScanStoppedContainers, Filters: g.scanFilters})
 		if err == nil {
+			sortContainers(containers)
 			for _, container := range containers {
+				container = g.withEnvLabels(ctx, i, dockerClient, container, envLabels, logger)
 				if _, isControlledServer := container.Labels[g.options.ControlledServersLabel]; isControlledServer {
 					ips, err := g.getContainerIPAddresses(&container, logger, false)
 					if err != nil {
@@ -134,24 +238,57 @@ func (g *CaddyfileGenerator) GenerateCaddyfile(logger *zap.Logger) ([]byte, []st
 				}
 				containerCaddyfile, err := g.getContainerCaddyfile(&container, logger)
 				if err == nil {
+					applySitePort(container.Labels, containerCaddyfile, logger)
+					applyVariant(container.Labels, containerCaddyfile, logger)
+					g.filterAllowedHostnames(containerCaddyfile, getContainerRouteOwner(&container), logger)
+				}
+				if err == nil && g.options.NamespaceMatchers {
+					namespaceMatchers(containerCaddyfile, getContainerRouteOwner(&container))
+				}
+				if err == nil && !g.checkRouteCollisions(routeOwners, getContainerRouteOwner(&container), containerCaddyfile, logger) {
+					continue
+				}
+				if err == nil && !g.checkTLSConflicts(tlsOwners, getContainerRouteOwner(&container), containerCaddyfile, logger) {
+					continue
+				}
+				if err == nil {
+					if isForcedRefresh(container.Labels) {
+						forcedRefresh = append(forcedRefresh, container.ID)
+					}
+					if g.options.TerminalRoutes {
+						makeRoutesTerminal(containerCaddyfile)
+					}
+					siteFragments.addTo(containerCaddyfile)
+					addAccessLog(containerCaddyfile, accessLog)
+					applyHTTPSRedirect(container.Labels, containerCaddyfile, logger)
+					if g.options.AutoHSTS {
+						addHSTS(container.Labels, containerCaddyfile, logger)
+					}
+					inventory = append(inventory, getInventoryRoutes(getContainerInventorySource(&container), containerCaddyfile)...)
+					g.trackSource("container/"+container.ID, containerCaddyfile, seenSources)
 					caddyfileBlock.Merge(containerCaddyfile)
+				} else if errors.Is(err, errNoExposedPorts) && g.options.OnNoExposedPorts == config.NoExposedPortsSkip {
+					logger.Warn("Skipping container without exposed ports", zap.String("container", container.ID))
+				} else if errors.Is(err, errNoExposedPorts) {
+					logger.Error("Container has no exposed ports", zap.String("container", container.ID))
 				} else {
 					logger.Error("Failed to get Container Caddyfile", zap.String("container", container.ID), zap.Error(err))
 				}
 			}
 		} else {
-			logger.Error("Failed to get ContainerList", zap.Error(err))
+			g.logDockerError(logger, "Failed to get ContainerList", "containers", err)
 		}
 
 		// Add services
 		if g.swarmIsAvailable[i] {
-			services, err := dockerClient.ServiceList(context.Background(), types.ServiceListOptions{})
+			services, err := dockerClient.ServiceList(ctx, types.ServiceListOptions{Filters: g.scanFilters})
 			if err == nil {
+				sortServices(services)
 				for _, service := range services {
 					logger.Debug("Swarm service", zap.String("service", service.Spec.Name))
 
 					if _, isControlledServer := service.Spec.Labels[g.options.ControlledServersLabel]; isControlledServer {
-						ips, err := g.getServiceTasksIps(&service, logger, false)
+						ips, err := g.getServiceTasksIps(ctx, &service, logger, false)
 						if err != nil {
 							logger.Error("Failed to  get Swarm service IPs", zap.String("service", service.Spec.Name), zap.Error(err))
 						} else {
@@ -164,21 +301,71 @@ func (g *CaddyfileGenerator) GenerateCaddyfile(logger *zap.Logger) ([]byte, []st
 					}
 
 					// caddy. labels based config
-					serviceCaddyfile, err := g.getServiceCaddyfile(&service, logger)
+					serviceCaddyfile, err := g.getServiceCaddyfile(ctx, &service, logger)
 					if err == nil {
+						applySitePort(service.Spec.Labels, serviceCaddyfile, logger)
+						applyVariant(service.Spec.Labels, serviceCaddyfile, logger)
+						g.filterAllowedHostnames(serviceCaddyfile, "service/"+service.Spec.Name, logger)
+					}
+					if err == nil && g.options.NamespaceMatchers {
+						namespaceMatchers(serviceCaddyfile, "service/"+service.Spec.Name)
+					}
+					if err == nil && !g.checkRouteCollisions(routeOwners, "service/"+service.Spec.Name, serviceCaddyfile, logger) {
+						continue
+					}
+					if err == nil && !g.checkTLSConflicts(tlsOwners, "service/"+service.Spec.Name, serviceCaddyfile, logger) {
+						continue
+					}
+					if err == nil {
+						if isForcedRefresh(service.Spec.Labels) {
+							forcedRefresh = append(forcedRefresh, service.Spec.Name)
+						}
+						if g.options.TerminalRoutes {
+							makeRoutesTerminal(serviceCaddyfile)
+						}
+						siteFragments.addTo(serviceCaddyfile)
+						addAccessLog(serviceCaddyfile, accessLog)
+						applyHTTPSRedirect(service.Spec.Labels, serviceCaddyfile, logger)
+						if g.options.AutoHSTS {
+							addHSTS(service.Spec.Labels, serviceCaddyfile, logger)
+						}
+						inventory = append(inventory, getInventoryRoutes("service/"+service.Spec.Name, serviceCaddyfile)...)
+						g.trackSource("service/"+service.ID, serviceCaddyfile, seenSources)
 						caddyfileBlock.Merge(serviceCaddyfile)
 					} else {
 						logger.Error("Failed to get Swarm service caddyfile", zap.String("service", service.Spec.Name), zap.Error(err))
 					}
 				}
 			} else {
-				logger.Error("Failed to get Swarm services", zap.Error(err))
+				g.logDockerError(logger, "Failed to get Swarm services", "services", err)
 			}
 		} else {
 			logger.Debug("Skipping swarm services because swarm is not available")
 		}
 	}
 
+	// Don't generate a partial config when docker metadata couldn't be fetched in time
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if g.permissionErr != nil {
+		return nil, nil, fmt.Errorf("docker API permission denied: %w", g.permissionErr)
+	}
+
+	// Keep routes of removed containers and services during grace period
+	g.mergeRemovedSources(caddyfileBlock, seenSources, logger)
+
+	// Add routes from non docker sources
+	inventory = append(inventory, g.mergeRouteSources(caddyfileBlock, logger)...)
+
+	if g.options.ServerHeader != nil {
+		applyServerHeader(caddyfileBlock, *g.options.ServerHeader)
+	}
+
+	if g.options.ProxyServiceTasks {
+		sortUpstreams(caddyfileBlock)
+	}
+
 	// Write global blocks first
 	globalCaddyfile := caddyfile.CreateContainer()
 	for _, block := range caddyfileBlock.Children {
@@ -203,26 +390,48 @@ func (g *CaddyfileGenerator) GenerateCaddyfile(logger *zap.Logger) ([]byte, []st
 	}
 
 	if len(caddyfileContent) == 0 {
-		caddyfileContent = []byte("# Empty caddyfile")
+		caddyfileContent = []byte(EmptyCaddyfile)
 	}
 
 	if g.options.Mode&config.Server == config.Server {
 		controlledServers = append(controlledServers, "localhost")
 	}
 
-	return caddyfileContent, controlledServers
+	g.forcedRefresh = forcedRefresh
+	g.envLabels = envLabels
+	g.setInventory(inventory)
+
+	return caddyfileContent, controlledServers, nil
+}
+
+// ForcedRefresh returns the containers and services from the last generation
+// that require their config to be pushed even when the Caddyfile is unchanged
+func (g *CaddyfileGenerator) ForcedRefresh() []string {
+	return g.forcedRefresh
+}
+
+func isForcedRefresh(labels map[string]string) bool {
+	value, hasLabel := labels[ForceRefreshLabel]
+	if !hasLabel {
+		return false
+	}
+	forced, err := strconv.ParseBool(value)
+	return err == nil && forced
 }
 
-func (g *CaddyfileGenerator) checkSwarmAvailability(logger *zap.Logger, isFirstCheck bool) {
+func (g *CaddyfileGenerator) checkSwarmAvailability(ctx context.Context, logger *zap.Logger, isFirstCheck bool) {
 
 	for i, dockerClient := range g.dockerClients {
-		info, err := dockerClient.Info(context.Background())
+		info, err := dockerClient.Info(ctx)
 		if err == nil {
 			newSwarmIsAvailable := info.Swarm.LocalNodeState == swarm.LocalNodeStateActive
 			if isFirstCheck || newSwarmIsAvailable != g.swarmIsAvailable[i] {
 				logger.Info("Swarm is available", zap.Bool("new", newSwarmIsAvailable))
 			}
 			g.swarmIsAvailable[i] = newSwarmIsAvailable
+		} else if ctx.Err() != nil {
+			// Keep the last known availability, checking again on next generation
+			return
 		} else {
 			logger.Error("Swarm availability check failed", zap.Error(err))
 			g.swarmIsAvailable[i] = false
@@ -230,12 +439,35 @@ func (g *CaddyfileGenerator) checkSwarmAvailability(logger *zap.Logger, isFirstC
 	}
 }
 
-func (g *CaddyfileGenerator) getIngressNetworks(logger *zap.Logger) (map[string]bool, error) {
+// IsIngressNetwork checks whether the network with id and name is an ingress network. Networks
+// named in IngressNetworks are ingress networks even before being created, and any network
+// may be one before ingress networks of the controller container are known
+func (g *CaddyfileGenerator) IsIngressNetwork(id string, name string) bool {
+	for _, ingressNetwork := range g.options.IngressNetworks {
+		if name == ingressNetwork {
+			return true
+		}
+	}
+	g.ingressNetworksMutex.RLock()
+	defer g.ingressNetworksMutex.RUnlock()
+	if g.ingressNetworks == nil {
+		return len(g.options.IngressNetworks) == 0
+	}
+	return g.ingressNetworks[id] || g.ingressNetworks[name]
+}
+
+// InvalidateIngressNetworks makes the next generation look up ingress networks again,
+// picking up IDs of ingress networks created since the last lookup
+func (g *CaddyfileGenerator) InvalidateIngressNetworks() {
+	g.ingressNetworksStale.Store(true)
+}
+
+func (g *CaddyfileGenerator) getIngressNetworks(ctx context.Context, logger *zap.Logger) (map[string]bool, error) {
 	ingressNetworks := map[string]bool{}
 
 	for _, dockerClient := range g.dockerClients {
 		if len(g.options.IngressNetworks) > 0 {
-			networks, err := dockerClient.NetworkList(context.Background(), types.NetworkListOptions{})
+			networks, err := dockerClient.NetworkList(ctx, types.NetworkListOptions{})
 			if err != nil {
 				return nil, err
 			}
@@ -256,13 +488,13 @@ func (g *CaddyfileGenerator) getIngressNetworks(logger *zap.Logger) (map[string]
 				return nil, err
 			}
 			logger.Info("Caddy ContainerID", zap.String("ID", containerID))
-			container, err := dockerClient.ContainerInspect(context.Background(), containerID)
+			container, err := dockerClient.ContainerInspect(ctx, containerID)
 			if err != nil {
 				return nil, err
 			}
 
 			for _, network := range container.NetworkSettings.Networks {
-				networkInfo, err := dockerClient.NetworkInspect(context.Background(), network.NetworkID, types.NetworkInspectOptions{})
+				networkInfo, err := dockerClient.NetworkInspect(ctx, network.NetworkID, types.NetworkInspectOptions{})
 				if err != nil {
 					return nil, err
 				}
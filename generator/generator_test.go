@@ -3,10 +3,14 @@ package generator
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/network"
@@ -94,6 +98,44 @@ func TestMergeConfigContent(t *testing.T) {
 	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
 }
 
+func TestMergeCaddyfileExpandingEnv(t *testing.T) {
+	t.Setenv("SITE_DOMAIN", "example.com")
+	caddyfilePath := filepath.Join(t.TempDir(), "Caddyfile")
+	os.WriteFile(caddyfilePath, []byte(
+		"{$SITE_DOMAIN} {\n"+
+			"	reverse_proxy {$SITE_UPSTREAM:127.0.0.1}\n"+
+			"}\n",
+	), 0666)
+
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "example.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+			},
+		},
+	}
+
+	// The expanded site of the base Caddyfile merges with the generated one
+	const expectedCaddyfile = "example.com {\n" +
+		"	reverse_proxy 127.0.0.1 172.17.0.2\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.CaddyfilePath = caddyfilePath
+		options.ExpandCaddyfileEnv = true
+	}, expectedCaddyfile, commonLogs)
+}
+
 func TestIgnoreLabelsWithoutCaddyPrefix(t *testing.T) {
 	dockerClient := createBasicDockerClientMock()
 	dockerClient.ServicesData = []swarm.Service{
@@ -152,7 +194,7 @@ func testGeneration(
 	writer := bufio.NewWriter(&logsBuffer)
 	logger := zap.New(zapcore.NewCore(encoder, zapcore.AddSync(writer), zapcore.InfoLevel))
 
-	caddyfileBytes, _ := generator.GenerateCaddyfile(logger)
+	caddyfileBytes, _, _ := generator.GenerateCaddyfile(context.Background(), logger)
 	writer.Flush()
 	assert.Equal(t, expectedCaddyfile, string(caddyfileBytes))
 	assert.Equal(t, expectedLogs, logsBuffer.String())
@@ -191,6 +233,42 @@ func createBasicDockerClientMock() *docker.ClientMock {
 	}
 }
 
+// createContainer creates a container with labels in the caddy network
+func createContainer(name string, ip string, labels map[string]string) types.Container {
+	return types.Container{
+		ID:    name,
+		Names: []string{"/" + name},
+		NetworkSettings: &types.SummaryNetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"caddy-network": {
+					IPAddress: ip,
+					NetworkID: caddyNetworkID,
+				},
+			},
+		},
+		Labels: labels,
+	}
+}
+
+// createService creates a service with labels in the caddy network
+func createService(name string, labels map[string]string) swarm.Service {
+	return swarm.Service{
+		Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{
+				Name:   name,
+				Labels: labels,
+			},
+		},
+		Endpoint: swarm.Endpoint{
+			VirtualIPs: []swarm.EndpointVirtualIP{
+				{
+					NetworkID: caddyNetworkID,
+				},
+			},
+		},
+	}
+}
+
 func createDockerUtilsMock() *docker.UtilsMock {
 	return &docker.UtilsMock{
 		MockGetCurrentContainerID: func() (string, error) {
@@ -198,3 +276,127 @@ func createDockerUtilsMock() *docker.UtilsMock {
 		},
 	}
 }
+
+func TestForcedRefresh(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			ID: "FORCED-ID",
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "forced.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+				ForceRefreshLabel:            "true",
+			},
+		},
+		{
+			ID: "REGULAR-ID",
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.3",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "regular.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+				ForceRefreshLabel:            "false",
+			},
+		},
+	}
+
+	options := &config.Options{
+		LabelPrefix: DefaultLabelPrefix,
+	}
+	generator := CreateGenerator([]docker.Client{dockerClient}, createDockerUtilsMock(), options)
+	generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+
+	assert.Equal(t, []string{"FORCED-ID"}, generator.ForcedRefresh())
+}
+
+// hungContainerListClient is a docker client whose container list only returns once ctx is done
+type hungContainerListClient struct {
+	*docker.ClientMock
+}
+
+func (client hungContainerListClient) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGenerateCaddyfile_Canceled(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	options := &config.Options{
+		LabelPrefix: DefaultLabelPrefix,
+	}
+	generator := CreateGenerator([]docker.Client{hungContainerListClient{dockerClient}}, createDockerUtilsMock(), options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	caddyfile, controlledServers, err := generator.GenerateCaddyfile(ctx, zap.NewNop())
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, caddyfile)
+	assert.Nil(t, controlledServers)
+}
+
+func TestGenerateCaddyfile_Deterministic(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	networks := map[string]*network.EndpointSettings{}
+	containerNetworks := map[string]*network.EndpointSettings{}
+	for i, name := range []string{"net-c", "net-a", "net-d", "net-b"} {
+		id := name + "-id"
+		networks[name] = &network.EndpointSettings{NetworkID: id}
+		containerNetworks[name] = &network.EndpointSettings{NetworkID: id, IPAddress: fmt.Sprintf("172.17.0.%d", i+2)}
+		dockerClient.NetworkInspectData[id] = types.NetworkResource{ID: id, Name: name}
+	}
+	dockerClient.ContainerInspectData[caddyContainerID] = types.ContainerJSON{
+		NetworkSettings: &types.NetworkSettings{Networks: networks},
+	}
+	dockerClient.ContainersData = []types.Container{
+		{
+			ID:              "CONTAINER-B",
+			Names:           []string{"/b"},
+			NetworkSettings: &types.SummaryNetworkSettings{Networks: containerNetworks},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "b.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+			},
+		},
+		{
+			ID:              "CONTAINER-A",
+			Names:           []string{"/a"},
+			NetworkSettings: &types.SummaryNetworkSettings{Networks: containerNetworks},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "a.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+			},
+		},
+	}
+
+	options := &config.Options{
+		LabelPrefix: DefaultLabelPrefix,
+	}
+	generator := CreateGenerator([]docker.Client{dockerClient}, createDockerUtilsMock(), options)
+
+	expectedCaddyfile := "a.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.3 172.17.0.5 172.17.0.2 172.17.0.4\n" +
+		"}\n" +
+		"b.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.3 172.17.0.5 172.17.0.2 172.17.0.4\n" +
+		"}\n"
+	for i := 0; i < 20; i++ {
+		caddyfile, _, err := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+		assert.NoError(t, err)
+		assert.Equal(t, expectedCaddyfile, string(caddyfile))
+	}
+}
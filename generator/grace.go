@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"sort"
+	"time"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"go.uber.org/zap"
+)
+
+type seenSource struct {
+	caddyfile []byte
+	lastSeen  time.Time
+}
+
+// trackSource remembers the caddyfile generated for a container or service,
+// so its routes can be kept for a grace period after it disappears
+func (g *CaddyfileGenerator) trackSource(key string, sourceCaddyfile *caddyfile.Container, seen map[string]bool) {
+	if g.options.RouteRemovalGrace <= 0 {
+		return
+	}
+	g.seenSources[key] = &seenSource{
+		caddyfile: sourceCaddyfile.Marshal(),
+		lastSeen:  time.Now(),
+	}
+	seen[key] = true
+}
+
+// mergeRemovedSources merges routes of containers and services that disappeared less than
+// RouteRemovalGrace ago, and forgets the ones that disappeared before that
+func (g *CaddyfileGenerator) mergeRemovedSources(caddyfileBlock *caddyfile.Container, seen map[string]bool, logger *zap.Logger) {
+	keys := []string{}
+	for key := range g.seenSources {
+		if !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		source := g.seenSources[key]
+		if time.Since(source.lastSeen) > g.options.RouteRemovalGrace {
+			logger.Info("Removing routes after grace period", zap.String("source", key))
+			delete(g.seenSources, key)
+			continue
+		}
+		block, err := caddyfile.Unmarshal(source.caddyfile)
+		if err != nil {
+			logger.Error("Failed to parse routes kept during grace period", zap.String("source", key), zap.Error(err))
+			delete(g.seenSources, key)
+			continue
+		}
+		logger.Debug("Keeping routes during grace period", zap.String("source", key), zap.Time("lastSeen", source.lastSeen))
+		caddyfileBlock.Merge(block)
+	}
+}
@@ -0,0 +1,90 @@
+package generator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestGrace_KeepsRemovedContainerRoutes(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			ID: "CONTAINER-ID",
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "service.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+			},
+		},
+	}
+
+	options := &config.Options{
+		LabelPrefix:       DefaultLabelPrefix,
+		RouteRemovalGrace: time.Minute,
+	}
+	generator := CreateGenerator([]docker.Client{dockerClient}, createDockerUtilsMock(), options)
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2\n" +
+		"}\n"
+
+	caddyfile, _, _ := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	assert.Equal(t, expectedCaddyfile, string(caddyfile))
+
+	// Within grace period
+	dockerClient.ContainersData = []types.Container{}
+	caddyfile, _, _ = generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	assert.Equal(t, expectedCaddyfile, string(caddyfile))
+
+	// After grace period
+	generator.seenSources["container/CONTAINER-ID"].lastSeen = time.Now().Add(-2 * time.Minute)
+	caddyfile, _, _ = generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	assert.Equal(t, "# Empty caddyfile", string(caddyfile))
+	assert.Empty(t, generator.seenSources)
+}
+
+func TestGrace_Disabled(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			ID: "CONTAINER-ID",
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "service.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+			},
+		},
+	}
+
+	options := &config.Options{
+		LabelPrefix: DefaultLabelPrefix,
+	}
+	generator := CreateGenerator([]docker.Client{dockerClient}, createDockerUtilsMock(), options)
+	generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+
+	dockerClient.ContainersData = []types.Container{}
+	caddyfile, _, _ := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	assert.Equal(t, "# Empty caddyfile", string(caddyfile))
+}
@@ -0,0 +1,99 @@
+package generator
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"go.uber.org/zap"
+)
+
+// HSTSLabel opts the sites of a container or service out of AutoHSTS when false
+const HSTSLabel = "caddy_hsts"
+
+const hstsHeader = "Strict-Transport-Security"
+const hstsValue = "max-age=31536000"
+const hstsMatcher = "@hsts_https"
+
+// addHSTS adds the HSTS header to sites of a container or service served over HTTPS.
+// Sites also served over HTTP only get it on HTTPS requests, and HTTP only sites never get it
+func addHSTS(labels map[string]string, container *caddyfile.Container, logger *zap.Logger) {
+	if value, hasLabel := labels[HSTSLabel]; hasLabel {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			logger.Warn("Invalid value for label", zap.String("label", HSTSLabel), zap.String("value", value), zap.Error(err))
+		} else if !enabled {
+			return
+		}
+	}
+
+	for _, block := range container.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		hasHTTP, hasHTTPS := getSiteSchemes(block.Keys)
+		if !hasHTTPS || hasHeaderField(block, hstsHeader) {
+			continue
+		}
+		header := caddyfile.CreateBlock()
+		header.AddKeys("header")
+		if hasHTTP {
+			matcher := caddyfile.CreateBlock()
+			matcher.AddKeys(hstsMatcher, "protocol", "https")
+			block.AddBlock(matcher)
+			header.AddKeys(hstsMatcher)
+		}
+		header.AddKeys(hstsHeader, hstsValue)
+		block.AddBlock(header)
+	}
+}
+
+// getSiteSchemes reports whether site addresses are served over HTTP and over HTTPS.
+// Addresses without scheme are served over HTTPS, unless they use port 80 or have no hostname
+func getSiteSchemes(siteKeys []string) (hasHTTP bool, hasHTTPS bool) {
+	for _, key := range siteKeys {
+		address := strings.TrimSpace(strings.TrimSuffix(key, ","))
+		if address == "" {
+			continue
+		}
+		if strings.HasPrefix(address, "http://") {
+			hasHTTP = true
+			continue
+		}
+		if strings.HasPrefix(address, "https://") {
+			hasHTTPS = true
+			continue
+		}
+		if index := strings.Index(address, "/"); index >= 0 {
+			address = address[:index]
+		}
+		host, port := address, ""
+		if h, p, err := net.SplitHostPort(address); err == nil {
+			host, port = h, p
+		}
+		if port == "443" || (host != "" && port != "80") {
+			hasHTTPS = true
+		} else {
+			hasHTTP = true
+		}
+	}
+	return hasHTTP, hasHTTPS
+}
+
+// hasHeaderField reports whether a site has a header directive manipulating field
+func hasHeaderField(site *caddyfile.Block, field string) bool {
+	for _, directive := range site.GetAllByFirstKey("header") {
+		for _, key := range directive.Keys {
+			if strings.EqualFold(strings.TrimLeft(key, "+-?>"), field) {
+				return true
+			}
+		}
+		for _, child := range directive.Children {
+			if strings.EqualFold(strings.TrimLeft(child.GetFirstKey(), "+-?>"), field) {
+				return true
+			}
+		}
+	}
+	return false
+}
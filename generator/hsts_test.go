@@ -0,0 +1,155 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	_ "github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	_ "github.com/caddyserver/caddy/v2/modules/standard"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func enableAutoHSTS(options *config.Options) {
+	options.AutoHSTS = true
+}
+
+func TestHSTS_HTTPSAndHTTPOnlySites(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("secure", map[string]string{
+			fmtLabel("%s"):               "secure.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+		createService("plain", map[string]string{
+			fmtLabel("%s"):               "http://plain.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+		createService("port", map[string]string{
+			fmtLabel("%s"):               ":8080",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+	}
+
+	const expectedCaddyfile = ":8080 {\n" +
+		"	reverse_proxy port:80\n" +
+		"}\n" +
+		"http://plain.testdomain.com {\n" +
+		"	reverse_proxy plain:80\n" +
+		"}\n" +
+		"secure.testdomain.com {\n" +
+		"	header Strict-Transport-Security max-age=31536000\n" +
+		"	reverse_proxy secure:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, enableAutoHSTS, expectedCaddyfile, commonLogs)
+}
+
+func TestHSTS_SiteServedOverBothSchemes(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("internal", map[string]string{
+			fmtLabel("%s"):               "internal.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			HTTPSRedirectLabel:           "false",
+		}),
+	}
+
+	const expectedCaddyfile = "internal.testdomain.com http://internal.testdomain.com {\n" +
+		"	@hsts_https protocol https\n" +
+		"	header @hsts_https Strict-Transport-Security max-age=31536000\n" +
+		"	reverse_proxy internal:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, enableAutoHSTS, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"match":[{"protocol":"https"}]`)
+}
+
+func TestHSTS_RedirectSiteHasNoHeader(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("secure", map[string]string{
+			fmtLabel("%s"):               "secure.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			HTTPSRedirectLabel:           "true",
+		}),
+	}
+
+	const expectedCaddyfile = "http://secure.testdomain.com {\n" +
+		"	redir https://{host}{uri} permanent\n" +
+		"}\n" +
+		"secure.testdomain.com {\n" +
+		"	header Strict-Transport-Security max-age=31536000\n" +
+		"	reverse_proxy secure:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, enableAutoHSTS, expectedCaddyfile, commonLogs)
+}
+
+func TestHSTS_OptOutAndExistingHeader(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("optout", map[string]string{
+			fmtLabel("%s"):               "optout.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			HSTSLabel:                    "false",
+		}),
+		createService("custom", map[string]string{
+			fmtLabel("%s"):               "custom.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s.header"):        "Strict-Transport-Security max-age=60",
+		}),
+	}
+
+	const expectedCaddyfile = "custom.testdomain.com {\n" +
+		"	header Strict-Transport-Security max-age=60\n" +
+		"	reverse_proxy custom:80\n" +
+		"}\n" +
+		"optout.testdomain.com {\n" +
+		"	reverse_proxy optout:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, enableAutoHSTS, expectedCaddyfile, commonLogs)
+}
+
+func TestHSTS_Disabled(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("secure", map[string]string{
+			fmtLabel("%s"):               "secure.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+	}
+
+	const expectedCaddyfile = "secure.testdomain.com {\n" +
+		"	reverse_proxy secure:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+}
+
+func TestGetSiteSchemes(t *testing.T) {
+	tests := []struct {
+		keys     []string
+		hasHTTP  bool
+		hasHTTPS bool
+	}{
+		{[]string{"example.com"}, false, true},
+		{[]string{"https://example.com"}, false, true},
+		{[]string{"http://example.com"}, true, false},
+		{[]string{"example.com:80"}, true, false},
+		{[]string{"example.com:8443"}, false, true},
+		{[]string{":8080"}, true, false},
+		{[]string{":443"}, false, true},
+		{[]string{"example.com,", "http://example.com"}, true, true},
+	}
+	for _, test := range tests {
+		hasHTTP, hasHTTPS := getSiteSchemes(test.keys)
+		assert.Equal(t, test.hasHTTP, hasHTTP, test.keys)
+		assert.Equal(t, test.hasHTTPS, hasHTTPS, test.keys)
+	}
+}
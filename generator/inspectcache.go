@@ -0,0 +1,136 @@
+package generator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+)
+
+// inspectCache caches results of Docker inspect calls made during generation for a Docker client.
+// Entries remember the version of the inspected object, and expire after a TTL
+// or when an event about the object is received
+type inspectCache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[string]*inspectCacheEntry
+}
+
+type inspectCacheEntry struct {
+	version uint64
+	value   interface{}
+	expires time.Time
+}
+
+func newInspectCache(ttl time.Duration) *inspectCache {
+	return &inspectCache{
+		ttl:     ttl,
+		entries: map[string]*inspectCacheEntry{},
+	}
+}
+
+func (cache *inspectCache) get(key string, version uint64, now time.Time) (interface{}, bool) {
+	if cache == nil {
+		return nil, false
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	entry, found := cache.entries[key]
+	if !found {
+		return nil, false
+	}
+	if entry.version != version || now.After(entry.expires) {
+		delete(cache.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (cache *inspectCache) set(key string, version uint64, value interface{}, now time.Time) {
+	if cache == nil {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.entries[key] = &inspectCacheEntry{
+		version: version,
+		value:   value,
+		expires: now.Add(cache.ttl),
+	}
+}
+
+func (cache *inspectCache) invalidate(key string) {
+	if cache == nil {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	delete(cache.entries, key)
+}
+
+// InvalidateInspectCache evicts cached inspect results of an object, after an event
+// of eventType about it is received from the Docker client at clientIndex
+func (g *CaddyfileGenerator) InvalidateInspectCache(clientIndex int, eventType string, id string) {
+	if clientIndex < len(g.inspectCaches) {
+		g.inspectCaches[clientIndex].invalidate(eventType + "/" + id)
+	}
+}
+
+func (g *CaddyfileGenerator) getInspectCache(clientIndex int) *inspectCache {
+	if clientIndex < len(g.inspectCaches) {
+		return g.inspectCaches[clientIndex]
+	}
+	return nil
+}
+
+// inspectConfigs inspects swarm configs with up to InspectConcurrency concurrent requests,
+// returning results and errors in the order of configs
+func (g *CaddyfileGenerator) inspectConfigs(ctx context.Context, clientIndex int, dockerClient docker.Client, configs []swarm.Config) ([]swarm.Config, []error) {
+	cache := g.getInspectCache(clientIndex)
+	results := make([]swarm.Config, len(configs))
+	errs := make([]error, len(configs))
+
+	concurrency := g.options.InspectConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	semaphore := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for index, config := range configs {
+		key := "config/" + config.ID
+		if value, found := cache.get(key, config.Version.Index, time.Now()); found {
+			results[index] = value.(swarm.Config)
+			continue
+		}
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(index int, config swarm.Config) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			fullConfig, _, err := dockerClient.ConfigInspectWithRaw(ctx, config.ID)
+			results[index], errs[index] = fullConfig, err
+			if err == nil {
+				cache.set(key, config.Version.Index, fullConfig, time.Now())
+			}
+		}(index, config)
+	}
+	wg.Wait()
+	return results, errs
+}
+
+// inspectNode inspects a swarm node, using cached results when available
+func (g *CaddyfileGenerator) inspectNode(ctx context.Context, clientIndex int, dockerClient docker.Client, nodeID string) (swarm.Node, error) {
+	cache := g.getInspectCache(clientIndex)
+	key := "node/" + nodeID
+	if value, found := cache.get(key, 0, time.Now()); found {
+		return value.(swarm.Node), nil
+	}
+	node, _, err := dockerClient.NodeInspectWithRaw(ctx, nodeID)
+	if err == nil {
+		cache.set(key, 0, node, time.Now())
+	}
+	return node, err
+}
@@ -0,0 +1,153 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// countingClientMock counts config inspects, optionally making them slow
+type countingClientMock struct {
+	*docker.ClientMock
+	configInspects atomic.Int32
+	latency        time.Duration
+}
+
+func (mock *countingClientMock) ConfigInspectWithRaw(ctx context.Context, id string) (swarm.Config, []byte, error) {
+	mock.configInspects.Add(1)
+	time.Sleep(mock.latency)
+	return mock.ClientMock.ConfigInspectWithRaw(ctx, id)
+}
+
+func createCaddyConfig(id string, version uint64, site string) swarm.Config {
+	return swarm.Config{
+		ID:   id,
+		Meta: swarm.Meta{Version: swarm.Version{Index: version}},
+		Spec: swarm.ConfigSpec{
+			Annotations: swarm.Annotations{
+				Labels: map[string]string{
+					fmtLabel("%s"): "",
+				},
+			},
+			Data: []byte(site + " {\n\trespond 200\n}"),
+		},
+	}
+}
+
+func createInspectCacheGenerator(dockerClient docker.Client, ttl time.Duration) *CaddyfileGenerator {
+	options := &config.Options{
+		LabelPrefix:     DefaultLabelPrefix,
+		InspectCacheTTL: ttl,
+	}
+	return CreateGenerator([]docker.Client{dockerClient}, createDockerUtilsMock(), options)
+}
+
+func TestInspectCache_CachesConfigs(t *testing.T) {
+	dockerClient := &countingClientMock{ClientMock: createBasicDockerClientMock()}
+	dockerClient.ConfigsData = []swarm.Config{createCaddyConfig("CONFIG-ID", 1, "a.testdomain.com")}
+	generator := createInspectCacheGenerator(dockerClient, time.Hour)
+
+	generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	caddyfile, _, _ := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+
+	assert.Equal(t, int32(1), dockerClient.configInspects.Load())
+	assert.Contains(t, string(caddyfile), "a.testdomain.com")
+}
+
+func TestInspectCache_EvictsOnEvent(t *testing.T) {
+	dockerClient := &countingClientMock{ClientMock: createBasicDockerClientMock()}
+	dockerClient.ConfigsData = []swarm.Config{createCaddyConfig("CONFIG-ID", 1, "a.testdomain.com")}
+	generator := createInspectCacheGenerator(dockerClient, time.Hour)
+
+	generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+
+	// Same ID and version, only evicted by the event
+	dockerClient.ConfigsData = []swarm.Config{createCaddyConfig("CONFIG-ID", 1, "b.testdomain.com")}
+	caddyfile, _, _ := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	assert.Contains(t, string(caddyfile), "a.testdomain.com")
+
+	generator.InvalidateInspectCache(0, "config", "CONFIG-ID")
+	caddyfile, _, _ = generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	assert.Contains(t, string(caddyfile), "b.testdomain.com")
+	assert.Equal(t, int32(2), dockerClient.configInspects.Load())
+}
+
+func TestInspectCache_EvictsOnVersionChangeAndTTL(t *testing.T) {
+	dockerClient := &countingClientMock{ClientMock: createBasicDockerClientMock()}
+	dockerClient.ConfigsData = []swarm.Config{createCaddyConfig("CONFIG-ID", 1, "a.testdomain.com")}
+	generator := createInspectCacheGenerator(dockerClient, time.Hour)
+
+	generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+
+	dockerClient.ConfigsData = []swarm.Config{createCaddyConfig("CONFIG-ID", 2, "b.testdomain.com")}
+	caddyfile, _, _ := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	assert.Contains(t, string(caddyfile), "b.testdomain.com")
+	assert.Equal(t, int32(2), dockerClient.configInspects.Load())
+
+	generator.inspectCaches[0].entries["config/CONFIG-ID"].expires = time.Now().Add(-time.Second)
+	generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	assert.Equal(t, int32(3), dockerClient.configInspects.Load())
+}
+
+func TestInspectCache_Disabled(t *testing.T) {
+	dockerClient := &countingClientMock{ClientMock: createBasicDockerClientMock()}
+	dockerClient.ConfigsData = []swarm.Config{createCaddyConfig("CONFIG-ID", 1, "a.testdomain.com")}
+	generator := createInspectCacheGenerator(dockerClient, 0)
+
+	generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	generator.InvalidateInspectCache(0, "config", "CONFIG-ID")
+
+	assert.Equal(t, int32(2), dockerClient.configInspects.Load())
+}
+
+func TestInspectConfigs_KeepsOrder(t *testing.T) {
+	dockerClient := &countingClientMock{ClientMock: createBasicDockerClientMock()}
+	for i := 0; i < 20; i++ {
+		dockerClient.ConfigsData = append(dockerClient.ConfigsData, createCaddyConfig(fmt.Sprintf("CONFIG-%d", i), 1, fmt.Sprintf("site%d.testdomain.com", i)))
+	}
+	generator := createInspectCacheGenerator(dockerClient, 0)
+	generator.options.InspectConcurrency = 8
+
+	configs, errs := generator.inspectConfigs(context.Background(), 0, dockerClient, dockerClient.ConfigsData)
+
+	for i := range configs {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, fmt.Sprintf("CONFIG-%d", i), configs[i].ID)
+	}
+}
+
+func BenchmarkGenerateCaddyfile_SwarmConfigs(b *testing.B) {
+	benchmarks := []struct {
+		name        string
+		ttl         time.Duration
+		concurrency int
+	}{
+		{"NoCache", 0, 1},
+		{"Concurrency8", 0, 8},
+		{"Cache", time.Hour, 1},
+	}
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			dockerClient := &countingClientMock{ClientMock: createBasicDockerClientMock(), latency: 100 * time.Microsecond}
+			for i := 0; i < 50; i++ {
+				dockerClient.ConfigsData = append(dockerClient.ConfigsData, createCaddyConfig(fmt.Sprintf("CONFIG-%d", i), 1, fmt.Sprintf("site%d.testdomain.com", i)))
+			}
+			generator := createInspectCacheGenerator(dockerClient, benchmark.ttl)
+			generator.options.InspectConcurrency = benchmark.concurrency
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package generator
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+)
+
+// InventoryRoute describes a route proxied by the generated Caddyfile
+type InventoryRoute struct {
+	Source    string   `json:"source"`
+	Hosts     []string `json:"hosts"`
+	Path      string   `json:"path,omitempty"`
+	Upstreams []string `json:"upstreams"`
+	TLS       string   `json:"tls"`
+}
+
+// Inventory returns the routes of the last generated Caddyfile
+func (g *CaddyfileGenerator) Inventory() []InventoryRoute {
+	g.inventoryMutex.RLock()
+	defer g.inventoryMutex.RUnlock()
+	return g.inventory
+}
+
+func (g *CaddyfileGenerator) setInventory(inventory []InventoryRoute) {
+	g.inventoryMutex.Lock()
+	defer g.inventoryMutex.Unlock()
+	g.inventory = inventory
+}
+
+func getContainerInventorySource(container *types.Container) string {
+	if name := getContainerName(container); name != "" {
+		return "container/" + name
+	}
+	return "container/" + container.ID
+}
+
+// getInventoryRoutes returns the proxy routes defined in sites of a container, service or route caddyfile
+func getInventoryRoutes(source string, sourceCaddyfile *caddyfile.Container) []InventoryRoute {
+	routes := []InventoryRoute{}
+	for _, block := range sourceCaddyfile.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		hosts := []string{}
+		for _, key := range block.Keys {
+			if host := strings.TrimSpace(strings.TrimSuffix(key, ",")); host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+		tls := getInventoryTLSMode(block, hosts)
+		for _, route := range findProxyRoutes(block.Container, "") {
+			route.Source = source
+			route.Hosts = hosts
+			route.TLS = tls
+			routes = append(routes, route)
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		hostsI, hostsJ := strings.Join(routes[i].Hosts, " "), strings.Join(routes[j].Hosts, " ")
+		if hostsI != hostsJ {
+			return hostsI < hostsJ
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	return routes
+}
+
+func findProxyRoutes(container *caddyfile.Container, parentPath string) []InventoryRoute {
+	routes := []InventoryRoute{}
+	if container == nil {
+		return routes
+	}
+	for _, directive := range container.Children {
+		path := parentPath
+		args := directive.Keys[1:]
+		if len(args) > 0 && isRouteMatcher(args[0]) {
+			if args[0] != "*" {
+				path = args[0]
+			}
+			args = args[1:]
+		}
+		switch directive.GetFirstKey() {
+		case "reverse_proxy", "php_fastcgi":
+			upstreams := append([]string{}, args...)
+			for _, subdirective := range directive.GetAllByFirstKey("to") {
+				upstreams = append(upstreams, subdirective.Keys[1:]...)
+			}
+			routes = append(routes, InventoryRoute{
+				Path:      path,
+				Upstreams: upstreams,
+			})
+		case "route", "handle", "handle_path":
+			routes = append(routes, findProxyRoutes(directive.Container, path)...)
+		}
+	}
+	return routes
+}
+
+// getInventoryTLSMode returns off for sites served only over HTTP, internal for sites using
+// Caddy internal CA, custom for sites with other tls configurations or acme otherwise
+func getInventoryTLSMode(site *caddyfile.Block, hosts []string) string {
+	httpOnly := len(hosts) > 0
+	for _, host := range hosts {
+		if !strings.HasPrefix(host, "http://") && !strings.HasSuffix(host, ":80") {
+			httpOnly = false
+		}
+	}
+	if httpOnly {
+		return "off"
+	}
+	for _, tls := range site.GetAllByFirstKey("tls") {
+		if len(tls.Keys) > 1 && tls.Keys[1] == "internal" {
+			return "internal"
+		}
+		return "custom"
+	}
+	return "acme"
+}
@@ -0,0 +1,88 @@
+package generator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestInventory(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			ID:    "CONTAINER-ID",
+			Names: []string{"/web"},
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):                           "web.testdomain.com, www.testdomain.com",
+				fmtLabel("%s.handle_path"):               "/api/*",
+				fmtLabel("%s.handle_path.reverse_proxy"): "{{upstreams 8080}}",
+				fmtLabel("%s.reverse_proxy"):             "{{upstreams 80}}",
+				fmtLabel("%s.tls"):                       "internal",
+			},
+		},
+	}
+	dockerClient.ServicesData = []swarm.Service{
+		{
+			ID: "SERVICE-ID",
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{
+					Name: "service",
+					Labels: map[string]string{
+						fmtLabel("%s"):               "http://service.testdomain.com",
+						fmtLabel("%s.reverse_proxy"): "{{upstreams 5000}}",
+					},
+				},
+			},
+			Endpoint: swarm.Endpoint{
+				VirtualIPs: []swarm.EndpointVirtualIP{
+					{
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+		},
+	}
+
+	options := &config.Options{
+		LabelPrefix: DefaultLabelPrefix,
+	}
+	generator := CreateGenerator([]docker.Client{dockerClient}, createDockerUtilsMock(), options)
+	generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+
+	assert.Equal(t, []InventoryRoute{
+		{
+			Source:    "container/web",
+			Hosts:     []string{"web.testdomain.com", "www.testdomain.com"},
+			Upstreams: []string{"172.17.0.2:80"},
+			TLS:       "internal",
+		},
+		{
+			Source:    "container/web",
+			Hosts:     []string{"web.testdomain.com", "www.testdomain.com"},
+			Path:      "/api/*",
+			Upstreams: []string{"172.17.0.2:8080"},
+			TLS:       "internal",
+		},
+		{
+			Source:    "service/service",
+			Hosts:     []string{"http://service.testdomain.com"},
+			Upstreams: []string{"service:5000"},
+			TLS:       "off",
+		},
+	}, generator.Inventory())
+}
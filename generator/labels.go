@@ -1,19 +1,42 @@
 package generator
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"text/template"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
 	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"go.uber.org/zap"
 )
 
+// errMissingLabel is returned by the label template function for labels that aren't defined
+var errMissingLabel = errors.New("label not defined")
+
 type targetsProvider func() ([]string, error)
 
-func labelsToCaddyfile(labels map[string]string, templateData interface{}, getTargets targetsProvider) (*caddyfile.Container, error) {
+// portProvider returns the port added to upstreams without an explicit port, 0 means no port
+type portProvider func() (int, error)
+
+// labelsToCaddyfile converts caddy labels into a caddyfile, executing their templates with the
+// container, service or route in templateData. Labels whose template references missing data
+// are logged and skipped, instead of generating "<no value>"
+func labelsToCaddyfile(labels map[string]string, templateData interface{}, getTargets targetsProvider, getDefaultPort portProvider, logger *zap.Logger) (*caddyfile.Container, error) {
+	name, allLabels := getTemplateMetadata(templateData)
 	funcMap := template.FuncMap{
 		"upstreams": func(options ...interface{}) (string, error) {
 			targets, err := getTargets()
+			defaultPort := 0
+			if getDefaultPort != nil && !hasPortParam(options) {
+				port, portErr := getDefaultPort()
+				if portErr != nil {
+					return "", portErr
+				}
+				defaultPort = port
+			}
 			transformed := []string{}
 			for _, target := range targets {
 				for _, param := range options {
@@ -23,6 +46,9 @@ func labelsToCaddyfile(labels map[string]string, templateData interface{}, getTa
 						target = target + ":" + strconv.Itoa(port)
 					}
 				}
+				if defaultPort > 0 {
+					target = target + ":" + strconv.Itoa(defaultPort)
+				}
 				transformed = append(transformed, target)
 			}
 			return strings.Join(transformed, " "), err
@@ -36,7 +62,56 @@ func labelsToCaddyfile(labels map[string]string, templateData interface{}, getTa
 		"h2c": func() string {
 			return "h2c"
 		},
+		"name": func() string {
+			return name
+		},
+		"label": func(key string) (string, error) {
+			value, found := allLabels[key]
+			if !found {
+				return "", fmt.Errorf("%w: %s", errMissingLabel, key)
+			}
+			return value, nil
+		},
 	}
 
-	return caddyfile.FromLabels(labels, templateData, funcMap)
+	return caddyfile.FromLabelsSkipping(labels, templateData, funcMap, func(label string, err error) bool {
+		if !isMissingDataError(err) {
+			return false
+		}
+		logger.Error("Skipping label referencing missing data in its template", zap.String("name", name), zap.String("label", label), zap.Error(err))
+		return true
+	})
+}
+
+// getTemplateMetadata returns the name and all labels of the container, service or route
+// whose labels are converted
+func getTemplateMetadata(templateData interface{}) (string, map[string]string) {
+	switch data := templateData.(type) {
+	case *types.Container:
+		return getContainerName(data), data.Labels
+	case *swarm.Service:
+		return data.Spec.Name, data.Spec.Labels
+	case *Route:
+		return data.Name, data.Labels
+	}
+	return "", nil
+}
+
+// isMissingDataError checks whether a template failed because it references missing fields,
+// map keys or labels. Errors returned by template functions, like upstreams, aren't
+func isMissingDataError(err error) bool {
+	if errors.Is(err, errMissingLabel) {
+		return true
+	}
+	var execErr template.ExecError
+	return errors.As(err, &execErr) && errors.Unwrap(execErr.Err) == nil
+}
+
+func hasPortParam(options []interface{}) bool {
+	for _, param := range options {
+		if _, isPort := param.(int); isPort {
+			return true
+		}
+	}
+	return false
 }
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 )
 
 func TestLabelsToCaddyfile(t *testing.T) {
@@ -48,7 +49,7 @@ func TestLabelsToCaddyfile(t *testing.T) {
 		// convert the labels to a Caddyfile
 		caddyfileBlock, err := labelsToCaddyfile(labels, nil, func() ([]string, error) {
 			return []string{"target"}, nil
-		})
+		}, nil, zap.NewNop())
 
 		// if the result is nil then we expect an empty Caddyfile
 		// or an error message prefixed with "err: "
@@ -0,0 +1,50 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+)
+
+// namespaceMatchers suffixes the names of matchers defined in sites of a container or service
+// with a short hash of its owner, so equally named matchers of different containers or services
+// sharing the same site don't get merged together. Replicas share the owner and matcher names
+func namespaceMatchers(container *caddyfile.Container, owner string) {
+	suffix := getMatcherSuffix(owner)
+	for _, block := range container.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		names := map[string]bool{}
+		collectMatcherNames(block.Container, names)
+		if len(names) > 0 {
+			renameMatchers(block.Container, names, suffix)
+		}
+	}
+}
+
+func getMatcherSuffix(owner string) string {
+	hash := sha256.Sum256([]byte(owner))
+	return "_" + hex.EncodeToString(hash[:])[:8]
+}
+
+func collectMatcherNames(container *caddyfile.Container, names map[string]bool) {
+	for _, block := range container.Children {
+		if block.IsMatcher() {
+			names[block.Keys[0]] = true
+		}
+		collectMatcherNames(block.Container, names)
+	}
+}
+
+func renameMatchers(container *caddyfile.Container, names map[string]bool, suffix string) {
+	for _, block := range container.Children {
+		for index, key := range block.Keys {
+			if names[key] {
+				block.Keys[index] = key + suffix
+			}
+		}
+		renameMatchers(block.Container, names, suffix)
+	}
+}
@@ -0,0 +1,128 @@
+package generator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func createMatcherService(name string, path string) swarm.Service {
+	return swarm.Service{
+		ID: name + "-ID",
+		Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{
+				Name: name,
+				Labels: map[string]string{
+					fmtLabel("%s"):               "service.testdomain.com",
+					fmtLabel("%s.@api.path"):     path,
+					fmtLabel("%s.reverse_proxy"): "@api {{upstreams 80}}",
+				},
+			},
+		},
+		Endpoint: swarm.Endpoint{
+			VirtualIPs: []swarm.EndpointVirtualIP{
+				{
+					NetworkID: caddyNetworkID,
+				},
+			},
+		},
+	}
+}
+
+func TestNamespaceMatchers_SimilarServices(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createMatcherService("api-v2", "/v2/*"),
+		createMatcherService("api", "/api/*"),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	@api_327ed7f1 {\n" +
+		"		path /v2/*\n" +
+		"	}\n" +
+		"	@api_ce3635e2 {\n" +
+		"		path /api/*\n" +
+		"	}\n" +
+		"	reverse_proxy @api_327ed7f1 api-v2:80\n" +
+		"	reverse_proxy @api_ce3635e2 api:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.NamespaceMatchers = true
+	}, expectedCaddyfile, commonLogs)
+}
+
+func TestNamespaceMatchers_Disabled(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createMatcherService("api-v2", "/v2/*"),
+		createMatcherService("api", "/api/*"),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	@api {\n" +
+		"		path /api/*\n" +
+		"		path /v2/*\n" +
+		"	}\n" +
+		"	reverse_proxy @api api:80 api-v2:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`WARN	Route collision	{"route": "service.testdomain.com @api", "owner": "service/api", "colliding": "service/api-v2"}` + newLine
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
+}
+
+func TestNamespaceMatchers_StableAcrossRuns(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createMatcherService("api", "/api/*"),
+	}
+	options := &config.Options{
+		LabelPrefix:       DefaultLabelPrefix,
+		NamespaceMatchers: true,
+	}
+	generator := CreateGenerator([]docker.Client{dockerClient}, createDockerUtilsMock(), options)
+
+	first, _, _ := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+
+	dockerClient.ServicesData = []swarm.Service{
+		createMatcherService("api", "/api/*"),
+		createMatcherService("api-v2", "/v2/*"),
+	}
+	second, _, _ := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+
+	assert.Contains(t, string(first), "reverse_proxy @api_ce3635e2 api:80")
+	assert.Contains(t, string(second), "reverse_proxy @api_ce3635e2 api:80")
+}
+
+func TestNamespaceMatchers_RenamesReferences(t *testing.T) {
+	container, err := caddyfile.Unmarshal([]byte("service.testdomain.com {\n" +
+		"	@api {\n" +
+		"		path /api/*\n" +
+		"	}\n" +
+		"	handle @api {\n" +
+		"		reverse_proxy target:80\n" +
+		"	}\n" +
+		"	respond @other 404\n" +
+		"}\n"))
+	assert.NoError(t, err)
+
+	namespaceMatchers(container, "service/api")
+
+	assert.Equal(t, "service.testdomain.com {\n"+
+		"	@api_ce3635e2 {\n"+
+		"		path /api/*\n"+
+		"	}\n"+
+		"	handle @api_ce3635e2 {\n"+
+		"		reverse_proxy target:80\n"+
+		"	}\n"+
+		"	respond @other 404\n"+
+		"}\n", string(container.Marshal()))
+}
@@ -0,0 +1,29 @@
+package generator
+
+import (
+	"github.com/docker/docker/errdefs"
+	"go.uber.org/zap"
+)
+
+// isPermissionError reports whether docker API refused a request because of
+// missing permissions, like a socket proxy blocking an endpoint
+func isPermissionError(err error) bool {
+	return errdefs.IsForbidden(err) || errdefs.IsUnauthorized(err)
+}
+
+// logDockerError logs a failed docker API request for objectType. Permission errors
+// are reported with a specific message, and as warnings when they are tolerated.
+// Otherwise they fail the generation, so a partial Caddyfile isn't pushed
+func (g *CaddyfileGenerator) logDockerError(logger *zap.Logger, msg string, objectType string, err error, fields ...zap.Field) {
+	if !isPermissionError(err) {
+		logger.Error(msg, append(fields, zap.Error(err))...)
+		return
+	}
+	fields = append(fields, zap.String("objectType", objectType), zap.Error(err))
+	if g.options.TolerateDockerPermissionErrors {
+		logger.Warn("Docker API permission denied, continuing without "+objectType, fields...)
+	} else {
+		logger.Error("Docker API permission denied, not generating a Caddyfile without "+objectType, fields...)
+		g.permissionErr = err
+	}
+}
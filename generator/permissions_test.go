@@ -0,0 +1,112 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func createPermissionsDockerClientMock() *docker.ClientMock {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ConfigListError = errdefs.Forbidden(errors.New("configs endpoint is not allowed"))
+	dockerClient.ContainersData = []types.Container{
+		{
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "example.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+			},
+		},
+	}
+	return dockerClient
+}
+
+const permissionsExpectedCaddyfile = "example.com {\n" +
+	"	reverse_proxy 172.17.0.2\n" +
+	"}\n"
+
+func TestPermissions_ForbiddenConfigList(t *testing.T) {
+	dockerClient := createPermissionsDockerClientMock()
+
+	const expectedLogs = commonLogs +
+		`ERROR	Docker API permission denied, not generating a Caddyfile without configs	{"objectType": "configs", "error": "configs endpoint is not allowed"}` + newLine
+
+	testGeneration(t, dockerClient, nil, "", expectedLogs)
+}
+
+func TestPermissions_ForbiddenConfigListFailsGeneration(t *testing.T) {
+	dockerClient := createPermissionsDockerClientMock()
+	generator := CreateGenerator([]docker.Client{dockerClient}, createDockerUtilsMock(), &config.Options{
+		LabelPrefix: DefaultLabelPrefix,
+	})
+
+	caddyfile, controlledServers, err := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+
+	assert.True(t, errdefs.IsForbidden(err))
+	assert.Nil(t, caddyfile)
+	assert.Nil(t, controlledServers)
+
+	// Generation recovers once docker API allows the request again
+	dockerClient.ConfigListError = nil
+	caddyfile, _, err = generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	assert.NoError(t, err)
+	assert.Equal(t, permissionsExpectedCaddyfile, string(caddyfile))
+}
+
+func TestPermissions_TolerateForbiddenConfigList(t *testing.T) {
+	dockerClient := createPermissionsDockerClientMock()
+
+	const expectedLogs = commonLogs +
+		`WARN	Docker API permission denied, continuing without configs	{"objectType": "configs", "error": "configs endpoint is not allowed"}` + newLine
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.TolerateDockerPermissionErrors = true
+	}, permissionsExpectedCaddyfile, expectedLogs)
+}
+
+func TestPermissions_TolerateForbiddenServiceList(t *testing.T) {
+	dockerClient := createPermissionsDockerClientMock()
+	dockerClient.ConfigListError = nil
+	dockerClient.ServiceListError = errdefs.Unauthorized(errors.New("services endpoint is not allowed"))
+
+	const expectedLogs = commonLogs +
+		`WARN	Docker API permission denied, continuing without services	{"objectType": "services", "error": "services endpoint is not allowed"}` + newLine
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.TolerateDockerPermissionErrors = true
+	}, permissionsExpectedCaddyfile, expectedLogs)
+}
+
+func TestPermissions_OtherErrorsNotTolerated(t *testing.T) {
+	dockerClient := createPermissionsDockerClientMock()
+	dockerClient.ConfigListError = errors.New("connection reset")
+
+	const expectedLogs = commonLogs +
+		`ERROR	Failed to get Swarm configs	{"error": "connection reset"}` + newLine
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.TolerateDockerPermissionErrors = true
+	}, permissionsExpectedCaddyfile, expectedLogs)
+}
+
+func TestIsPermissionError(t *testing.T) {
+	assert.True(t, isPermissionError(errdefs.Forbidden(errors.New("forbidden"))))
+	assert.True(t, isPermissionError(errdefs.Unauthorized(errors.New("unauthorized"))))
+	assert.False(t, isPermissionError(errdefs.NotFound(errors.New("not found"))))
+	assert.False(t, isPermissionError(errors.New("connection reset")))
+}
@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"go.uber.org/zap"
+)
+
+// HTTPSRedirectLabel forces the HTTP to HTTPS redirect of sites of a container or service on or off
+const HTTPSRedirectLabel = "caddy_https_redirect"
+
+// applyHTTPSRedirect adds HTTP sites redirecting to HTTPS when the HTTPS redirect label is true,
+// or serves sites over HTTP as well when it is false. Both override Caddy automatic redirects,
+// which don't apply to hostnames with an explicit HTTP site
+func applyHTTPSRedirect(labels map[string]string, sourceCaddyfile *caddyfile.Container, logger *zap.Logger) {
+	value, hasLabel := labels[HTTPSRedirectLabel]
+	if !hasLabel {
+		return
+	}
+	redirect, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Warn("Invalid value for label", zap.String("label", HTTPSRedirectLabel), zap.String("value", value), zap.Error(err))
+		return
+	}
+
+	for _, block := range append([]*caddyfile.Block{}, sourceCaddyfile.Children...) {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		httpAddresses := getHTTPAddresses(block.Keys)
+		if len(httpAddresses) == 0 {
+			continue
+		}
+		if redirect {
+			redirectBlock := caddyfile.CreateBlock()
+			redirectBlock.AddKeys(httpAddresses...)
+			redirectDirective := caddyfile.CreateBlock()
+			redirectDirective.AddKeys("redir", "https://{host}{uri}", "permanent")
+			redirectBlock.AddBlock(redirectDirective)
+			sourceCaddyfile.AddBlock(redirectBlock)
+		} else {
+			block.AddKeys(httpAddresses...)
+		}
+	}
+}
+
+// getHTTPAddresses returns the HTTP counterpart of HTTPS site addresses
+func getHTTPAddresses(siteKeys []string) []string {
+	addresses := []string{}
+	for _, key := range siteKeys {
+		address := strings.TrimSpace(strings.TrimSuffix(key, ","))
+		if address == "" || strings.HasPrefix(address, "http://") {
+			continue
+		}
+		address = strings.TrimPrefix(address, "https://")
+		host, path := address, ""
+		if index := strings.Index(address, "/"); index >= 0 {
+			host, path = address[:index], address[index:]
+		}
+		if h, port, err := net.SplitHostPort(host); err == nil {
+			if port != "443" {
+				continue
+			}
+			host = h
+		}
+		if host == "" {
+			continue
+		}
+		addresses = append(addresses, "http://"+host+path)
+	}
+	return addresses
+}
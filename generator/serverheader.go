@@ -0,0 +1,26 @@
+package generator
+
+import "github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+
+const serverHeader = "Server"
+
+// applyServerHeader removes the Server response header from all sites when value is empty,
+// or replaces it with value. Sites with their own header directive for Server are left unchanged
+func applyServerHeader(container *caddyfile.Container, value string) {
+	for _, block := range container.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		if hasHeaderField(block, serverHeader) {
+			continue
+		}
+		header := caddyfile.CreateBlock()
+		if value == "" {
+			header.AddKeys("header", "-"+serverHeader)
+		} else {
+			// Deferred, so it also replaces the Server header of upstreams
+			header.AddKeys("header", ">"+serverHeader, value)
+		}
+		block.AddBlock(header)
+	}
+}
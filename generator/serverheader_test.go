@@ -0,0 +1,90 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/stretchr/testify/assert"
+)
+
+func createServerHeaderDockerClientMock() *docker.ClientMock {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("api", map[string]string{
+			fmtLabel("%s"):               "api.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+		createService("custom", map[string]string{
+			fmtLabel("%s"):               "custom.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			fmtLabel("%s.header"):        "Server custom",
+		}),
+		createService("web", map[string]string{
+			fmtLabel("%s"):               "http://web.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+	}
+	return dockerClient
+}
+
+func TestServerHeader_Removed(t *testing.T) {
+	const expectedCaddyfile = "api.testdomain.com {\n" +
+		"	header -Server\n" +
+		"	reverse_proxy api:80\n" +
+		"}\n" +
+		"custom.testdomain.com {\n" +
+		"	header Server custom\n" +
+		"	reverse_proxy custom:80\n" +
+		"}\n" +
+		"http://web.testdomain.com {\n" +
+		"	header -Server\n" +
+		"	reverse_proxy web:80\n" +
+		"}\n"
+
+	testGeneration(t, createServerHeaderDockerClientMock(), func(options *config.Options) {
+		serverHeader := ""
+		options.ServerHeader = &serverHeader
+	}, expectedCaddyfile, commonLogs)
+}
+
+func TestServerHeader_Replaced(t *testing.T) {
+	const expectedCaddyfile = "api.testdomain.com {\n" +
+		"	header >Server acme\n" +
+		"	reverse_proxy api:80\n" +
+		"}\n" +
+		"custom.testdomain.com {\n" +
+		"	header Server custom\n" +
+		"	reverse_proxy custom:80\n" +
+		"}\n" +
+		"http://web.testdomain.com {\n" +
+		"	header >Server acme\n" +
+		"	reverse_proxy web:80\n" +
+		"}\n"
+
+	testGeneration(t, createServerHeaderDockerClientMock(), func(options *config.Options) {
+		serverHeader := "acme"
+		options.ServerHeader = &serverHeader
+	}, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"response":{"deferred":true,"set":{"Server":["acme"]}}`)
+}
+
+func TestServerHeader_Unchanged(t *testing.T) {
+	const expectedCaddyfile = "api.testdomain.com {\n" +
+		"	reverse_proxy api:80\n" +
+		"}\n" +
+		"custom.testdomain.com {\n" +
+		"	header Server custom\n" +
+		"	reverse_proxy custom:80\n" +
+		"}\n" +
+		"http://web.testdomain.com {\n" +
+		"	reverse_proxy web:80\n" +
+		"}\n"
+
+	testGeneration(t, createServerHeaderDockerClientMock(), nil, expectedCaddyfile, commonLogs)
+}
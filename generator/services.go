@@ -3,26 +3,36 @@ package generator
 import (
 	"context"
 	"net"
+	"strconv"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
 
 	"go.uber.org/zap"
 )
 
-func (g *CaddyfileGenerator) getServiceCaddyfile(service *swarm.Service, logger *zap.Logger) (*caddyfile.Container, error) {
+// TargetPortLabel selects the target port whose published port is used as upstream port
+// of a service publishing multiple ports in host mode, with PublishedPortStrategy target-matches-label
+const TargetPortLabel = "caddy_target_port"
+
+func (g *CaddyfileGenerator) getServiceCaddyfile(ctx context.Context, service *swarm.Service, logger *zap.Logger) (*caddyfile.Container, error) {
 	caddyLabels := g.filterLabels(service.Spec.Labels)
 
 	return labelsToCaddyfile(caddyLabels, service, func() ([]string, error) {
-		return g.getServiceProxyTargets(service, logger, true)
-	})
+		return g.getServiceProxyTargets(ctx, service, logger, true)
+	}, nil, logger)
 }
 
-func (g *CaddyfileGenerator) getServiceProxyTargets(service *swarm.Service, logger *zap.Logger, onlyIngressIps bool) ([]string, error) {
+func (g *CaddyfileGenerator) getServiceProxyTargets(ctx context.Context, service *swarm.Service, logger *zap.Logger, onlyIngressIps bool) ([]string, error) {
+	if g.options.ResolveHostModeUpstreams && isHostModeService(service) {
+		return g.getServiceHostModeTargets(ctx, service, logger)
+	}
+
 	if g.options.ProxyServiceTasks {
-		return g.getServiceTasksIps(service, logger, onlyIngressIps)
+		return g.getServiceTasksIps(ctx, service, logger, onlyIngressIps)
 	}
 
 	_, err := g.getServiceVirtualIps(service, logger, onlyIngressIps)
@@ -49,7 +59,7 @@ func (g *CaddyfileGenerator) getServiceVirtualIps(service *swarm.Service, logger
 	return virtualIps, nil
 }
 
-func (g *CaddyfileGenerator) getServiceTasksIps(service *swarm.Service, logger *zap.Logger, onlyIngressIps bool) ([]string, error) {
+func (g *CaddyfileGenerator) getServiceTasksIps(ctx context.Context, service *swarm.Service, logger *zap.Logger, onlyIngressIps bool) ([]string, error) {
 	taskListFilter := filters.NewArgs()
 	taskListFilter.Add("service", service.ID)
 	taskListFilter.Add("desired-state", "running")
@@ -58,10 +68,11 @@ func (g *CaddyfileGenerator) getServiceTasksIps(service *swarm.Service, logger *
 	tasksIps := []string{}
 
 	for _, dockerClient := range g.dockerClients {
-		tasks, err := dockerClient.TaskList(context.Background(), types.TaskListOptions{Filters: taskListFilter})
+		tasks, err := dockerClient.TaskList(ctx, types.TaskListOptions{Filters: taskListFilter})
 		if err != nil {
 			return []string{}, err
 		}
+		sortTasks(tasks)
 
 		for _, task := range tasks {
 			if task.Status.State == swarm.TaskStateRunning {
@@ -99,3 +110,115 @@ func (g *CaddyfileGenerator) getServiceTasksIps(service *swarm.Service, logger *
 
 	return tasksIps, nil
 }
+
+func isHostModeService(service *swarm.Service) bool {
+	return len(getHostModePorts(service)) > 0
+}
+
+func getHostModePorts(service *swarm.Service) []swarm.PortConfig {
+	ports := []swarm.PortConfig{}
+	if service.Spec.EndpointSpec == nil {
+		return ports
+	}
+	for _, port := range service.Spec.EndpointSpec.Ports {
+		if port.PublishMode == swarm.PortConfigPublishModeHost {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// getServiceHostModeTargets returns the address of the node running each task of a service
+// that publishes ports in host mode, followed by the first port published by the task
+func (g *CaddyfileGenerator) getServiceHostModeTargets(ctx context.Context, service *swarm.Service, logger *zap.Logger) ([]string, error) {
+	taskListFilter := filters.NewArgs()
+	taskListFilter.Add("service", service.ID)
+	taskListFilter.Add("desired-state", "running")
+
+	targets := []string{}
+	nodesAddresses := map[string]string{}
+
+	for i, dockerClient := range g.dockerClients {
+		tasks, err := dockerClient.TaskList(ctx, types.TaskListOptions{Filters: taskListFilter})
+		if err != nil {
+			return []string{}, err
+		}
+		sortTasks(tasks)
+
+		for _, task := range tasks {
+			if task.Status.State != swarm.TaskStateRunning {
+				continue
+			}
+
+			nodeAddress, found := nodesAddresses[task.NodeID]
+			if !found {
+				node, err := g.inspectNode(ctx, i, dockerClient, task.NodeID)
+				if err != nil {
+					logger.Error("Failed to inspect Swarm node", zap.String("service", service.Spec.Name), zap.String("node", task.NodeID), zap.Error(err))
+					continue
+				}
+				nodeAddress = node.Status.Addr
+				nodesAddresses[task.NodeID] = nodeAddress
+			}
+
+			if port := g.getTaskHostPort(&task, service, logger); port > 0 {
+				targets = append(targets, net.JoinHostPort(nodeAddress, strconv.Itoa(int(port))))
+			} else {
+				targets = append(targets, nodeAddress)
+			}
+		}
+	}
+
+	if len(targets) == 0 {
+		logger.Warn("Service has no tasks in running state", zap.String("service", service.Spec.Name), zap.String("serviceId", service.ID))
+	}
+
+	return targets, nil
+}
+
+// getTaskHostPort returns the port published in host mode by a task, falling back to the
+// ports defined in service spec. When multiple ports are published, one is selected
+// according to PublishedPortStrategy
+func (g *CaddyfileGenerator) getTaskHostPort(task *swarm.Task, service *swarm.Service, logger *zap.Logger) uint32 {
+	ports := getPublishedPorts(task.Status.PortStatus.Ports)
+	if len(ports) == 0 {
+		ports = getPublishedPorts(getHostModePorts(service))
+	}
+	if len(ports) == 0 {
+		return 0
+	}
+
+	switch g.options.PublishedPortStrategy {
+	case config.PublishedPortLowest:
+		lowest := ports[0].PublishedPort
+		for _, port := range ports[1:] {
+			lowest = min(lowest, port.PublishedPort)
+		}
+		return lowest
+	case config.PublishedPortTargetMatchesLabel:
+		value, hasLabel := service.Spec.Labels[TargetPortLabel]
+		targetPort, err := strconv.ParseUint(value, 10, 32)
+		if !hasLabel || err != nil {
+			logger.Warn("Invalid value for label", zap.String("label", TargetPortLabel), zap.String("value", value), zap.String("service", service.Spec.Name))
+			break
+		}
+		for _, port := range ports {
+			if port.TargetPort == uint32(targetPort) {
+				return port.PublishedPort
+			}
+		}
+		logger.Warn("No port published for target port", zap.String("service", service.Spec.Name), zap.Uint64("targetPort", targetPort))
+	}
+	return ports[0].PublishedPort
+}
+
+// getPublishedPorts returns the ports published in host mode with a known published port
+func getPublishedPorts(ports []swarm.PortConfig) []swarm.PortConfig {
+	published := []swarm.PortConfig{}
+	for _, port := range ports {
+		if port.PublishMode == swarm.PortConfigPublishModeHost && port.PublishedPort > 0 {
+			published = append(published, port)
+		}
+	}
+	return published
+}
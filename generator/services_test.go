@@ -3,9 +3,12 @@ package generator
 import (
 	"testing"
 
+	"github.com/caddyserver/caddy/v2/caddyconfig"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestServices_TemplateData(t *testing.T) {
@@ -522,3 +525,600 @@ func TestServiceTasks_Running(t *testing.T) {
 		options.ProxyServiceTasks = true
 	}, expectedCaddyfile, expectedLogs)
 }
+
+func TestServiceTasks_HostMode(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		{
+			ID: "SERVICEID",
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{
+					Name: "service",
+					Labels: map[string]string{
+						fmtLabel("%s"):               "service.testdomain.com",
+						fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+					},
+				},
+				EndpointSpec: &swarm.EndpointSpec{
+					Ports: []swarm.PortConfig{
+						{
+							TargetPort:    80,
+							PublishedPort: 8080,
+							PublishMode:   swarm.PortConfigPublishModeHost,
+						},
+					},
+				},
+			},
+		},
+	}
+	dockerClient.TasksData = []swarm.Task{
+		{
+			ServiceID:    "SERVICEID",
+			NodeID:       "NODE1",
+			DesiredState: swarm.TaskStateRunning,
+			Status:       swarm.TaskStatus{State: swarm.TaskStateRunning},
+		},
+		{
+			ServiceID:    "SERVICEID",
+			NodeID:       "NODE2",
+			DesiredState: swarm.TaskStateRunning,
+			Status: swarm.TaskStatus{
+				State: swarm.TaskStateRunning,
+				PortStatus: swarm.PortStatus{
+					Ports: []swarm.PortConfig{
+						{
+							TargetPort:    80,
+							PublishedPort: 30001,
+							PublishMode:   swarm.PortConfigPublishModeHost,
+						},
+					},
+				},
+			},
+		},
+	}
+	dockerClient.NodesData = []swarm.Node{
+		{ID: "NODE1", Status: swarm.NodeStatus{Addr: "192.168.1.10"}},
+		{ID: "NODE2", Status: swarm.NodeStatus{Addr: "192.168.1.11"}},
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy 192.168.1.10:8080 192.168.1.11:30001\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.ResolveHostModeUpstreams = true
+	}, expectedCaddyfile, expectedLogs)
+}
+
+func createMultiPortHostModeDockerClientMock(labels map[string]string) *docker.ClientMock {
+	labels[fmtLabel("%s")] = "service.testdomain.com"
+	labels[fmtLabel("%s.reverse_proxy")] = "{{upstreams}}"
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		{
+			ID: "SERVICEID",
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{
+					Name:   "service",
+					Labels: labels,
+				},
+				EndpointSpec: &swarm.EndpointSpec{
+					Ports: []swarm.PortConfig{
+						{TargetPort: 443, PublishedPort: 8443, PublishMode: swarm.PortConfigPublishModeHost},
+						{TargetPort: 80, PublishedPort: 8080, PublishMode: swarm.PortConfigPublishModeHost},
+						{TargetPort: 9000, PublishedPort: 9090, PublishMode: swarm.PortConfigPublishModeHost},
+					},
+				},
+			},
+		},
+	}
+	dockerClient.TasksData = []swarm.Task{
+		{
+			ServiceID:    "SERVICEID",
+			NodeID:       "NODE1",
+			DesiredState: swarm.TaskStateRunning,
+			Status:       swarm.TaskStatus{State: swarm.TaskStateRunning},
+		},
+		{
+			ServiceID:    "SERVICEID",
+			NodeID:       "NODE2",
+			DesiredState: swarm.TaskStateRunning,
+			Status: swarm.TaskStatus{
+				State: swarm.TaskStateRunning,
+				PortStatus: swarm.PortStatus{
+					Ports: []swarm.PortConfig{
+						{TargetPort: 443, PublishedPort: 30443, PublishMode: swarm.PortConfigPublishModeHost},
+						{TargetPort: 80, PublishedPort: 30080, PublishMode: swarm.PortConfigPublishModeHost},
+					},
+				},
+			},
+		},
+	}
+	dockerClient.NodesData = []swarm.Node{
+		{ID: "NODE1", Status: swarm.NodeStatus{Addr: "192.168.1.10"}},
+		{ID: "NODE2", Status: swarm.NodeStatus{Addr: "192.168.1.11"}},
+	}
+	return dockerClient
+}
+
+func TestServiceTasks_HostModePublishedPortStrategies(t *testing.T) {
+	tests := []struct {
+		strategy string
+		labels   map[string]string
+		expected string
+		logs     string
+	}{
+		{
+			strategy: "",
+			labels:   map[string]string{},
+			expected: "192.168.1.10:8443 192.168.1.11:30443",
+		},
+		{
+			strategy: config.PublishedPortFirstDeclared,
+			labels:   map[string]string{},
+			expected: "192.168.1.10:8443 192.168.1.11:30443",
+		},
+		{
+			strategy: config.PublishedPortLowest,
+			labels:   map[string]string{},
+			expected: "192.168.1.10:8080 192.168.1.11:30080",
+		},
+		{
+			strategy: config.PublishedPortTargetMatchesLabel,
+			labels:   map[string]string{TargetPortLabel: "80"},
+			expected: "192.168.1.10:8080 192.168.1.11:30080",
+		},
+		{
+			strategy: config.PublishedPortTargetMatchesLabel,
+			labels:   map[string]string{TargetPortLabel: "9000"},
+			expected: "192.168.1.10:9090 192.168.1.11:30443",
+			logs:     `WARN	No port published for target port	{"service": "service", "targetPort": 9000}` + newLine,
+		},
+		{
+			strategy: config.PublishedPortTargetMatchesLabel,
+			labels:   map[string]string{},
+			expected: "192.168.1.10:8443 192.168.1.11:30443",
+			logs: `WARN	Invalid value for label	{"label": "caddy_target_port", "value": "", "service": "service"}` + newLine +
+				`WARN	Invalid value for label	{"label": "caddy_target_port", "value": "", "service": "service"}` + newLine,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.strategy, func(t *testing.T) {
+			dockerClient := createMultiPortHostModeDockerClientMock(test.labels)
+
+			expectedCaddyfile := "service.testdomain.com {\n" +
+				"	reverse_proxy " + test.expected + "\n" +
+				"}\n"
+
+			testGeneration(t, dockerClient, func(options *config.Options) {
+				options.ResolveHostModeUpstreams = true
+				options.PublishedPortStrategy = test.strategy
+			}, expectedCaddyfile, commonLogs+test.logs)
+		})
+	}
+}
+
+func TestServiceTasks_HostModeDisabled(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		{
+			ID: "SERVICEID",
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{
+					Name: "service",
+					Labels: map[string]string{
+						fmtLabel("%s"):               "service.testdomain.com",
+						fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+					},
+				},
+				EndpointSpec: &swarm.EndpointSpec{
+					Ports: []swarm.PortConfig{
+						{
+							TargetPort:    80,
+							PublishedPort: 8080,
+							PublishMode:   swarm.PortConfigPublishModeHost,
+						},
+					},
+				},
+			},
+		},
+	}
+	dockerClient.TasksData = []swarm.Task{
+		{
+			ServiceID: "SERVICEID",
+			NodeID:    "NODE1",
+			NetworksAttachments: []swarm.NetworkAttachment{
+				{
+					Network: swarm.Network{
+						ID: caddyNetworkID,
+					},
+					Addresses: []string{"10.0.0.1/24"},
+				},
+			},
+			DesiredState: swarm.TaskStateRunning,
+			Status:       swarm.TaskStatus{State: swarm.TaskStateRunning},
+		},
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy 10.0.0.1\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.ProxyServiceTasks = true
+	}, expectedCaddyfile, expectedLogs)
+}
+
+func TestServices_ConnectionLimits(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		{
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{
+					Name: "service",
+					Labels: map[string]string{
+						fmtLabel("%s"):               "service.testdomain.com",
+						fmtLabel("%s.reverse_proxy"): "{{upstreams 5000}}",
+						fmtLabel("%s.reverse_proxy.unhealthy_request_count"):                 "100",
+						fmtLabel("%s.reverse_proxy.transport"):                               "http",
+						fmtLabel("%s.reverse_proxy.transport.max_conns_per_host"):            "20",
+						fmtLabel("%s.reverse_proxy.transport.keepalive_idle_conns_per_host"): "10",
+					},
+				},
+			},
+			Endpoint: swarm.Endpoint{
+				VirtualIPs: []swarm.EndpointVirtualIP{
+					{
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+		},
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy service:5000 {\n" +
+		"		transport http {\n" +
+		"			keepalive_idle_conns_per_host 10\n" +
+		"			max_conns_per_host 20\n" +
+		"		}\n" +
+		"		unhealthy_request_count 100\n" +
+		"	}\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"max_conns_per_host":20`)
+	assert.Contains(t, string(configJSON), `"max_idle_conns_per_host":10`)
+	assert.Contains(t, string(configJSON), `"unhealthy_request_count":100`)
+}
+
+func TestServices_PartialConnectionLimits(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		{
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{
+					Name: "service",
+					Labels: map[string]string{
+						fmtLabel("%s"):                                            "service.testdomain.com",
+						fmtLabel("%s.reverse_proxy"):                              "{{upstreams 5000}}",
+						fmtLabel("%s.reverse_proxy.transport"):                    "http",
+						fmtLabel("%s.reverse_proxy.transport.max_conns_per_host"): "20",
+					},
+				},
+			},
+			Endpoint: swarm.Endpoint{
+				VirtualIPs: []swarm.EndpointVirtualIP{
+					{
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+		},
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy service:5000 {\n" +
+		"		transport http {\n" +
+		"			max_conns_per_host 20\n" +
+		"		}\n" +
+		"	}\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	// Limits not set keep Caddy defaults
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"max_conns_per_host":20`)
+	assert.NotContains(t, string(configJSON), `"max_idle_conns_per_host"`)
+	assert.NotContains(t, string(configJSON), `"unhealthy_request_count"`)
+}
+
+func TestServices_Keepalive(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("service", map[string]string{
+			fmtLabel("%s"):                                   "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"):                     "{{upstreams 5000}}",
+			fmtLabel("%s.reverse_proxy.transport"):           "http",
+			fmtLabel("%s.reverse_proxy.transport.keepalive"): "5m",
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy service:5000 {\n" +
+		"		transport http {\n" +
+		"			keepalive 5m\n" +
+		"		}\n" +
+		"	}\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"keep_alive":{"idle_timeout":300000000000}`)
+}
+
+func TestServices_KeepaliveTuned(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("service", map[string]string{
+			fmtLabel("%s"):                                              "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"):                                "{{upstreams 5000}}",
+			fmtLabel("%s.reverse_proxy.transport"):                      "http",
+			fmtLabel("%s.reverse_proxy.transport.keepalive"):            "2m",
+			fmtLabel("%s.reverse_proxy.transport.keepalive_idle_conns"): "50",
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy service:5000 {\n" +
+		"		transport http {\n" +
+		"			keepalive 2m\n" +
+		"			keepalive_idle_conns 50\n" +
+		"		}\n" +
+		"	}\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"keep_alive":{"idle_timeout":120000000000,"max_idle_conns":50}`)
+}
+
+func TestServices_KeepaliveDisabled(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("service", map[string]string{
+			fmtLabel("%s"):                                   "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"):                     "{{upstreams 5000}}",
+			fmtLabel("%s.reverse_proxy.transport"):           "http",
+			fmtLabel("%s.reverse_proxy.transport.keepalive"): "off",
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy service:5000 {\n" +
+		"		transport http {\n" +
+		"			keepalive off\n" +
+		"		}\n" +
+		"	}\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"keep_alive":{"enabled":false}`)
+}
+
+func TestServices_MethodMatchers(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		{
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{
+					Name: "cache",
+					Labels: map[string]string{
+						fmtLabel("%s"):               "api.testdomain.com",
+						fmtLabel("%s.@read.method"):  "GET HEAD",
+						fmtLabel("%s.reverse_proxy"): "@read {{upstreams 80}}",
+					},
+				},
+			},
+			Endpoint: swarm.Endpoint{
+				VirtualIPs: []swarm.EndpointVirtualIP{
+					{
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+		},
+		{
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{
+					Name: "origin",
+					Labels: map[string]string{
+						fmtLabel("%s"):               "api.testdomain.com",
+						fmtLabel("%s.@write.method"): "POST PUT PATCH DELETE",
+						fmtLabel("%s.reverse_proxy"): "@write {{upstreams 80}}",
+					},
+				},
+			},
+			Endpoint: swarm.Endpoint{
+				VirtualIPs: []swarm.EndpointVirtualIP{
+					{
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+		},
+	}
+
+	const expectedCaddyfile = "api.testdomain.com {\n" +
+		"	@read {\n" +
+		"		method GET HEAD\n" +
+		"	}\n" +
+		"	@write {\n" +
+		"		method POST PUT PATCH DELETE\n" +
+		"	}\n" +
+		"	reverse_proxy @read cache:80\n" +
+		"	reverse_proxy @write origin:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"match":[{"method":["GET","HEAD"]}]`)
+	assert.Contains(t, string(configJSON), `"match":[{"method":["POST","PUT","PATCH","DELETE"]}]`)
+}
+
+func TestServices_EncodeTuned(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("service", map[string]string{
+			fmtLabel("%s"):                       "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"):         "{{upstreams 5000}}",
+			fmtLabel("%s.encode"):                "zstd gzip",
+			fmtLabel("%s.encode.minimum_length"): "1024",
+			fmtLabel("%s.encode.match.header"):   "Content-Type text/*",
+			fmtLabel("%s.encode.match.header_1"): "Content-Type application/json*",
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	encode zstd gzip {\n" +
+		"		match {\n" +
+		"			header Content-Type application/json*\n" +
+		"			header Content-Type text/*\n" +
+		"		}\n" +
+		"		minimum_length 1024\n" +
+		"	}\n" +
+		"	reverse_proxy service:5000\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"minimum_length":1024`)
+	assert.Contains(t, string(configJSON), `"match":{"headers":{"Content-Type":["application/json*","text/*"]}}`)
+}
+
+func TestServices_EncodeMinimumLengthOnly(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("service", map[string]string{
+			fmtLabel("%s"):                       "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"):         "{{upstreams 5000}}",
+			fmtLabel("%s.encode"):                "zstd gzip",
+			fmtLabel("%s.encode.minimum_length"): "4096",
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	encode zstd gzip {\n" +
+		"		minimum_length 4096\n" +
+		"	}\n" +
+		"	reverse_proxy service:5000\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	// Content types not set keep Caddy default matcher of compressible types
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"minimum_length":4096`)
+	assert.NotContains(t, string(configJSON), `"match":{"headers"`)
+}
+
+func TestServices_EncodeContentTypesOnly(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("service", map[string]string{
+			fmtLabel("%s"):                     "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"):       "{{upstreams 5000}}",
+			fmtLabel("%s.encode"):              "zstd gzip",
+			fmtLabel("%s.encode.match.header"): "Content-Type text/html*",
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	encode zstd gzip {\n" +
+		"		match {\n" +
+		"			header Content-Type text/html*\n" +
+		"		}\n" +
+		"	}\n" +
+		"	reverse_proxy service:5000\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"match":{"headers":{"Content-Type":["text/html*"]}}`)
+	assert.NotContains(t, string(configJSON), `"minimum_length"`)
+}
+
+func TestServices_RespondHealthEndpoint(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("service", map[string]string{
+			fmtLabel("%s"):               "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 5000}}",
+			fmtLabel("%s.respond"):       `/healthz "ok" 200`,
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	respond /healthz ok 200\n" +
+		"	reverse_proxy service:5000\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	// Caddy orders respond before reverse_proxy, so the health endpoint doesn't reach the backend
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `{"handle":[{"body":"ok","handler":"static_response","status_code":200}],"match":[{"path":["/healthz"]}]},{"handle":[{"handler":"reverse_proxy","upstreams":[{"dial":"service:5000"}]}]}`)
+}
+
+func TestServices_RespondNamedMatcher(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("service", map[string]string{
+			fmtLabel("%s"):                "service.testdomain.com",
+			fmtLabel("%s.reverse_proxy"):  "{{upstreams 5000}}",
+			fmtLabel("%s.@status.path"):   "/status /healthz",
+			fmtLabel("%s.@status.method"): "GET",
+			fmtLabel("%s.respond"):        `@status "{\"status\":\"up\"}" 200`,
+		}),
+	}
+
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	@status {\n" +
+		"		method GET\n" +
+		"		path /status /healthz\n" +
+		"	}\n" +
+		"	respond @status `{\"status\":\"up\"}` 200\n" +
+		"	reverse_proxy service:5000\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `{"handle":[{"body":"{\"status\":\"up\"}","handler":"static_response","status_code":200}],"match":[{"method":["GET"],"path":["/status","/healthz"]}]},{"handle":[{"handler":"reverse_proxy"`)
+}
@@ -0,0 +1,61 @@
+package generator
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"go.uber.org/zap"
+)
+
+// SitePortLabel serves the sites of a container or service on a port, added to site addresses
+// without an explicit port, so hostnames in labels don't need to repeat it
+const SitePortLabel = "caddy_site_port"
+
+// applySitePort adds the port of the site port label to site addresses without a port
+func applySitePort(labels map[string]string, sourceCaddyfile *caddyfile.Container, logger *zap.Logger) {
+	value, hasLabel := labels[SitePortLabel]
+	if !hasLabel {
+		return
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		logger.Warn("Invalid value for label", zap.String("label", SitePortLabel), zap.String("value", value))
+		return
+	}
+
+	for _, block := range sourceCaddyfile.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		for index, key := range block.Keys {
+			block.Keys[index] = addAddressPort(key, strconv.Itoa(port))
+		}
+	}
+}
+
+// addAddressPort adds port to a site address without port, keeping its scheme, path
+// and trailing comma
+func addAddressPort(key string, port string) string {
+	address, comma := strings.CutSuffix(key, ",")
+	if address == "" {
+		return key
+	}
+	scheme := ""
+	if index := strings.Index(address, "://"); index >= 0 {
+		scheme, address = address[:index+3], address[index+3:]
+	}
+	host, path := address, ""
+	if index := strings.Index(address, "/"); index >= 0 {
+		host, path = address[:index], address[index:]
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil || host == "" {
+		return key
+	}
+	address = scheme + net.JoinHostPort(strings.Trim(host, "[]"), port) + path
+	if comma {
+		address += ","
+	}
+	return address
+}
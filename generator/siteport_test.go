@@ -0,0 +1,96 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSitePort_CustomPort(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("admin", map[string]string{
+			fmtLabel("%s"):               "admin.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			SitePortLabel:                "8443",
+		}),
+	}
+
+	const expectedCaddyfile = "admin.testdomain.com:8443 {\n" +
+		"	reverse_proxy admin:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"listen":[":8443"]`)
+}
+
+func TestSitePort_SameHostDifferentPorts(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("admin", map[string]string{
+			fmtLabel("%s"):               "app.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			SitePortLabel:                "8443",
+		}),
+		createService("app", map[string]string{
+			fmtLabel("%s"):               "app.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+		createService("other", map[string]string{
+			fmtLabel("%s"):               "app.testdomain.com:8443",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+	}
+
+	const expectedCaddyfile = "app.testdomain.com {\n" +
+		"	reverse_proxy app:80\n" +
+		"}\n" +
+		"app.testdomain.com:8443 {\n" +
+		"	reverse_proxy admin:80 other:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`WARN	Route collision	{"route": "app.testdomain.com:8443 *", "owner": "service/admin", "colliding": "service/other"}` + newLine
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
+}
+
+func TestSitePort_InvalidLabel(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("admin", map[string]string{
+			fmtLabel("%s"):               "admin.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			SitePortLabel:                "70000",
+		}),
+	}
+
+	const expectedCaddyfile = "admin.testdomain.com {\n" +
+		"	reverse_proxy admin:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`WARN	Invalid value for label	{"label": "caddy_site_port", "value": "70000"}` + newLine
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
+}
+
+func TestAddAddressPort(t *testing.T) {
+	tests := map[string]string{
+		"example.com":            "example.com:8443",
+		"example.com,":           "example.com:8443,",
+		"https://example.com":    "https://example.com:8443",
+		"http://example.com/api": "http://example.com:8443/api",
+		"example.com:9000":       "example.com:9000",
+		":8080":                  ":8080",
+		"[::1]":                  "[::1]:8443",
+	}
+	for address, expected := range tests {
+		assert.Equal(t, expected, addAddressPort(address, "8443"), address)
+	}
+}
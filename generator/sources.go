@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"os"
+	"strings"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Route is a routing target defined outside of docker, described with the same labels used on containers
+type Route struct {
+	Name      string            `yaml:"name"`
+	Labels    map[string]string `yaml:"labels"`
+	Upstreams []string          `yaml:"upstreams"`
+}
+
+// RouteSource provides routes from a non-docker source, merged with docker routes during generation
+type RouteSource interface {
+	Name() string
+	GetRoutes() ([]Route, error)
+}
+
+type fileRouteSource struct {
+	path string
+}
+
+// CreateFileRouteSource creates a RouteSource that reads routes from a YAML file
+func CreateFileRouteSource(path string) RouteSource {
+	return &fileRouteSource{
+		path: path,
+	}
+}
+
+func (source *fileRouteSource) Name() string {
+	return source.path
+}
+
+func (source *fileRouteSource) GetRoutes() ([]Route, error) {
+	data, err := os.ReadFile(source.path)
+	if err != nil {
+		return nil, err
+	}
+	routes := []Route{}
+	if err := yaml.Unmarshal(data, &routes); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// AddRouteSource registers an additional source of routes
+func (g *CaddyfileGenerator) AddRouteSource(source RouteSource) {
+	g.routeSources = append(g.routeSources, source)
+}
+
+// mergeRouteSources merges routes from all sources, in registration order, after docker routes.
+// Sites already defined by docker or by a previous source are still merged, but a warning is logged.
+// Returns the inventory of merged routes.
+func (g *CaddyfileGenerator) mergeRouteSources(caddyfileBlock *caddyfile.Container, logger *zap.Logger) []InventoryRoute {
+	inventory := []InventoryRoute{}
+	for _, source := range g.routeSources {
+		routes, err := source.GetRoutes()
+		if err != nil {
+			logger.Error("Failed to get routes from source", zap.String("source", source.Name()), zap.Error(err))
+			continue
+		}
+
+		existingSites := getSiteAddresses(caddyfileBlock)
+
+		for _, route := range routes {
+			route := route
+			routeCaddyfile, err := labelsToCaddyfile(g.filterLabels(route.Labels), &route, func() ([]string, error) {
+				return route.Upstreams, nil
+			}, nil, logger)
+			if err != nil {
+				logger.Error("Failed to get route caddyfile", zap.String("source", source.Name()), zap.String("route", route.Name), zap.Error(err))
+				continue
+			}
+			if g.options.TerminalRoutes {
+				makeRoutesTerminal(routeCaddyfile)
+			}
+			for site := range getSiteAddresses(routeCaddyfile) {
+				if existingSites[site] {
+					logger.Warn("Route conflicts with an existing site", zap.String("source", source.Name()), zap.String("route", route.Name), zap.String("site", site))
+				}
+			}
+			inventory = append(inventory, getInventoryRoutes("route/"+source.Name()+"/"+route.Name, routeCaddyfile)...)
+			caddyfileBlock.Merge(routeCaddyfile)
+		}
+	}
+	return inventory
+}
+
+func getSiteAddresses(container *caddyfile.Container) map[string]bool {
+	sites := map[string]bool{}
+	for _, block := range container.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		sites[strings.Join(block.Keys, " ")] = true
+	}
+	return sites
+}
@@ -0,0 +1,80 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+)
+
+func TestSources_MergeFileRoutesWithDockerRoutes(t *testing.T) {
+	routesPath := filepath.Join(t.TempDir(), "routes.yaml")
+	err := os.WriteFile(routesPath, []byte(
+		"- name: legacy\n"+
+			"  labels:\n"+
+			"    caddy: legacy.testdomain.com\n"+
+			"    caddy.reverse_proxy: \"{{upstreams 8080}}\"\n"+
+			"  upstreams:\n"+
+			"    - 10.0.0.5\n"+
+			"    - 10.0.0.6\n"+
+			"- name: shared\n"+
+			"  labels:\n"+
+			"    caddy: service.testdomain.com\n"+
+			"    caddy.reverse_proxy: \"{{upstreams}}\"\n"+
+			"  upstreams:\n"+
+			"    - 10.0.0.7\n",
+	), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		{
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"caddy-network": {
+						IPAddress: "172.17.0.2",
+						NetworkID: caddyNetworkID,
+					},
+				},
+			},
+			Labels: map[string]string{
+				fmtLabel("%s"):               "service.testdomain.com",
+				fmtLabel("%s.reverse_proxy"): "{{upstreams}}",
+			},
+		},
+	}
+
+	const expectedCaddyfile = "legacy.testdomain.com {\n" +
+		"	reverse_proxy 10.0.0.5:8080 10.0.0.6:8080\n" +
+		"}\n" +
+		"service.testdomain.com {\n" +
+		"	reverse_proxy 172.17.0.2 10.0.0.7\n" +
+		"}\n"
+
+	expectedLogs := commonLogs +
+		`WARN	Route conflicts with an existing site	{"source": "` + routesPath + `", "route": "shared", "site": "service.testdomain.com"}` + newLine
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.ExtraRouteSources = []string{routesPath}
+	}, expectedCaddyfile, expectedLogs)
+}
+
+func TestSources_MissingFile(t *testing.T) {
+	routesPath := filepath.Join(t.TempDir(), "missing.yaml")
+
+	dockerClient := createBasicDockerClientMock()
+
+	const expectedCaddyfile = "# Empty caddyfile"
+
+	expectedLogs := commonLogs +
+		`ERROR	Failed to get routes from source	{"source": "` + routesPath + `", "error": "open ` + routesPath + `: no such file or directory"}` + newLine
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.ExtraRouteSources = []string{routesPath}
+	}, expectedCaddyfile, expectedLogs)
+}
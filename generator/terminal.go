@@ -0,0 +1,19 @@
+package generator
+
+import "github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+
+// makeRoutesTerminal converts route directives of sites into handle directives.
+// Unlike routes, handle directives are mutually exclusive, so a request matched by the
+// route of a service never falls through to routes of other services sharing the same site
+func makeRoutesTerminal(container *caddyfile.Container) {
+	for _, block := range container.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		for _, directive := range block.Children {
+			if directive.GetFirstKey() == "route" {
+				directive.Keys[0] = "handle"
+			}
+		}
+	}
+}
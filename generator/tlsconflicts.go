@@ -0,0 +1,86 @@
+package generator
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"go.uber.org/zap"
+)
+
+// tlsOwner is the container or service whose tls directive is used by a site
+type tlsOwner struct {
+	owner     string
+	directive *caddyfile.Block
+}
+
+type tlsConflict struct {
+	site      string
+	block     *caddyfile.Block
+	directive *caddyfile.Block
+	existing  *tlsOwner
+}
+
+// checkTLSConflicts registers the tls directives of sites of a container or service, detecting
+// sites whose tls directive differs from the one registered by another owner, and resolving
+// them with TLSConflictPolicy. Returns false when the container or service must be ignored
+func (g *CaddyfileGenerator) checkTLSConflicts(tlsOwners map[string]*tlsOwner, owner string, sourceCaddyfile *caddyfile.Container, logger *zap.Logger) bool {
+	conflicts := []*tlsConflict{}
+	for _, block := range sourceCaddyfile.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		site := strings.Join(block.Keys, " ")
+		for _, directive := range block.GetAllByFirstKey("tls") {
+			existing, exists := tlsOwners[site]
+			if !exists || existing.owner == owner || bytes.Equal(existing.directive.Marshal(), directive.Marshal()) {
+				continue
+			}
+			conflicts = append(conflicts, &tlsConflict{site: site, block: block, directive: directive, existing: existing})
+		}
+	}
+
+	if len(conflicts) > 0 && g.options.TLSConflictPolicy == config.TLSConflictError {
+		for _, conflict := range conflicts {
+			logger.Error("TLS conflict, ignoring routes", zap.String("site", conflict.site), zap.String("owner", conflict.existing.owner), zap.String("ignored", owner))
+		}
+		return false
+	}
+
+	for _, conflict := range conflicts {
+		if g.options.TLSConflictPolicy == config.TLSConflictMostSpecificWins && getTLSSpecificity(conflict.directive) > getTLSSpecificity(conflict.existing.directive) {
+			logger.Warn("TLS conflict, replacing tls", zap.String("site", conflict.site), zap.String("owner", conflict.existing.owner), zap.String("winner", owner))
+			// The existing directive was already merged, replace it in place
+			conflict.existing.directive.Keys = conflict.directive.Keys
+			conflict.existing.directive.Container = conflict.directive.Container
+			conflict.existing.owner = owner
+		} else {
+			logger.Warn("TLS conflict", zap.String("site", conflict.site), zap.String("owner", conflict.existing.owner), zap.String("ignored", owner))
+		}
+		conflict.block.Remove(conflict.directive)
+	}
+
+	for _, block := range sourceCaddyfile.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		site := strings.Join(block.Keys, " ")
+		if _, exists := tlsOwners[site]; exists {
+			continue
+		}
+		if directives := block.GetAllByFirstKey("tls"); len(directives) > 0 {
+			tlsOwners[site] = &tlsOwner{owner: owner, directive: directives[0]}
+		}
+	}
+	return true
+}
+
+// getTLSSpecificity counts the arguments and settings of a tls directive
+func getTLSSpecificity(directive *caddyfile.Block) int {
+	specificity := len(directive.Keys)
+	for _, child := range directive.Children {
+		specificity += getTLSSpecificity(child)
+	}
+	return specificity
+}
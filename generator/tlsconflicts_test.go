@@ -0,0 +1,101 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+)
+
+func createTLSConflictClient() *docker.ClientMock {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("public", map[string]string{
+			fmtLabel("%s"):                "shared.testdomain.com",
+			fmtLabel("%s.reverse_proxy"):  "/public/* {{upstreams 80}}",
+			fmtLabel("%s.tls.issuer"):     "acme",
+			fmtLabel("%s.tls.issuer.dir"): "https://acme.testdomain.com/directory",
+		}),
+		createService("internal", map[string]string{
+			fmtLabel("%s"):               "shared.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "/internal/* {{upstreams 80}}",
+			fmtLabel("%s.tls"):           "internal",
+		}),
+	}
+	return dockerClient
+}
+
+func TestTLSConflicts_FirstWins(t *testing.T) {
+	const expectedCaddyfile = "shared.testdomain.com {\n" +
+		"	reverse_proxy /internal/* internal:80\n" +
+		"	reverse_proxy /public/* public:80\n" +
+		"	tls internal\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`WARN	TLS conflict	{"site": "shared.testdomain.com", "owner": "service/internal", "ignored": "service/public"}` + newLine
+
+	testGeneration(t, createTLSConflictClient(), func(options *config.Options) {
+		options.TLSConflictPolicy = config.TLSConflictFirstWins
+	}, expectedCaddyfile, expectedLogs)
+}
+
+func TestTLSConflicts_Error(t *testing.T) {
+	const expectedCaddyfile = "shared.testdomain.com {\n" +
+		"	reverse_proxy /internal/* internal:80\n" +
+		"	tls internal\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`ERROR	TLS conflict, ignoring routes	{"site": "shared.testdomain.com", "owner": "service/internal", "ignored": "service/public"}` + newLine
+
+	testGeneration(t, createTLSConflictClient(), func(options *config.Options) {
+		options.TLSConflictPolicy = config.TLSConflictError
+	}, expectedCaddyfile, expectedLogs)
+}
+
+func TestTLSConflicts_MostSpecificWins(t *testing.T) {
+	const expectedCaddyfile = "shared.testdomain.com {\n" +
+		"	reverse_proxy /internal/* internal:80\n" +
+		"	reverse_proxy /public/* public:80\n" +
+		"	tls {\n" +
+		"		issuer acme {\n" +
+		"			dir https://acme.testdomain.com/directory\n" +
+		"		}\n" +
+		"	}\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`WARN	TLS conflict, replacing tls	{"site": "shared.testdomain.com", "owner": "service/internal", "winner": "service/public"}` + newLine
+
+	testGeneration(t, createTLSConflictClient(), func(options *config.Options) {
+		options.TLSConflictPolicy = config.TLSConflictMostSpecificWins
+	}, expectedCaddyfile, expectedLogs)
+}
+
+func TestTLSConflicts_SameTLS(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("public", map[string]string{
+			fmtLabel("%s"):               "shared.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "/public/* {{upstreams 80}}",
+			fmtLabel("%s.tls"):           "internal",
+		}),
+		createService("internal", map[string]string{
+			fmtLabel("%s"):               "shared.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "/internal/* {{upstreams 80}}",
+			fmtLabel("%s.tls"):           "internal",
+		}),
+	}
+
+	const expectedCaddyfile = "shared.testdomain.com {\n" +
+		"	reverse_proxy /internal/* internal:80\n" +
+		"	reverse_proxy /public/* public:80\n" +
+		"	tls internal\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, func(options *config.Options) {
+		options.TLSConflictPolicy = config.TLSConflictError
+	}, expectedCaddyfile, commonLogs)
+}
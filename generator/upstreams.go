@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+)
+
+// sortUpstreams sorts the upstreams of reverse_proxy directives of sites by IP and port,
+// removing duplicated ones. Tasks of a service are listed in no particular order, so
+// sorting their upstreams avoids changing the Caddyfile when only their order changed
+func sortUpstreams(container *caddyfile.Container) {
+	for _, block := range container.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		sortDirectivesUpstreams(block.Container)
+	}
+}
+
+// sortDirectivesUpstreams sorts upstreams of reverse_proxy directives, including the ones
+// nested in blocks like route and handle
+func sortDirectivesUpstreams(container *caddyfile.Container) {
+	for _, directive := range container.Children {
+		if directive.GetFirstKey() != "reverse_proxy" {
+			sortDirectivesUpstreams(directive.Container)
+			continue
+		}
+		first := 1
+		if len(directive.Keys) > 1 && isRouteMatcher(directive.Keys[1]) {
+			first = 2
+		}
+		if len(directive.Keys) > first {
+			directive.Keys = append(directive.Keys[:first], sortedUniqueUpstreams(directive.Keys[first:])...)
+		}
+	}
+}
+
+func sortedUniqueUpstreams(upstreams []string) []string {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, upstream := range upstreams {
+		if !seen[upstream] {
+			seen[upstream] = true
+			unique = append(unique, upstream)
+		}
+	}
+	sort.SliceStable(unique, func(i, j int) bool {
+		return compareUpstreams(unique[i], unique[j]) < 0
+	})
+	return unique
+}
+
+// compareUpstreams compares upstreams by host, numerically for IPs, then by port and then by
+// scheme. Upstreams that aren't addresses, like placeholders, compare as text
+func compareUpstreams(upstreamA string, upstreamB string) int {
+	schemeA, hostA, portA := splitUpstream(upstreamA)
+	schemeB, hostB, portB := splitUpstream(upstreamB)
+
+	ipA, ipB := net.ParseIP(hostA), net.ParseIP(hostB)
+	switch {
+	case ipA != nil && ipB != nil:
+		if c := bytes.Compare(ipA.To16(), ipB.To16()); c != 0 {
+			return c
+		}
+	case ipA != nil:
+		return -1
+	case ipB != nil:
+		return 1
+	default:
+		if c := strings.Compare(hostA, hostB); c != 0 {
+			return c
+		}
+	}
+	if portA != portB {
+		if portA < portB {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(schemeA, schemeB)
+}
+
+// splitUpstream splits an upstream like h2c://10.0.0.1:80 into its scheme, host and port.
+// Port is -1 when missing or not a number
+func splitUpstream(upstream string) (string, string, int) {
+	scheme := ""
+	if index := strings.Index(upstream, "://"); index >= 0 {
+		scheme, upstream = upstream[:index], upstream[index+3:]
+	}
+	host, portText, err := net.SplitHostPort(upstream)
+	if err != nil {
+		return scheme, strings.Trim(upstream, "[]"), -1
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		port = -1
+	}
+	return scheme, host, port
+}
@@ -0,0 +1,103 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func createReplicasDockerClientMock(addresses ...string) *docker.ClientMock {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		{
+			ID: "SERVICEID",
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{
+					Name: "service",
+					Labels: map[string]string{
+						fmtLabel("%s"):               "service.testdomain.com",
+						fmtLabel("%s.reverse_proxy"): "{{upstreams 5000}}",
+					},
+				},
+			},
+		},
+	}
+	for i, address := range addresses {
+		dockerClient.TasksData = append(dockerClient.TasksData, swarm.Task{
+			ID:        fmt.Sprintf("TASK%d", i),
+			ServiceID: "SERVICEID",
+			NetworksAttachments: []swarm.NetworkAttachment{
+				{
+					Network:   swarm.Network{ID: caddyNetworkID},
+					Addresses: []string{address},
+				},
+			},
+			DesiredState: swarm.TaskStateRunning,
+			Status:       swarm.TaskStatus{State: swarm.TaskStateRunning},
+		})
+	}
+	return dockerClient
+}
+
+func TestServiceTasks_UpstreamsSorted(t *testing.T) {
+	const expectedCaddyfile = "service.testdomain.com {\n" +
+		"	reverse_proxy 10.0.0.2:5000 10.0.0.9:5000 10.0.0.10:5000\n" +
+		"}\n"
+
+	// Tasks are sorted by ID, so replicas are listed in a different order on each client
+	addresses := [][]string{
+		{"10.0.0.10/24", "10.0.0.2/24", "10.0.0.9/24", "10.0.0.2/24"},
+		{"10.0.0.9/24", "10.0.0.2/24", "10.0.0.10/24"},
+	}
+	for _, taskAddresses := range addresses {
+		testGeneration(t, createReplicasDockerClientMock(taskAddresses...), func(options *config.Options) {
+			options.ProxyServiceTasks = true
+		}, expectedCaddyfile, commonLogs)
+	}
+}
+
+func TestServiceTasks_UpstreamsStableAcrossGenerations(t *testing.T) {
+	dockerClient := createReplicasDockerClientMock("10.0.0.3/24", "10.0.0.1/24", "10.0.0.2/24")
+	options := &config.Options{LabelPrefix: DefaultLabelPrefix, ProxyServiceTasks: true}
+	generator := CreateGenerator([]docker.Client{dockerClient}, createDockerUtilsMock(), options)
+
+	first, _, err := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	assert.NoError(t, err)
+
+	// Replicas rescheduled with their IPs swapped between tasks
+	dockerClient.TasksData[0].NetworksAttachments[0].Addresses = []string{"10.0.0.2/24"}
+	dockerClient.TasksData[2].NetworksAttachments[0].Addresses = []string{"10.0.0.3/24"}
+
+	second, _, err := generator.GenerateCaddyfile(context.Background(), zap.NewNop())
+	assert.NoError(t, err)
+	assert.Equal(t, string(first), string(second))
+}
+
+func TestSortedUniqueUpstreams(t *testing.T) {
+	upstreams := []string{
+		"backend:80",
+		"10.0.0.10:80",
+		"h2c://10.0.0.2:80",
+		"10.0.0.2:8080",
+		"10.0.0.2:80",
+		"{env.UPSTREAM}",
+		"10.0.0.10:80",
+		"[fd00::1]:80",
+	}
+
+	assert.Equal(t, []string{
+		"10.0.0.2:80",
+		"h2c://10.0.0.2:80",
+		"10.0.0.2:8080",
+		"10.0.0.10:80",
+		"[fd00::1]:80",
+		"backend:80",
+		"{env.UPSTREAM}",
+	}, sortedUniqueUpstreams(upstreams))
+}
@@ -0,0 +1,84 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"go.uber.org/zap"
+)
+
+// VariantHeaderLabel makes reverse proxies of a container or service only handle requests
+// with a header value, in the format "<header> <value>"
+const VariantHeaderLabel = "caddy_variant_header"
+
+// VariantCookieLabel makes reverse proxies of a container or service only handle requests
+// with a cookie value, in the format "<cookie> <value>"
+const VariantCookieLabel = "caddy_variant_cookie"
+
+// applyVariant restricts reverse proxies of a container or service marked as a variant to
+// requests matching the variant header or cookie. Requests not matching it fall through to
+// reverse proxies of other containers or services sharing the same site, allowing A/B routing
+func applyVariant(labels map[string]string, sourceCaddyfile *caddyfile.Container, logger *zap.Logger) {
+	matcher := getVariantMatcher(labels, logger)
+	if matcher == nil {
+		return
+	}
+
+	for _, block := range sourceCaddyfile.Children {
+		if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+			continue
+		}
+		applied := false
+		for _, directive := range block.Children {
+			firstKey := directive.GetFirstKey()
+			if firstKey != "reverse_proxy" && firstKey != "php_fastcgi" {
+				continue
+			}
+			if len(directive.Keys) > 1 && isRouteMatcher(directive.Keys[1]) {
+				logger.Warn("Variant not applied to directive with matcher", zap.String("site", strings.Join(block.Keys, " ")), zap.String("directive", strings.Join(directive.Keys, " ")))
+				continue
+			}
+			directive.Keys = append([]string{firstKey, matcher.Keys[0]}, directive.Keys[1:]...)
+			applied = true
+		}
+		if applied {
+			block.AddBlock(&caddyfile.Block{
+				Container: caddyfile.CreateContainer(),
+				Order:     matcher.Order,
+				Keys:      append([]string{}, matcher.Keys...),
+			})
+		}
+	}
+}
+
+// getVariantMatcher returns the matcher definition of variant labels, named after the
+// variant so replicas share it and different variants of the same site don't collide
+func getVariantMatcher(labels map[string]string, logger *zap.Logger) *caddyfile.Block {
+	label, value := VariantHeaderLabel, labels[VariantHeaderLabel]
+	if _, hasLabel := labels[VariantHeaderLabel]; !hasLabel {
+		label, value = VariantCookieLabel, labels[VariantCookieLabel]
+		if _, hasLabel := labels[VariantCookieLabel]; !hasLabel {
+			return nil
+		}
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		logger.Warn("Invalid value for label", zap.String("label", label), zap.String("value", value))
+		return nil
+	}
+	name, expected := fields[0], fields[1]
+
+	hash := sha256.Sum256([]byte(label + " " + name + " " + expected))
+	matcher := caddyfile.CreateBlock()
+	matcher.AddKeys("@variant_" + hex.EncodeToString(hash[:])[:8])
+	if label == VariantHeaderLabel {
+		matcher.AddKeys("header", name, expected)
+	} else {
+		matcher.AddKeys("header_regexp", "Cookie", "(^|;[ ]*)"+regexp.QuoteMeta(name)+"="+regexp.QuoteMeta(expected)+"(;|$)")
+	}
+	return matcher
+}
@@ -0,0 +1,108 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	_ "github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	_ "github.com/caddyserver/caddy/v2/modules/standard"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariants_Header(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("api", map[string]string{
+			fmtLabel("%s"):               "api.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+		createService("api-beta", map[string]string{
+			fmtLabel("%s"):               "api.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			VariantHeaderLabel:           "X-Variant beta",
+		}),
+	}
+
+	const expectedCaddyfile = "api.testdomain.com {\n" +
+		"	@variant_b13f978f header X-Variant beta\n" +
+		"	reverse_proxy @variant_b13f978f api-beta:80\n" +
+		"	reverse_proxy api:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"match":[{"header":{"X-Variant":["beta"]}}]`)
+}
+
+func TestVariants_Cookie(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("web", map[string]string{
+			fmtLabel("%s"):               "web.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+		}),
+		createService("web-next", map[string]string{
+			fmtLabel("%s"):               "web.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			VariantCookieLabel:           "release next",
+		}),
+	}
+
+	const expectedCaddyfile = "web.testdomain.com {\n" +
+		"	@variant_1647a8d6 header_regexp Cookie \"(^|;[ ]*)release=next(;|$)\"\n" +
+		"	reverse_proxy @variant_1647a8d6 web-next:80\n" +
+		"	reverse_proxy web:80\n" +
+		"}\n"
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, commonLogs)
+
+	configJSON, _, err := caddyconfig.GetAdapter("caddyfile").Adapt([]byte(expectedCaddyfile), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(configJSON), `"pattern":"(^|;[ ]*)release=next(;|$)"`)
+}
+
+func TestVariants_DirectiveWithMatcher(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("api-beta", map[string]string{
+			fmtLabel("%s"):                 "api.testdomain.com",
+			fmtLabel("%s.reverse_proxy"):   "{{upstreams 80}}",
+			fmtLabel("%s.reverse_proxy_1"): "/admin/* {{upstreams 8080}}",
+			VariantHeaderLabel:             "X-Variant beta",
+		}),
+	}
+
+	const expectedCaddyfile = "api.testdomain.com {\n" +
+		"	@variant_b13f978f header X-Variant beta\n" +
+		"	reverse_proxy /admin/* api-beta:8080\n" +
+		"	reverse_proxy @variant_b13f978f api-beta:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`WARN	Variant not applied to directive with matcher	{"site": "api.testdomain.com", "directive": "reverse_proxy /admin/* api-beta:8080"}` + newLine
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
+}
+
+func TestVariants_InvalidLabel(t *testing.T) {
+	dockerClient := createBasicDockerClientMock()
+	dockerClient.ServicesData = []swarm.Service{
+		createService("api-beta", map[string]string{
+			fmtLabel("%s"):               "api.testdomain.com",
+			fmtLabel("%s.reverse_proxy"): "{{upstreams 80}}",
+			VariantHeaderLabel:           "X-Variant",
+		}),
+	}
+
+	const expectedCaddyfile = "api.testdomain.com {\n" +
+		"	reverse_proxy api-beta:80\n" +
+		"}\n"
+
+	const expectedLogs = commonLogs +
+		`WARN	Invalid value for label	{"label": "caddy_variant_header", "value": "X-Variant"}` + newLine
+
+	testGeneration(t, dockerClient, nil, expectedCaddyfile, expectedLogs)
+}
@@ -0,0 +1,130 @@
+package caddydockerproxy
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+	"go.uber.org/zap"
+)
+
+// newHostLimiter limits how many never seen hostnames are introduced per time window,
+// deferring the sites of the remaining hostnames to later updates.
+// Hostnames present in the first generation are considered existing. Hostnames admitted
+// by filter only count as issued once commit is called, after they were successfully pushed
+type newHostLimiter struct {
+	limit       int
+	window      time.Duration
+	seeded      bool
+	issued      map[string]bool
+	pending     []string
+	windowStart time.Time
+	windowCount int
+}
+
+func createNewHostLimiter(limit int, window time.Duration) *newHostLimiter {
+	return &newHostLimiter{
+		limit:  limit,
+		window: window,
+		issued: map[string]bool{},
+	}
+}
+
+// filter removes sites introducing new hostnames over the limit, returning the resulting
+// caddyfile and how many sites were deferred. A site with more new hostnames than the limit
+// is admitted alone in an empty window, otherwise it would be deferred forever
+func (limiter *newHostLimiter) filter(caddyfileContent []byte, now time.Time, log *zap.Logger) ([]byte, int) {
+	limiter.pending = nil
+
+	container, err := caddyfile.Unmarshal(caddyfileContent)
+	if err != nil {
+		return caddyfileContent, 0
+	}
+
+	if !limiter.seeded {
+		for _, block := range container.Children {
+			for _, host := range getACMEHostnames(block) {
+				limiter.issued[host] = true
+			}
+		}
+		limiter.seeded = true
+		return caddyfileContent, 0
+	}
+
+	if now.Sub(limiter.windowStart) >= limiter.window {
+		limiter.windowStart = now
+		limiter.windowCount = 0
+	}
+
+	deferred := 0
+	windowCount := limiter.windowCount
+	for _, block := range container.Children {
+		newHosts := []string{}
+		for _, host := range getACMEHostnames(block) {
+			if !limiter.issued[host] {
+				newHosts = append(newHosts, host)
+			}
+		}
+		if len(newHosts) == 0 {
+			continue
+		}
+		if windowCount > 0 && windowCount+len(newHosts) > limiter.limit {
+			log.Info("Deferring site with new hostnames due to rate limit", zap.Strings("hostnames", newHosts))
+			container.Remove(block)
+			deferred++
+			continue
+		}
+		limiter.pending = append(limiter.pending, newHosts...)
+		windowCount += len(newHosts)
+	}
+
+	if deferred == 0 {
+		return caddyfileContent, 0
+	}
+	return container.Marshal(), deferred
+}
+
+// commit counts the hostnames admitted by the last filter as issued, called once the
+// configuration including them was successfully pushed
+func (limiter *newHostLimiter) commit() {
+	for _, host := range limiter.pending {
+		limiter.issued[host] = true
+	}
+	limiter.windowCount += len(limiter.pending)
+	limiter.pending = nil
+}
+
+// nextWindow returns the time until the current window ends
+func (limiter *newHostLimiter) nextWindow(now time.Time) time.Duration {
+	return limiter.windowStart.Add(limiter.window).Sub(now)
+}
+
+// getACMEHostnames returns the hostnames of a site block that can trigger certificate issuance
+func getACMEHostnames(block *caddyfile.Block) []string {
+	if block.IsGlobalBlock() || block.IsSnippet() || block.IsMatcher() {
+		return nil
+	}
+	hosts := []string{}
+	for _, key := range block.Keys {
+		for _, address := range strings.Split(key, ",") {
+			address = strings.TrimSpace(address)
+			if address == "" || strings.HasPrefix(address, "http://") {
+				continue
+			}
+			address = strings.TrimPrefix(address, "https://")
+			if index := strings.IndexAny(address, "/"); index >= 0 {
+				address = address[:index]
+			}
+			host := address
+			if h, _, err := net.SplitHostPort(address); err == nil {
+				host = h
+			}
+			if host == "" || host == "localhost" || net.ParseIP(host) != nil {
+				continue
+			}
+			hosts = append(hosts, strings.ToLower(host))
+		}
+	}
+	return hosts
+}
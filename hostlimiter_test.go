@@ -0,0 +1,159 @@
+package caddydockerproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestNewHostLimiter_RollsOutNewHostsWithinRate(t *testing.T) {
+	limiter := createNewHostLimiter(2, time.Hour)
+	now := time.Now()
+
+	existing := "existing.example.com {\n\trespond 200\n}\n"
+	result, deferred := limiter.filter([]byte(existing), now, zap.NewNop())
+	assert.Equal(t, existing, string(result))
+	assert.Equal(t, 0, deferred)
+
+	sites := existing
+	for i := 0; i < 5; i++ {
+		sites += fmt.Sprintf("new%d.example.com {\n\trespond 200\n}\n", i)
+	}
+
+	result, deferred = limiter.filter([]byte(sites), now, zap.NewNop())
+	assert.Equal(t, 3, deferred)
+	assert.Equal(t, 3, strings.Count(string(result), "respond 200"))
+	assert.Contains(t, string(result), "existing.example.com")
+	limiter.commit()
+
+	// Same window, no more new hosts allowed, but rolled out hosts are kept
+	result, deferred = limiter.filter([]byte(sites), now.Add(time.Minute), zap.NewNop())
+	assert.Equal(t, 3, deferred)
+	assert.Equal(t, 3, strings.Count(string(result), "respond 200"))
+	assert.Equal(t, 59*time.Minute, limiter.nextWindow(now.Add(time.Minute)))
+	limiter.commit()
+
+	// Next window
+	result, deferred = limiter.filter([]byte(sites), now.Add(time.Hour), zap.NewNop())
+	assert.Equal(t, 1, deferred)
+	assert.Equal(t, 5, strings.Count(string(result), "respond 200"))
+	limiter.commit()
+
+	result, deferred = limiter.filter([]byte(sites), now.Add(2*time.Hour), zap.NewNop())
+	assert.Equal(t, 0, deferred)
+	assert.Equal(t, sites, string(result))
+}
+
+func TestNewHostLimiter_IgnoresNonACMEAddresses(t *testing.T) {
+	limiter := createNewHostLimiter(1, time.Hour)
+	now := time.Now()
+	limiter.filter([]byte("# Empty caddyfile"), now, zap.NewNop())
+
+	sites := "http://plain.example.com {\n\trespond 200\n}\n" +
+		":8080 {\n\trespond 200\n}\n" +
+		"10.0.0.1 {\n\trespond 200\n}\n" +
+		"localhost {\n\trespond 200\n}\n" +
+		"a.example.com:8443 {\n\trespond 200\n}\n" +
+		"b.example.com {\n\trespond 200\n}\n"
+
+	result, deferred := limiter.filter([]byte(sites), now, zap.NewNop())
+	assert.Equal(t, 1, deferred)
+	assert.Equal(t, 5, strings.Count(string(result), "respond 200"))
+	assert.NotContains(t, string(result), "b.example.com")
+}
+
+func TestNewHostLimiter_AdmitsSiteOverLimitInEmptyWindow(t *testing.T) {
+	limiter := createNewHostLimiter(2, time.Hour)
+	now := time.Now()
+	limiter.filter([]byte("# Empty caddyfile"), now, zap.NewNop())
+
+	sites := "a.example.com, b.example.com, c.example.com {\n\trespond 200\n}\n" +
+		"d.example.com {\n\trespond 200\n}\n"
+
+	result, deferred := limiter.filter([]byte(sites), now, zap.NewNop())
+	assert.Equal(t, 1, deferred)
+	assert.Contains(t, string(result), "c.example.com")
+	assert.NotContains(t, string(result), "d.example.com")
+	limiter.commit()
+
+	// The window is full until the next one
+	_, deferred = limiter.filter([]byte(sites), now.Add(time.Minute), zap.NewNop())
+	assert.Equal(t, 1, deferred)
+
+	result, deferred = limiter.filter([]byte(sites), now.Add(time.Hour), zap.NewNop())
+	assert.Equal(t, 0, deferred)
+	assert.Equal(t, sites, string(result))
+}
+
+func TestNewHostLimiter_CountsHostsOnlyOnceCommitted(t *testing.T) {
+	limiter := createNewHostLimiter(1, time.Hour)
+	now := time.Now()
+	limiter.filter([]byte("# Empty caddyfile"), now, zap.NewNop())
+
+	sites := "a.example.com {\n\trespond 200\n}\n" +
+		"b.example.com {\n\trespond 200\n}\n"
+
+	// The push failed, so a.example.com is admitted again without counting twice
+	_, deferred := limiter.filter([]byte(sites), now, zap.NewNop())
+	assert.Equal(t, 1, deferred)
+	result, deferred := limiter.filter([]byte(sites), now.Add(time.Minute), zap.NewNop())
+	assert.Equal(t, 1, deferred)
+	assert.Contains(t, string(result), "a.example.com")
+	assert.False(t, limiter.issued["a.example.com"])
+
+	limiter.commit()
+	assert.True(t, limiter.issued["a.example.com"])
+	assert.Equal(t, 1, limiter.windowCount)
+}
+
+func TestUpdate_CommitsNewHostsOnceConfigured(t *testing.T) {
+	var healthy atomic.Bool
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer admin.Close()
+	adminURL, _ := url.Parse(admin.URL)
+
+	dockerClient := createDockerClientMock()
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.NewHostRateLimit = 1
+		options.NewHostRateWindow = time.Hour
+	})
+	loader.serverResolver = &serverResolverMock{servers: []string{}}
+	assert.True(t, loader.update())
+
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "a.example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+		createContainer("172.17.0.3", map[string]string{
+			"caddy":               "b.example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+	}
+	loader.serverResolver = &serverResolverMock{servers: []string{adminURL.Host}}
+
+	assert.True(t, loader.update())
+	assert.Contains(t, string(loader.lastCaddyfile), "a.example.com")
+	assert.False(t, loader.hostLimiter.issued["a.example.com"])
+	assert.Equal(t, 0, loader.hostLimiter.windowCount)
+
+	healthy.Store(true)
+	assert.True(t, loader.update())
+	assert.True(t, loader.hostLimiter.issued["a.example.com"])
+	assert.False(t, loader.hostLimiter.issued["b.example.com"])
+	assert.Equal(t, 1, loader.hostLimiter.windowCount)
+}
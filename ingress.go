@@ -0,0 +1,77 @@
+package caddydockerproxy
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/generator"
+	"go.uber.org/zap"
+)
+
+// getIngressNetworksFromLabel merges the ingress networks listed in the caddy container
+// label into the given ingress networks, keeping their order and removing duplicates
+func getIngressNetworksFromLabel(ingressNetworks []string, dockerClients []docker.Client, dockerUtils docker.Utils, log *zap.Logger) []string {
+	containerID, err := dockerUtils.GetCurrentContainerID()
+	if err != nil {
+		log.Debug("Failed to get caddy container ID, ignoring ingress networks label", zap.Error(err))
+		return ingressNetworks
+	}
+
+	result := []string{}
+	seen := map[string]bool{}
+	add := func(network string) {
+		network = strings.TrimSpace(network)
+		if network == "" || seen[network] {
+			return
+		}
+		seen[network] = true
+		result = append(result, network)
+	}
+	for _, network := range ingressNetworks {
+		add(network)
+	}
+
+	for _, dockerClient := range dockerClients {
+		container, err := dockerClient.ContainerInspect(context.Background(), containerID)
+		if err != nil || container.Config == nil {
+			continue
+		}
+		if value, ok := container.Config.Labels[generator.IngressNetworksLabel]; ok {
+			log.Info("Ingress networks loaded from label", zap.String("label", generator.IngressNetworksLabel), zap.String("networks", value))
+			for _, network := range strings.Split(value, ",") {
+				add(network)
+			}
+		}
+	}
+
+	return result
+}
+
+// warnMissingIngressNetworks logs a warning for each ingress network not found by name or ID
+// in any docker host. It doesn't fail, as networks may be created after caddy starts
+func warnMissingIngressNetworks(ingressNetworks []string, dockerClients []docker.Client, log *zap.Logger) {
+	if len(ingressNetworks) == 0 {
+		return
+	}
+
+	found := map[string]bool{}
+	for _, dockerClient := range dockerClients {
+		networks, err := dockerClient.NetworkList(context.Background(), types.NetworkListOptions{})
+		if err != nil {
+			log.Warn("Failed to list networks, not checking ingress networks", zap.Error(err))
+			return
+		}
+		for _, network := range networks {
+			found[network.Name] = true
+			found[network.ID] = true
+		}
+	}
+
+	for _, network := range ingressNetworks {
+		if !found[network] {
+			log.Warn("Ingress network not found, containers in it won't get upstreams until it's created", zap.String("network", network))
+		}
+	}
+}
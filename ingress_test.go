@@ -0,0 +1,64 @@
+package caddydockerproxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestIngressNetworksFromLabel(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainerInspectData = map[string]types.ContainerJSON{
+		"CADDY-ID": {
+			Config: &container.Config{
+				Labels: map[string]string{
+					"caddy_ingress_networks": "caddy, frontend",
+				},
+			},
+		},
+	}
+	dockerUtils := &docker.UtilsMock{
+		MockGetCurrentContainerID: func() (string, error) {
+			return "CADDY-ID", nil
+		},
+	}
+	options := &config.Options{
+		IngressNetworks: []string{"caddy", "backend"},
+	}
+
+	options.IngressNetworks = getIngressNetworksFromLabel(options.IngressNetworks, []docker.Client{dockerClient}, dockerUtils, zap.NewNop())
+
+	assert.Equal(t, []string{"caddy", "backend", "frontend"}, options.IngressNetworks)
+}
+
+func TestIngressNetworksFromLabel_NotInContainer(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerUtils := &docker.UtilsMock{
+		MockGetCurrentContainerID: func() (string, error) {
+			return "", errors.New("not in a container")
+		},
+	}
+
+	ingressNetworks := getIngressNetworksFromLabel([]string{"caddy"}, []docker.Client{dockerClient}, dockerUtils, zap.NewNop())
+
+	assert.Equal(t, []string{"caddy"}, ingressNetworks)
+}
+
+func TestWarnMissingIngressNetworks(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.NetworksData = []types.NetworkResource{
+		{ID: "NETWORK-ID", Name: "caddy"},
+	}
+
+	logs := captureLogs(func(log *zap.Logger) {
+		warnMissingIngressNetworks([]string{"caddy", "NETWORK-ID", "cadyd"}, []docker.Client{dockerClient}, log)
+	})
+
+	assert.Equal(t, "WARN\tIngress network not found, containers in it won't get upstreams until it's created\t{\"network\": \"cadyd\"}\n", logs)
+}
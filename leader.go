@@ -0,0 +1,181 @@
+package caddydockerproxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"go.uber.org/zap"
+)
+
+const (
+	leaderHolderLabel  = "caddy_leader"
+	leaderExpiresLabel = "caddy_leader_expires"
+)
+
+// leaderLock elects a single controller among the ones sharing a swarm, using a swarm config
+// named after the lock as a lease. The labels of the config hold the current leader and when
+// its lease expires. Swarm only updates a config at its current version, so when several
+// controllers take over an expired lease at once, only one of them succeeds.
+// Expiration is compared with the local clock, so nodes clocks must be roughly in sync
+type leaderLock struct {
+	client   docker.Client
+	name     string
+	holder   string
+	lease    time.Duration
+	configID string
+	held     atomic.Bool
+}
+
+func createLeaderLock(client docker.Client, name string, lease time.Duration) *leaderLock {
+	return &leaderLock{
+		client: client,
+		name:   name,
+		holder: leaderHolderID(),
+		lease:  lease,
+	}
+}
+
+// leaderHolderID identifies this controller, hostnames are usually unique per container
+func leaderHolderID() string {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", hostname, hex.EncodeToString(suffix))
+}
+
+// isHeld reports whether this controller was the leader at the last acquire
+func (lock *leaderLock) isHeld() bool {
+	return lock.held.Load()
+}
+
+// acquire creates the lock config, renews the lease when held, or takes over a lease that expired
+// or was released, returning whether this controller is the leader
+func (lock *leaderLock) acquire(ctx context.Context, now time.Time) (bool, error) {
+	held, err := lock.tryAcquire(ctx, now)
+	lock.held.Store(held)
+	return held, err
+}
+
+func (lock *leaderLock) tryAcquire(ctx context.Context, now time.Time) (bool, error) {
+	config, found, err := lock.find(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	labels := map[string]string{
+		leaderHolderLabel:  lock.holder,
+		leaderExpiresLabel: now.Add(lock.lease).UTC().Format(time.RFC3339Nano),
+	}
+
+	if !found {
+		response, err := lock.client.ConfigCreate(ctx, swarm.ConfigSpec{
+			Annotations: swarm.Annotations{Name: lock.name, Labels: labels},
+			Data:        []byte(lock.name),
+		})
+		if errdefs.IsConflict(err) {
+			// Another controller created it first
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		lock.configID = response.ID
+		return true, nil
+	}
+
+	if holder := config.Spec.Labels[leaderHolderLabel]; holder != lock.holder && holder != "" {
+		expires, err := time.Parse(time.RFC3339Nano, config.Spec.Labels[leaderExpiresLabel])
+		if err == nil && now.Before(expires) {
+			return false, nil
+		}
+	}
+
+	spec := config.Spec
+	spec.Labels = labels
+	if err := lock.client.ConfigUpdate(ctx, config.ID, config.Version, spec); err != nil {
+		// The lease changed since it was read, another controller renewed or took it over
+		return false, nil
+	}
+	lock.configID = config.ID
+	return true, nil
+}
+
+// find returns the lock config. The name filter matches prefixes, so names are compared exactly
+func (lock *leaderLock) find(ctx context.Context) (swarm.Config, bool, error) {
+	configs, err := lock.client.ConfigList(ctx, types.ConfigListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", lock.name)),
+	})
+	if err != nil {
+		return swarm.Config{}, false, err
+	}
+	for _, config := range configs {
+		if config.Spec.Name == lock.name {
+			return config, true, nil
+		}
+	}
+	return swarm.Config{}, false, nil
+}
+
+// release clears the holder of the lease, so another controller takes over at its next acquire
+// instead of waiting for the lease to expire. Nothing is released when another controller took
+// over the lease, and updating at the version read fails if one does meanwhile
+func (lock *leaderLock) release(ctx context.Context) error {
+	if !lock.held.Swap(false) {
+		return nil
+	}
+	config, _, err := lock.client.ConfigInspectWithRaw(ctx, lock.configID)
+	if err != nil {
+		return err
+	}
+	if config.Spec.Labels[leaderHolderLabel] != lock.holder {
+		return nil
+	}
+	spec := config.Spec
+	spec.Labels = map[string]string{leaderHolderLabel: ""}
+	return lock.client.ConfigUpdate(ctx, config.ID, config.Version, spec)
+}
+
+// runElection acquires or renews leadership every third of the lease until done is
+// closed, calling onElected when this controller becomes the leader
+func (lock *leaderLock) runElection(done <-chan struct{}, onElected func()) {
+	ticker := time.NewTicker(lock.lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			lock.elect(onElected)
+		case <-done:
+			return
+		}
+	}
+}
+
+// elect runs an acquire, logging leadership changes and calling onElected when elected
+func (lock *leaderLock) elect(onElected func()) {
+	log := logger()
+	wasHeld := lock.isHeld()
+	ctx, cancel := context.WithTimeout(context.Background(), lock.lease/3)
+	defer cancel()
+	held, err := lock.acquire(ctx, time.Now())
+	if err != nil {
+		log.Warn("Failed to acquire leader lock", zap.String("lock", lock.name), zap.Error(err))
+	}
+	if held && !wasHeld {
+		log.Info("Elected leader, distributing configurations", zap.String("lock", lock.name), zap.String("holder", lock.holder))
+		if onElected != nil {
+			onElected()
+		}
+	} else if !held && wasHeld {
+		log.Warn("Lost leadership, no longer distributing configurations", zap.String("lock", lock.name))
+	}
+}
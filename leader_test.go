@@ -0,0 +1,88 @@
+package caddydockerproxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaderLock_Election(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	first := createLeaderLock(dockerClient, "caddy-leader", time.Minute)
+	second := createLeaderLock(dockerClient, "caddy-leader", time.Minute)
+	ctx := context.Background()
+	now := time.Now()
+
+	held, err := first.acquire(ctx, now)
+	assert.NoError(t, err)
+	assert.True(t, held)
+
+	held, err = second.acquire(ctx, now)
+	assert.NoError(t, err)
+	assert.False(t, held)
+
+	// The leader renews its lease
+	held, _ = first.acquire(ctx, now.Add(50*time.Second))
+	assert.True(t, held)
+	held, _ = second.acquire(ctx, now.Add(70*time.Second))
+	assert.False(t, held)
+
+	// Once the lease expires, another controller takes over
+	held, _ = second.acquire(ctx, now.Add(2*time.Minute))
+	assert.True(t, held)
+	held, _ = first.acquire(ctx, now.Add(2*time.Minute))
+	assert.False(t, held)
+	assert.Len(t, dockerClient.ConfigsData, 1)
+}
+
+func TestLeaderLock_Release(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	first := createLeaderLock(dockerClient, "caddy-leader", time.Minute)
+	second := createLeaderLock(dockerClient, "caddy-leader", time.Minute)
+	ctx := context.Background()
+	now := time.Now()
+
+	first.acquire(ctx, now)
+	assert.NoError(t, first.release(ctx))
+	assert.False(t, first.isHeld())
+
+	held, err := second.acquire(ctx, now)
+	assert.NoError(t, err)
+	assert.True(t, held)
+
+	// Releasing a lease taken over by another controller keeps it
+	first.held.Store(true)
+	assert.NoError(t, first.release(ctx))
+	assert.Equal(t, second.holder, dockerClient.ConfigsData[0].Spec.Labels[leaderHolderLabel])
+}
+
+func TestUpdate_NonLeaderSkipsDistribution(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams 80}}",
+		}),
+	}
+	resolver := &serverResolverMock{servers: []string{}}
+	loader := createTestLoader(t, dockerClient, nil)
+	loader.serverResolver = resolver
+
+	other := createLeaderLock(dockerClient, "caddy-leader", time.Minute)
+	other.acquire(context.Background(), time.Now())
+	loader.leaderLock = createLeaderLock(dockerClient, "caddy-leader", time.Minute)
+	loader.leaderLock.acquire(context.Background(), time.Now())
+
+	assert.True(t, loader.update())
+	assert.Equal(t, int64(1), loader.lastVersion)
+	assert.Nil(t, resolver.caddyfile)
+
+	other.release(context.Background())
+	loader.leaderLock.acquire(context.Background(), time.Now())
+
+	assert.True(t, loader.update())
+	assert.NotNil(t, resolver.caddyfile)
+}
@@ -2,13 +2,23 @@ package caddydockerproxy
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"path"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"os"
@@ -16,9 +26,10 @@ import (
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig"
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/client"
 	"github.com/joho/godotenv"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
 	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
 	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
 	"github.com/lucaslorentz/caddy-docker-proxy/v2/generator"
@@ -27,29 +38,114 @@ import (
 	"go.uber.org/zap"
 )
 
+// pushLoadPath is the admin endpoint of docker proxy servers accepting compressed configurations
+const pushLoadPath = "/docker-proxy/load"
+
+// healthProbeInterval is the interval between health probes of servers after configuring them
+const healthProbeInterval = time.Second
+
 var CaddyfileAutosavePath = filepath.Join(caddy.AppConfigDir(), "Caddyfile.autosave")
 
 // DockerLoader generates caddy files from docker swarm information
 type DockerLoader struct {
-	options         *config.Options
-	initialized     bool
-	dockerClients   []docker.Client
-	generator       *generator.CaddyfileGenerator
-	timer           *time.Timer
-	skipEvents      []bool
-	lastCaddyfile   []byte
-	lastJSONConfig  []byte
-	lastVersion     int64
-	serversVersions *utils.StringInt64CMap
-	serversUpdating *utils.StringBoolCMap
+	options              *config.Options
+	initialized          bool
+	dockerClients        []docker.Client
+	generator            *generator.CaddyfileGenerator
+	timer                *time.Timer
+	updateMutex          sync.Mutex
+	stopped              bool
+	cancel               context.CancelFunc
+	running              sync.WaitGroup
+	eventsDebounce       *eventsDebounce
+	lastCaddyfile        []byte
+	lastCaddyfileVersion int64
+	lastJSONConfig       []byte
+	lastVersion          int64
+	serversVersions      *utils.StringInt64CMap
+	serversUpdating      *utils.StringBoolCMap
+	serversHashes        *utils.StringBytesCMap
+	eventsTracker        *eventsTracker
+	eventFilter          *eventFilter
+	hostLimiter          *newHostLimiter
+	httpClient           *http.Client
+	serversConfigs       *utils.StringBytesCMap
+	bootRetries          int
+	lastDiff             atomic.Pointer[generator.ConfigDiff]
+	serverResolver       ServerResolver
+	reconcileDue         atomic.Bool
+	ready                atomic.Bool
+	drainBase            []byte
+	drains               []routeDrain
+	pollingInterval      time.Duration
+	lastPollTime         time.Time
+	lastUpdateStart      time.Time
+	lastUpdateOK         bool
+	lastRejected         bool
+	leaderLock           *leaderLock
+	serversBreakers      *utils.CMap[serverBreaker]
+	serversNoGzip        *utils.StringBoolCMap
+	serversEtags         *utils.CMap[string]
+	serversStatuses      *utils.CMap[ServerStatus]
+	lookupSRV            srvLookup
+	lastSRVServers       []string
+	validate             func(*caddy.Config) error
 }
 
 // CreateDockerLoader creates a docker loader
 func CreateDockerLoader(options *config.Options) *DockerLoader {
+	var hostLimiter *newHostLimiter
+	if options.NewHostRateLimit > 0 {
+		hostLimiter = createNewHostLimiter(options.NewHostRateLimit, options.NewHostRateWindow)
+	}
+
 	return &DockerLoader{
 		options:         options,
 		serversVersions: utils.NewStringInt64CMap(),
 		serversUpdating: utils.NewStringBoolCMap(),
+		serversHashes:   utils.NewStringBytesCMap(),
+		serversConfigs:  utils.NewStringBytesCMap(),
+		serversBreakers: utils.NewCMap[serverBreaker](),
+		serversNoGzip:   utils.NewStringBoolCMap(),
+		serversEtags:    utils.NewCMap[string](),
+		serversStatuses: utils.NewCMap[ServerStatus](),
+		lookupSRV:       net.DefaultResolver.LookupSRV,
+		validate:        caddy.Validate,
+		eventsTracker:   newEventsTracker(),
+		eventFilter:     newEventFilter(options),
+		eventsDebounce:  newEventsDebounce(options.EventThrottleInterval, options.EventDebounceMaxWait),
+		hostLimiter:     hostLimiter,
+		httpClient:      createPushClient(options.PushSourceAddr, nil, options.AdminRequestTimeout),
+		bootRetries:     options.EmptyBootRetries,
+		serverResolver:  registeredServerResolver,
+	}
+}
+
+// createPushClient creates the http client used to push configurations to servers, failing
+// requests after timeout, binding its connections to sourceAddr and using tlsConfig when defined
+func createPushClient(sourceAddr net.IP, tlsConfig *tls.Config, timeout time.Duration) *http.Client {
+	client := &http.Client{
+		Timeout: timeout,
+	}
+	if sourceAddr == nil && tlsConfig == nil {
+		return client
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if sourceAddr != nil {
+		transport.DialContext = createPushDialer(sourceAddr).DialContext
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	client.Transport = transport
+	return client
+}
+
+func createPushDialer(sourceAddr net.IP) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		LocalAddr: &net.TCPAddr{IP: sourceAddr},
 	}
 }
 
@@ -67,6 +163,61 @@ func (dockerLoader *DockerLoader) Start() error {
 	dockerLoader.initialized = true
 	log := logger()
 
+	if err := validateAdminPort(dockerLoader.options); err != nil {
+		log.Error("Invalid admin port", zap.Error(err))
+		return err
+	}
+
+	if err := validateAdminLoad(dockerLoader.options); err != nil {
+		log.Error("Invalid admin load endpoint", zap.Error(err))
+		return err
+	}
+	if overrides := adminLoadOverrides(dockerLoader.options); len(overrides) > 0 {
+		log.Warn("Custom admin load endpoint is overridden, configurations are sent with POST to other paths",
+			zap.String("path", getAdminLoadPath(dockerLoader.options)),
+			zap.String("method", getAdminLoadMethod(dockerLoader.options)),
+			zap.Strings("options", overrides))
+	}
+
+	adminTLSConfig, err := createAdminTLSConfig(dockerLoader.options)
+	if err != nil {
+		log.Error("Failed to create admin TLS config", zap.Error(err))
+		return err
+	}
+	if adminTLSConfig != nil {
+		dockerLoader.httpClient = createPushClient(dockerLoader.options.PushSourceAddr, adminTLSConfig, dockerLoader.options.AdminRequestTimeout)
+	}
+
+	if err := dockerLoader.connect(log); err != nil {
+		return err
+	}
+
+	log.Info(
+		"Start",
+		zap.String("CaddyfilePath", dockerLoader.options.CaddyfilePath),
+		zap.String("EnvFile", dockerLoader.options.EnvFile),
+		zap.String("LabelPrefix", dockerLoader.options.LabelPrefix),
+		zap.Strings("ExtraLabelPrefixes", dockerLoader.options.ExtraLabelPrefixes),
+		zap.Duration("PollingInterval", dockerLoader.options.PollingInterval),
+		zap.Duration("MaxPollingInterval", dockerLoader.options.MaxPollingInterval),
+		zap.Duration("GenerationTimeout", dockerLoader.options.GenerationTimeout),
+		zap.String("LeaderLock", dockerLoader.options.LeaderLock),
+		zap.Bool("ProxyServiceTasks", dockerLoader.options.ProxyServiceTasks),
+		zap.Bool("ProcessCaddyfile", dockerLoader.options.ProcessCaddyfile),
+		zap.Bool("ScanStoppedContainers", dockerLoader.options.ScanStoppedContainers),
+		zap.String("IngressNetworks", fmt.Sprintf("%v", dockerLoader.options.IngressNetworks)),
+		zap.Strings("DockerSockets", dockerLoader.options.DockerSockets),
+		zap.Strings("DockerCertsPath", dockerLoader.options.DockerCertsPath),
+		zap.Strings("DockerAPIsVersion", dockerLoader.options.DockerAPIsVersion),
+	)
+
+	activeLoader.Store(dockerLoader)
+
+	return dockerLoader.run(log)
+}
+
+// connect loads the environment file, connects to docker hosts and creates the generator
+func (dockerLoader *DockerLoader) connect(log *zap.Logger) error {
 	if envFile := dockerLoader.options.EnvFile; envFile != "" {
 		if err := godotenv.Load(dockerLoader.options.EnvFile); err != nil {
 			log.Error("Load variables from environment file failed", zap.Error(err), zap.String("envFile", dockerLoader.options.EnvFile))
@@ -109,15 +260,28 @@ func (dockerLoader *DockerLoader) Start() error {
 
 		dockerClient.NegotiateAPIVersionPing(dockerPing)
 
-		wrappedClient := docker.WrapClient(dockerClient)
+		log.Info("Docker API version negotiated", zap.String("DockerSocket", dockerSocket), zap.String("version", dockerClient.ClientVersion()), zap.String("daemonVersion", dockerPing.APIVersion))
+		if err := checkDockerAPIVersion(dockerSocket, dockerPing); err != nil {
+			log.Error("Unsupported docker API version", zap.Error(err))
+			return err
+		}
+
+		wrappedClient := docker.WrapCycleCache(docker.WrapClient(dockerClient))
 
 		dockerClients = append(dockerClients, wrappedClient)
 	}
 
-	// by default it will used the env docker
+	// by default it will used the docker host option or the env docker
 	if len(dockerClients) == 0 {
-		dockerClient, err := client.NewEnvClient()
-		dockerLoader.options.DockerSockets = append(dockerLoader.options.DockerSockets, os.Getenv("DOCKER_HOST"))
+		dockerHost, source, err := resolveDockerHost(dockerLoader.options)
+		if err != nil {
+			log.Error("Invalid docker host", zap.Error(err))
+			return err
+		}
+		log.Info("Using docker host", zap.String("DockerHost", dockerHost), zap.String("source", source))
+
+		dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithHost(dockerHost))
+		dockerLoader.options.DockerSockets = append(dockerLoader.options.DockerSockets, dockerHost)
 		if err != nil {
 			log.Error("Docker connection failed", zap.Error(err))
 			return err
@@ -131,161 +295,840 @@ func (dockerLoader *DockerLoader) Start() error {
 
 		dockerClient.NegotiateAPIVersionPing(dockerPing)
 
-		wrappedClient := docker.WrapClient(dockerClient)
+		log.Info("Docker API version negotiated", zap.String("DockerHost", dockerHost), zap.String("version", dockerClient.ClientVersion()), zap.String("daemonVersion", dockerPing.APIVersion))
+		if err := checkDockerAPIVersion(dockerHost, dockerPing); err != nil {
+			log.Error("Unsupported docker API version", zap.Error(err))
+			return err
+		}
+
+		wrappedClient := docker.WrapCycleCache(docker.WrapClient(dockerClient))
 
 		dockerClients = append(dockerClients, wrappedClient)
 	}
 
 	dockerLoader.dockerClients = dockerClients
-	dockerLoader.skipEvents = make([]bool, len(dockerLoader.dockerClients))
+
+	dockerUtils := docker.CreateUtils()
+	dockerLoader.options.IngressNetworks = getIngressNetworksFromLabel(dockerLoader.options.IngressNetworks, dockerClients, dockerUtils, log)
+	warnMissingIngressNetworks(dockerLoader.options.IngressNetworks, dockerClients, log)
 
 	dockerLoader.generator = generator.CreateGenerator(
 		dockerClients,
-		docker.CreateUtils(),
+		dockerUtils,
 		dockerLoader.options,
 	)
 
-	log.Info(
-		"Start",
-		zap.String("CaddyfilePath", dockerLoader.options.CaddyfilePath),
-		zap.String("EnvFile", dockerLoader.options.EnvFile),
-		zap.String("LabelPrefix", dockerLoader.options.LabelPrefix),
-		zap.Duration("PollingInterval", dockerLoader.options.PollingInterval),
-		zap.Bool("ProxyServiceTasks", dockerLoader.options.ProxyServiceTasks),
-		zap.Bool("ProcessCaddyfile", dockerLoader.options.ProcessCaddyfile),
-		zap.Bool("ScanStoppedContainers", dockerLoader.options.ScanStoppedContainers),
-		zap.String("IngressNetworks", fmt.Sprintf("%v", dockerLoader.options.IngressNetworks)),
-		zap.Strings("DockerSockets", dockerLoader.options.DockerSockets),
-		zap.Strings("DockerCertsPath", dockerLoader.options.DockerCertsPath),
-		zap.Strings("DockerAPIsVersion", dockerLoader.options.DockerAPIsVersion),
-	)
+	return nil
+}
+
+// run starts updating servers on timer, docker events and reconcile schedule until Stop is called
+func (dockerLoader *DockerLoader) run(log *zap.Logger) error {
+	var schedule *cronSchedule
+	if dockerLoader.options.ReconcileCron != "" {
+		var err error
+		schedule, err = parseCronSchedule(dockerLoader.options.ReconcileCron)
+		if err != nil {
+			log.Error("Invalid reconcile cron", zap.String("ReconcileCron", dockerLoader.options.ReconcileCron), zap.Error(err))
+			return err
+		}
+	}
+
+	dockerLoader.updateMutex.Lock()
+	dockerLoader.stopped = false
+	dockerLoader.updateMutex.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dockerLoader.cancel = cancel
+
+	if lockName := dockerLoader.options.LeaderLock; lockName != "" {
+		dockerLoader.leaderLock = createLeaderLock(dockerLoader.dockerClients[0], lockName, dockerLoader.options.LeaderLeaseDuration)
+		dockerLoader.leaderLock.elect(nil)
+	}
 
 	ready := make(chan struct{})
-	dockerLoader.timer = time.AfterFunc(0, func() {
+	dockerLoader.timer = time.AfterFunc(dockerLoader.initialPollingDelay(), func() {
 		<-ready
-		dockerLoader.update()
+		dockerLoader.updateOnTimer(time.Now())
 	})
 	close(ready)
 
-	go dockerLoader.monitorEvents()
+	dockerLoader.running.Add(1)
+	go func() {
+		defer dockerLoader.running.Done()
+		dockerLoader.monitorEvents(ctx)
+	}()
+
+	if dockerLoader.leaderLock != nil {
+		dockerLoader.running.Add(1)
+		go func() {
+			defer dockerLoader.running.Done()
+			// Push to servers as soon as elected instead of at the next poll
+			dockerLoader.leaderLock.runElection(ctx.Done(), func() { dockerLoader.timer.Reset(0) })
+		}()
+	}
+
+	if schedule != nil {
+		dockerLoader.running.Add(1)
+		go func() {
+			defer dockerLoader.running.Done()
+			dockerLoader.runReconcileSchedule(schedule, ctx.Done())
+		}()
+	}
 
 	return nil
 }
 
-func (dockerLoader *DockerLoader) monitorEvents() {
+// Stop stops listening to docker events and updating servers, waiting for the update in
+// progress and its configuration pushes to finish
+func (dockerLoader *DockerLoader) Stop() error {
+	if dockerLoader.cancel == nil {
+		return nil
+	}
+	dockerLoader.cancel()
+	dockerLoader.cancel = nil
+	dockerLoader.timer.Stop()
+	dockerLoader.running.Wait()
+
+	// Updates already triggered by the timer return without updating once stopped
+	dockerLoader.updateMutex.Lock()
+	dockerLoader.stopped = true
+	dockerLoader.updateMutex.Unlock()
+
+	// Released once no update can push anymore, so another controller takes over right away
+	if dockerLoader.leaderLock != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := dockerLoader.leaderLock.release(ctx); err != nil {
+			logger().Warn("Failed to release leader lock", zap.String("lock", dockerLoader.options.LeaderLock), zap.Error(err))
+		}
+		cancel()
+		dockerLoader.leaderLock = nil
+	}
+
+	activeLoader.CompareAndSwap(dockerLoader, nil)
+	dockerLoader.initialized = false
+	logger().Info("Stopped")
+	return nil
+}
+
+// monitorEvents listens to docker events of every docker host until ctx is done
+func (dockerLoader *DockerLoader) monitorEvents(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range dockerLoader.dockerClients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dockerLoader.monitorClientEvents(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// monitorClientEvents listens to docker events of the docker client at index i until ctx is done,
+// reconnecting after errors with exponential backoff
+func (dockerLoader *DockerLoader) monitorClientEvents(ctx context.Context, i int) {
+	var delay time.Duration
+	failures := 0
 	for {
-		dockerLoader.listenEvents()
-		time.Sleep(30 * time.Second)
+		connectedAt := time.Now()
+		dockerLoader.listenEvents(ctx, i)
+		if ctx.Err() != nil {
+			return
+		}
+		connected := time.Since(connectedAt)
+		if connected >= dockerLoader.options.EventsRetryResetAfter {
+			failures = 0
+		}
+		failures++
+		if maxFailures := dockerLoader.options.EventsMaxFailures; maxFailures > 0 && failures == maxFailures {
+			logger().Error("Docker events failed too many consecutive times, check the docker host",
+				zap.String("DockerSocket", dockerLoader.options.DockerSockets[i]),
+				zap.Int("failures", failures),
+				zap.Bool("stopRetrying", dockerLoader.options.EventsStopOnMaxFailures))
+			if dockerLoader.options.EventsStopOnMaxFailures {
+				return
+			}
+		}
+		delay = dockerLoader.eventsRetryDelay(delay, connected)
+		logger().Info("Reconnecting to docker events", zap.String("DockerSocket", dockerLoader.options.DockerSockets[i]), zap.Duration("delay", delay))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
-func (dockerLoader *DockerLoader) listenEvents() {
-	args := filters.NewArgs()
-	if !isTrue.MatchString(os.Getenv("CADDY_DOCKER_NO_SCOPE")) {
-		// This env var is useful for Podman where in some instances the scope can cause some issues.
-		args.Add("scope", "swarm")
-		args.Add("scope", "local")
+// eventsRetryDelay returns the delay before reconnecting to docker events, doubling the
+// previous delay up to EventsRetryMax, or EventsRetryBase after a long enough connection
+func (dockerLoader *DockerLoader) eventsRetryDelay(previous time.Duration, connected time.Duration) time.Duration {
+	if previous <= 0 || connected >= dockerLoader.options.EventsRetryResetAfter {
+		return dockerLoader.options.EventsRetryBase
 	}
-	args.Add("type", "service")
-	args.Add("type", "container")
-	args.Add("type", "config")
+	return min(previous*2, dockerLoader.options.EventsRetryMax)
+}
 
-	for i, dockerClient := range dockerLoader.dockerClients {
-		context, cancel := context.WithCancel(context.Background())
+// listenEvents listens to docker events of the docker client at index i until an error or ctx is done
+func (dockerLoader *DockerLoader) listenEvents(ctx context.Context, i int) {
+	// CADDY_DOCKER_NO_SCOPE is useful for Podman where in some instances the scope can cause some issues.
+	args := dockerLoader.eventFilter.args(isTrue.MatchString(os.Getenv("CADDY_DOCKER_NO_SCOPE")))
 
-		eventsChan, errorChan := dockerClient.Events(context, types.EventsOptions{
-			Filters: args,
-		})
+	context, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	eventsChan, errorChan := dockerLoader.dockerClients[i].Events(context, types.EventsOptions{
+		Filters: args,
+	})
+
+	log := logger()
+	log.Info("Connecting to docker events", zap.String("DockerSocket", dockerLoader.options.DockerSockets[i]))
+	dockerLoader.eventsTracker.setConnected(dockerLoader.options.DockerSockets[i], true)
 
-		log := logger()
-		log.Info("Connecting to docker events", zap.String("DockerSocket", dockerLoader.options.DockerSockets[i]))
-
-	ListenEvents:
-		for {
-			select {
-			case event := <-eventsChan:
-				if dockerLoader.skipEvents[i] {
-					continue
-				}
-
-				update := (event.Type == "container" && event.Action == "create") ||
-					(event.Type == "container" && event.Action == "start") ||
-					(event.Type == "container" && event.Action == "stop") ||
-					(event.Type == "container" && event.Action == "die") ||
-					(event.Type == "container" && event.Action == "destroy") ||
-					(event.Type == "service" && event.Action == "create") ||
-					(event.Type == "service" && event.Action == "update") ||
-					(event.Type == "service" && event.Action == "remove") ||
-					(event.Type == "config" && event.Action == "create") ||
-					(event.Type == "config" && event.Action == "remove")
-
-				if update {
-					dockerLoader.skipEvents[i] = true
-					dockerLoader.timer.Reset(dockerLoader.options.EventThrottleInterval)
-				}
-			case err := <-errorChan:
-				cancel()
-				if err != nil {
-					log.Error("Docker events error", zap.Error(err))
-				}
-				break ListenEvents
+	for {
+		select {
+		case event := <-eventsChan:
+			dockerLoader.eventsTracker.record(dockerLoader.options.DockerSockets[i], event)
+			dockerLoader.generator.InvalidateInspectCache(i, string(event.Type), event.Actor.ID)
+
+			update := dockerLoader.triggersUpdate(event)
+
+			if update {
+				dockerLoader.timer.Reset(dockerLoader.eventsDebounce.delay(time.Now()))
+			}
+		case err := <-errorChan:
+			dockerLoader.eventsTracker.setConnected(dockerLoader.options.DockerSockets[i], false)
+			if err != nil && ctx.Err() == nil {
+				log.Error("Docker events error", zap.String("DockerSocket", dockerLoader.options.DockerSockets[i]), zap.Error(err))
 			}
+			return
+		case <-ctx.Done():
+			dockerLoader.eventsTracker.setConnected(dockerLoader.options.DockerSockets[i], false)
+			log.Info("Stopped listening to docker events", zap.String("DockerSocket", dockerLoader.options.DockerSockets[i]))
+			return
+		}
+	}
+}
+
+// triggersUpdate checks whether a docker event should trigger an update. Network events only
+// do for ingress networks, as upstreams are only reachable through them, and container events
+// only for containers with caddy labels
+func (dockerLoader *DockerLoader) triggersUpdate(event events.Message) bool {
+	if !dockerLoader.eventFilter.triggersUpdate(event) {
+		return false
+	}
+	switch event.Type {
+	case events.NetworkEventType:
+		if !dockerLoader.generator.IsIngressNetwork(event.Actor.ID, event.Actor.Attributes["name"]) {
+			return false
 		}
+		dockerLoader.generator.InvalidateIngressNetworks()
+	case events.ContainerEventType:
+		return dockerLoader.containerEventRelevant(event)
 	}
+	return true
 }
 
+// containerEventRelevant checks the labels of the container of an event, which docker sends as
+// attributes of the event actor. Containers of swarm tasks are relevant without caddy labels, as
+// they are upstreams of services. Without attributes to check, events are considered relevant, as
+// are all container events with FallbackToEnv, since events don't include environment variables
+func (dockerLoader *DockerLoader) containerEventRelevant(event events.Message) bool {
+	attributes := event.Actor.Attributes
+	if dockerLoader.options.FallbackToEnv || len(attributes) == 0 || attributes["com.docker.swarm.service.id"] != "" {
+		return true
+	}
+	for attribute := range attributes {
+		if dockerLoader.generator.IsCaddyLabel(attribute) {
+			return true
+		}
+	}
+	return false
+}
+
+// update generates the Caddyfile and sends it to servers. Updates triggered by the timer while
+// another one runs wait for it, as the state of the last configuration is owned by the update
+// holding updateMutex. Events only reset the timer, so they never wait for an update
 func (dockerLoader *DockerLoader) update() bool {
-	dockerLoader.timer.Reset(dockerLoader.options.PollingInterval)
-	for i := 0; i < len(dockerLoader.skipEvents); i++ {
-		dockerLoader.skipEvents[i] = false
+	dockerLoader.updateMutex.Lock()
+	defer dockerLoader.updateMutex.Unlock()
+
+	return dockerLoader.updateLocked()
+}
+
+// updateOnTimer runs an update when the timer fires, unless the last update started less than
+// MinUpdateInterval ago. Then the timer is reset to when the interval elapses, so updates due
+// sooner, like the ones of events arriving faster than that, are coalesced into a single update
+// still applying the final state
+func (dockerLoader *DockerLoader) updateOnTimer(now time.Time) bool {
+	dockerLoader.updateMutex.Lock()
+	defer dockerLoader.updateMutex.Unlock()
+
+	if minInterval := dockerLoader.options.MinUpdateInterval; minInterval > 0 && !dockerLoader.stopped {
+		if wait := dockerLoader.lastUpdateStart.Add(minInterval).Sub(now); wait > 0 {
+			logger().Debug("Delaying update to respect minimum update interval", zap.Duration("wait", wait))
+			dockerLoader.timer.Reset(wait)
+			return false
+		}
+	}
+	return dockerLoader.updateLocked()
+}
+
+// reload runs an update on demand, returning the version of the last configuration after it
+func (dockerLoader *DockerLoader) reload() (int64, bool) {
+	dockerLoader.updateMutex.Lock()
+	defer dockerLoader.updateMutex.Unlock()
+
+	updated := dockerLoader.updateLocked()
+	return dockerLoader.lastVersion, updated
+}
+
+// ConfigStatus describes the last configuration generated and the versions servers were configured with
+type ConfigStatus struct {
+	Version         int64                   `json:"version"`
+	Caddyfile       string                  `json:"caddyfile"`
+	Config          json.RawMessage         `json:"config"`
+	ServersVersions map[string]int64        `json:"servers_versions"`
+	Servers         map[string]ServerStatus `json:"servers"`
+}
+
+// configStatus returns the last configuration generated, or nil before the first one
+func (dockerLoader *DockerLoader) configStatus() *ConfigStatus {
+	dockerLoader.updateMutex.Lock()
+	defer dockerLoader.updateMutex.Unlock()
+
+	if dockerLoader.lastVersion == 0 {
+		return nil
+	}
+	return &ConfigStatus{
+		Version:         dockerLoader.lastVersion,
+		Caddyfile:       string(dockerLoader.lastCaddyfile),
+		Config:          json.RawMessage(dockerLoader.lastJSONConfig),
+		ServersVersions: dockerLoader.serversVersions.Snapshot(),
+		Servers:         dockerLoader.serversStatuses.Snapshot(),
+	}
+}
+
+// updateLocked runs an update, the caller must hold updateMutex
+func (dockerLoader *DockerLoader) updateLocked() bool {
+	if dockerLoader.stopped {
+		return false
 	}
 
+	dockerLoader.lastUpdateStart = time.Now()
+	pollingInterval := dockerLoader.jitter(dockerLoader.nextPollingInterval(dockerLoader.lastUpdateStart))
+	dockerLoader.timer.Reset(pollingInterval)
+	dockerLoader.eventsDebounce.reset()
+	dockerLoader.lastUpdateOK = false
+
 	// Don't cache the logger more globally, it can change based on config reloads
 	log := logger()
-	caddyfile, controlledServers := dockerLoader.generator.GenerateCaddyfile(log)
+	caddyfile, controlledServers, err := dockerLoader.generateCaddyfile(log)
+	if err != nil {
+		log.Error("Failed to generate Caddyfile, keeping previous config", zap.Int64("version", dockerLoader.lastVersion), zap.Error(err))
+		return false
+	}
 
-	caddyfileChanged := !bytes.Equal(dockerLoader.lastCaddyfile, caddyfile)
+	if dockerLoader.hostLimiter != nil {
+		now := time.Now()
+		var deferred int
+		caddyfile, deferred = dockerLoader.hostLimiter.filter(caddyfile, now, log)
+		if next := dockerLoader.hostLimiter.nextWindow(now); deferred > 0 && next < pollingInterval {
+			dockerLoader.timer.Reset(next)
+		}
+	}
 
-	dockerLoader.lastCaddyfile = caddyfile
+	if dockerLoader.options.RouteDrainPeriod > 0 {
+		caddyfile = dockerLoader.drainRemovedRoutes(log, caddyfile, time.Now())
+	}
 
-	if caddyfileChanged {
-		log.Info("New Caddyfile", zap.ByteString("caddyfile", caddyfile))
+	if dockerLoader.bootRetries > 0 {
+		if string(caddyfile) == generator.EmptyCaddyfile {
+			dockerLoader.bootRetries--
+			log.Info("Empty Caddyfile generated after startup, retrying soon", zap.Int("retriesLeft", dockerLoader.bootRetries))
+			dockerLoader.timer.Reset(dockerLoader.options.EmptyBootRetryInterval)
+		} else {
+			dockerLoader.bootRetries = 0
+		}
+	}
 
+	previousCaddyfile := dockerLoader.lastCaddyfile
+	previousVersion := dockerLoader.lastCaddyfileVersion
+	caddyfileChanged := !bytes.Equal(previousCaddyfile, caddyfile)
+
+	if forcedRefresh := dockerLoader.generator.ForcedRefresh(); !caddyfileChanged && len(forcedRefresh) > 0 && len(dockerLoader.lastJSONConfig) > 0 {
+		log.Debug("Forcing config refresh", zap.Strings("forcedBy", forcedRefresh))
+		dockerLoader.lastVersion++
+		dockerLoader.serversHashes.Clear()
+	}
+
+	if dockerLoader.reconcileDue.Swap(false) && !caddyfileChanged && len(dockerLoader.lastJSONConfig) > 0 {
+		log.Info("Forcing scheduled reconciliation")
+		dockerLoader.lastVersion++
+		dockerLoader.serversHashes.Clear()
+	}
+
+	if caddyfileChanged {
 		if autosaveErr := os.WriteFile(CaddyfileAutosavePath, caddyfile, 0666); autosaveErr != nil {
 			log.Warn("Failed to autosave caddyfile", zap.Error(autosaveErr), zap.String("path", CaddyfileAutosavePath))
 		}
 
-		adapter := caddyconfig.GetAdapter("caddyfile")
-
-		configJSON, warn, err := adapter.Adapt(caddyfile, nil)
+		if dumpPath := dockerLoader.options.CaddyfileDumpPath; dumpPath != "" {
+			if dumpErr := writeFileAtomic(dumpPath, caddyfile); dumpErr != nil {
+				log.Warn("Failed to dump caddyfile", zap.Error(dumpErr), zap.String("path", dumpPath))
+			}
+		}
 
-		if warn != nil {
-			log.Warn("Caddyfile to json warning", zap.String("warn", fmt.Sprintf("%v", warn)))
+		if inventoryPath := dockerLoader.options.InventoryPath; inventoryPath != "" {
+			if inventoryErr := writeInventory(inventoryPath, dockerLoader.generator.Inventory()); inventoryErr != nil {
+				log.Warn("Failed to write routes inventory", zap.Error(inventoryErr), zap.String("path", inventoryPath))
+			}
 		}
 
+		configJSON, err := adaptCaddyfile(log, caddyfile)
 		if err != nil {
-			log.Error("Failed to convert caddyfile into json config", zap.Error(err))
 			return false
 		}
 
-		log.Info("New Config JSON", zap.ByteString("json", configJSON))
+		// Committed only once converted and accepted, so a Caddyfile failing to convert or
+		// validate is checked again on the next update instead of being considered unchanged
+		dockerLoader.lastRejected = false
+		if bytes.Equal(configJSON, dockerLoader.lastJSONConfig) {
+			log.Debug("Caddyfile changed without changing JSON config, skipping push")
+			dockerLoader.lastCaddyfile = caddyfile
+			dockerLoader.lastCaddyfileVersion = dockerLoader.lastVersion
+		} else if validateErr := dockerLoader.validateConfig(configJSON); validateErr != nil {
+			log.Error("Generated config is invalid, keeping previous config", zap.Int64("version", dockerLoader.lastVersion), zap.Error(validateErr))
+			dockerLoader.lastRejected = true
+		} else {
+			dockerLoader.lastCaddyfile = caddyfile
+			dockerLoader.lastJSONConfig = configJSON
+			dockerLoader.lastVersion++
+			dockerLoader.lastCaddyfileVersion = dockerLoader.lastVersion
 
-		dockerLoader.lastJSONConfig = configJSON
-		dockerLoader.lastVersion++
+			dockerLoader.logNewConfig(log, caddyfile, configJSON)
+			dockerLoader.logCaddyfileDiff(log, previousCaddyfile, previousVersion, caddyfile)
+
+			if dockerLoader.options.ConfigDiffSummary {
+				dockerLoader.recordConfigDiff(log, previousCaddyfile, caddyfile)
+			}
+		}
 	}
 
-	var wg sync.WaitGroup
-	for _, server := range controlledServers {
-		wg.Add(1)
-		go dockerLoader.updateServer(&wg, server)
+	dockerProxyMetrics.configVersion.Set(float64(dockerLoader.lastVersion))
+
+	servers := []string{}
+	if dockerLoader.isLeader() {
+		servers = dockerLoader.resolveServers(log, caddyfile, controlledServers)
+	} else {
+		log.Debug("Not the leader, skipping config distribution", zap.Int64("version", dockerLoader.lastVersion))
 	}
-	wg.Wait()
 
+	runInWaves(servers, dockerLoader.options.PushWaveSize, dockerLoader.options.PushWaveDelay, dockerLoader.options.PushConcurrency, dockerLoader.updateServer)
+
+	dockerLoader.lastUpdateOK = dockerLoader.serversConfigured(servers)
+	if dockerLoader.hostLimiter != nil && dockerLoader.lastUpdateOK && !dockerLoader.lastRejected {
+		// New hostnames only count against the rate once servers run a config with them
+		dockerLoader.hostLimiter.commit()
+	}
+	if !dockerLoader.ready.Load() && dockerLoader.lastUpdateOK {
+		dockerLoader.ready.Store(true)
+		log.Info("Ready", zap.Int64("version", dockerLoader.lastVersion), zap.Int("servers", len(servers)))
+	}
+
+	return true
+}
+
+// generateCaddyfile generates the Caddyfile from docker metadata, cancelling docker requests
+// after GenerationTimeout
+func (dockerLoader *DockerLoader) generateCaddyfile(log *zap.Logger) ([]byte, []string, error) {
+	ctx := context.Background()
+	if timeout := dockerLoader.options.GenerationTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	generationStart := time.Now()
+	caddyfile, controlledServers, err := dockerLoader.generator.GenerateCaddyfile(ctx, log)
+	observeGeneration(time.Since(generationStart))
+	return caddyfile, controlledServers, err
+}
+
+// adaptCaddyfile converts a Caddyfile into a JSON config
+func adaptCaddyfile(log *zap.Logger, caddyfile []byte) ([]byte, error) {
+	adapter := caddyconfig.GetAdapter("caddyfile")
+
+	configJSON, warn, err := adapter.Adapt(caddyfile, nil)
+
+	if warn != nil {
+		log.Warn("Caddyfile to json warning", zap.String("warn", fmt.Sprintf("%v", warn)))
+	}
+
+	if err != nil {
+		log.Error("Failed to convert caddyfile into json config", zap.Error(err))
+		return nil, err
+	}
+	return configJSON, nil
+}
+
+// printCaddyfile generates the Caddyfile once, like updates do, and writes it to w.
+// It fails when the Caddyfile can't be converted into a JSON config
+func (dockerLoader *DockerLoader) printCaddyfile(log *zap.Logger, w io.Writer) error {
+	caddyfile, _, err := dockerLoader.generateCaddyfile(log)
+	if err != nil {
+		log.Error("Failed to generate Caddyfile", zap.Error(err))
+		return err
+	}
+	if _, err := w.Write(caddyfile); err != nil {
+		return err
+	}
+	_, err = adaptCaddyfile(log, caddyfile)
+	return err
+}
+
+// nextPollingInterval returns the delay until the next poll. While events are received and
+// updates succeed, events keep the config up to date, so the interval doubles up to
+// MaxPollingInterval. Otherwise it goes back to PollingInterval
+func (dockerLoader *DockerLoader) nextPollingInterval(now time.Time) time.Duration {
+	base := dockerLoader.options.PollingInterval
+	maxInterval := dockerLoader.options.MaxPollingInterval
+	eventsFlowing := dockerLoader.eventsTracker.lastEvent().After(dockerLoader.lastPollTime)
+	dockerLoader.lastPollTime = now
+
+	if maxInterval <= base || !eventsFlowing || !dockerLoader.lastUpdateOK {
+		dockerLoader.pollingInterval = base
+	} else {
+		dockerLoader.pollingInterval = min(max(dockerLoader.pollingInterval*2, base), maxInterval)
+	}
+	return dockerLoader.pollingInterval
+}
+
+// isLeader reports whether this controller distributes configurations, which all controllers
+// do unless LeaderLock is configured
+func (dockerLoader *DockerLoader) isLeader() bool {
+	return dockerLoader.leaderLock == nil || dockerLoader.leaderLock.isHeld()
+}
+
+// jitter randomly shortens or lengthens a polling interval by up to PollingJitter percent, so
+// controllers started together don't poll docker at the same time
+func (dockerLoader *DockerLoader) jitter(interval time.Duration) time.Duration {
+	maxJitter := int64(interval) * int64(dockerLoader.options.PollingJitter) / 100
+	if maxJitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(2*maxJitter+1)-maxJitter)
+}
+
+// initialPollingDelay returns the delay of the first update, up to PollingJitter percent of
+// PollingInterval
+func (dockerLoader *DockerLoader) initialPollingDelay() time.Duration {
+	maxDelay := int64(dockerLoader.options.PollingInterval) * int64(dockerLoader.options.PollingJitter) / 100
+	if maxDelay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(maxDelay + 1))
+}
+
+// Ready reports whether a configuration was generated and all servers were configured with it at
+// least once. Without servers to configure, it's ready as soon as a configuration is generated
+func (dockerLoader *DockerLoader) Ready() bool {
+	return dockerLoader.ready.Load()
+}
+
+// serversConfigured checks that the last configuration was generated and sent to all servers
+func (dockerLoader *DockerLoader) serversConfigured(servers []string) bool {
+	if dockerLoader.lastVersion == 0 {
+		return false
+	}
+	for _, server := range servers {
+		if !dockerLoader.isExcludedServer(server) && dockerLoader.serversVersions.Get(server) < dockerLoader.lastVersion {
+			return false
+		}
+	}
 	return true
 }
 
+// isExcludedServer checks whether server matches a name or glob pattern of ExcludedServers,
+// which are never sent configurations
+func (dockerLoader *DockerLoader) isExcludedServer(server string) bool {
+	for _, pattern := range dockerLoader.options.ExcludedServers {
+		if matched, _ := path.Match(pattern, server); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// routeDrain keeps the routes of base removed by later Caddyfiles until a time
+type routeDrain struct {
+	base   []byte
+	routes []string
+	until  time.Time
+}
+
+// drainRemovedRoutes keeps routes removed from the Caddyfile for RouteDrainPeriod after their
+// removal. Kept routes proxy to no upstream, so new requests get 503 while ongoing ones complete.
+// Upstreams removed from remaining routes get no new requests right away
+func (dockerLoader *DockerLoader) drainRemovedRoutes(log *zap.Logger, caddyfile []byte, now time.Time) []byte {
+	if base := dockerLoader.drainBase; len(base) > 0 {
+		if _, removed, err := generator.KeepRemovedRoutes(base, caddyfile); err != nil {
+			log.Error("Failed to keep removed routes for draining", zap.Error(err))
+		} else if len(removed) > 0 {
+			drain := routeDrain{base: base, routes: removed, until: now.Add(dockerLoader.options.RouteDrainPeriod)}
+			dockerLoader.drains = append(dockerLoader.drains, drain)
+			log.Info("Draining removed routes", zap.Strings("routes", removed), zap.Time("until", drain.until))
+		}
+	}
+	dockerLoader.drainBase = caddyfile
+
+	// Newer drains keep their routes first, so each route is kept until the end of its last removal
+	drainCaddyfile := caddyfile
+	drains := []routeDrain{}
+	for i := len(dockerLoader.drains) - 1; i >= 0; i-- {
+		drain := dockerLoader.drains[i]
+		if !now.Before(drain.until) {
+			log.Info("Removing drained routes", zap.Strings("routes", drain.routes))
+			continue
+		}
+		keptCaddyfile, removed, err := generator.KeepRemovedRoutes(drain.base, drainCaddyfile)
+		if err != nil {
+			log.Error("Failed to keep removed routes for draining", zap.Error(err))
+			continue
+		}
+		if len(removed) == 0 {
+			continue
+		}
+		drainCaddyfile = keptCaddyfile
+		drains = append([]routeDrain{drain}, drains...)
+	}
+	dockerLoader.drains = drains
+
+	if len(drains) > 0 {
+		dockerLoader.timer.Reset(drains[0].until.Sub(now))
+	}
+	return drainCaddyfile
+}
+
+// runReconcileSchedule runs an update at each time of schedule until stop is closed,
+// pushing the config to all servers even when the Caddyfile didn't change
+func (dockerLoader *DockerLoader) runReconcileSchedule(schedule *cronSchedule, stop <-chan struct{}) {
+	for next := schedule.next(time.Now()); !next.IsZero(); next = schedule.next(next) {
+		select {
+		case <-time.After(time.Until(next)):
+		case <-stop:
+			return
+		}
+		dockerLoader.reconcileDue.Store(true)
+		dockerLoader.timer.Reset(0)
+	}
+	logger().Warn("Reconcile cron doesn't match any time", zap.String("ReconcileCron", dockerLoader.options.ReconcileCron))
+}
+
+// resolveDockerHost returns the docker host to connect to when no docker sockets are set,
+// and where it comes from: the docker host option, the DOCKER_HOST env or the default host
+func resolveDockerHost(options *config.Options) (string, string, error) {
+	if options.DockerHost != "" {
+		if _, err := client.ParseHostURL(options.DockerHost); err != nil {
+			return "", "", fmt.Errorf("docker host %q: %w", options.DockerHost, err)
+		}
+		return options.DockerHost, "option", nil
+	}
+	if dockerHost := os.Getenv("DOCKER_HOST"); dockerHost != "" {
+		return dockerHost, "environment", nil
+	}
+	return client.DefaultDockerHost, "default", nil
+}
+
+// resolveServers returns the servers to push configurations to, falling back to
+// the servers found by the generator when the server resolver fails, and combined
+// with the targets of the servers SRV record
+func (dockerLoader *DockerLoader) resolveServers(log *zap.Logger, caddyfile []byte, controlledServers []string) []string {
+	servers, err := dockerLoader.serverResolver.ResolveServers(caddyfile, controlledServers, dockerLoader.dockerClients)
+	if err != nil {
+		log.Error("Failed to resolve servers, using controlled servers", zap.Error(err))
+		servers = controlledServers
+	}
+	return dockerLoader.addSRVServers(log, servers)
+}
+
+// recordConfigDiff summarizes the changes between the previous and the new Caddyfile,
+// logging them and keeping them for the admin API
+func (dockerLoader *DockerLoader) recordConfigDiff(log *zap.Logger, previousCaddyfile []byte, caddyfile []byte) {
+	diff, err := generator.DiffCaddyfiles(previousCaddyfile, caddyfile)
+	if err != nil {
+		log.Warn("Failed to compute config changes", zap.Error(err))
+		return
+	}
+	diff.Version = dockerLoader.lastVersion
+	dockerLoader.lastDiff.Store(diff)
+
+	log.Info("Config changes",
+		zap.Int64("version", diff.Version),
+		zap.Strings("addedHosts", diff.AddedHosts),
+		zap.Strings("removedHosts", diff.RemovedHosts),
+		zap.Int("changedUpstreams", len(diff.ChangedUpstreams)),
+		zap.Int("addedDirectives", len(diff.AddedDirectives)),
+		zap.Int("removedDirectives", len(diff.RemovedDirectives)),
+	)
+}
+
+// runInWaves runs fn concurrently for all servers, or for waves of waveSize servers
+// separated by delay when waveSize is positive. At most concurrency servers of a wave
+// are running at once when concurrency is positive
+func runInWaves(servers []string, waveSize int, delay time.Duration, concurrency int, fn func(wg *sync.WaitGroup, server string)) {
+	if waveSize <= 0 {
+		waveSize = len(servers)
+	}
+	for start := 0; start < len(servers); start += waveSize {
+		if start > 0 && delay > 0 {
+			time.Sleep(delay)
+		}
+		wave := servers[start:min(start+waveSize, len(servers))]
+		var wg sync.WaitGroup
+		wg.Add(len(wave))
+		runBounded(wave, concurrency, func(server string) {
+			fn(&wg, server)
+		})
+		wg.Wait()
+	}
+}
+
+// runBounded runs fn for all servers with at most concurrency of them running at once,
+// or all of them at once when concurrency isn't positive, returning once all completed
+func runBounded(servers []string, concurrency int, fn func(server string)) {
+	if concurrency <= 0 || concurrency > len(servers) {
+		concurrency = len(servers)
+	}
+	queue := make(chan string)
+	var workers sync.WaitGroup
+	workers.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer workers.Done()
+			for server := range queue {
+				fn(server)
+			}
+		}()
+	}
+	for _, server := range servers {
+		queue <- server
+	}
+	close(queue)
+	workers.Wait()
+}
+
+// writeInventory writes the routes inventory as JSON to path
+func writeInventory(path string, inventory []generator.InventoryRoute) error {
+	inventoryJSON, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, inventoryJSON, 0666)
+}
+
+// validateConfig provisions configJSON in a throwaway context without starting it, when
+// ValidateBeforePush is enabled, catching configs every server would reject
+func (dockerLoader *DockerLoader) validateConfig(configJSON []byte) error {
+	if !dockerLoader.options.ValidateBeforePush {
+		return nil
+	}
+	config := &caddy.Config{}
+	if err := json.Unmarshal(configJSON, config); err != nil {
+		return err
+	}
+	return dockerLoader.validate(config)
+}
+
+// writeFileAtomic writes data to a temporary file in the directory of path and renames it to
+// path, so readers never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// logNewConfig logs a summary of a new config, along with the full Caddyfile and JSON config,
+// tagged with the same version and with sensitive values redacted, when DebugCaddyfileLogging is enabled
+func (dockerLoader *DockerLoader) logNewConfig(log *zap.Logger, caddyfile []byte, configJSON []byte) {
+	hash := sha256.Sum256(configJSON)
+	hashString := hex.EncodeToString(hash[:8])
+	log.Info("New config",
+		zap.Int64("version", dockerLoader.lastVersion),
+		zap.Int("sites", countSites(caddyfile)),
+		zap.Int("caddyfileSize", len(caddyfile)),
+		zap.Int("jsonSize", len(configJSON)),
+		zap.String("hash", hashString),
+		zap.Int("routes", countRoutes(configJSON)),
+	)
+
+	if dockerLoader.options.DebugCaddyfileLogging {
+		redactDirectives := dockerLoader.options.RedactDirectives
+		log.Info("New Caddyfile", zap.Int64("version", dockerLoader.lastVersion), zap.ByteString("caddyfile", redactCaddyfile(caddyfile, redactDirectives)))
+		log.Info("New Config JSON", zap.Int64("version", dockerLoader.lastVersion), zap.String("hash", hashString), zap.ByteString("json", redactConfigJSON(configJSON, redactDirectives)))
+	}
+}
+
+// countSites returns the number of site blocks of a Caddyfile
+func countSites(caddyfileContent []byte) int {
+	container, err := caddyfile.Unmarshal(caddyfileContent)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, block := range container.Children {
+		if !block.IsGlobalBlock() && !block.IsSnippet() && !block.IsMatcher() {
+			count++
+		}
+	}
+	return count
+}
+
+// countRoutes returns the number of top level routes across all http servers
+func countRoutes(configJSON []byte) int {
+	config := struct {
+		Apps struct {
+			HTTP struct {
+				Servers map[string]struct {
+					Routes []json.RawMessage `json:"routes"`
+				} `json:"servers"`
+			} `json:"http"`
+		} `json:"apps"`
+	}{}
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return 0
+	}
+	count := 0
+	for _, server := range config.Apps.HTTP.Servers {
+		count += len(server.Routes)
+	}
+	return count
+}
+
 func (dockerLoader *DockerLoader) updateServer(wg *sync.WaitGroup, server string) {
 	defer wg.Done()
+	host, port := splitAdminAddress(dockerLoader.options, server)
+	dockerLoader.updateServerAt(server, getAdminScheme(dockerLoader.options)+"://"+net.JoinHostPort(host, port))
+}
+
+// updateServerAt sends the last configuration to a server through its admin API at adminURL
+func (dockerLoader *DockerLoader) updateServerAt(server string, adminURL string) {
+	if dockerLoader.isExcludedServer(server) {
+		logger().Debug("Skipping excluded server", zap.String("server", server))
+		return
+	}
 
 	// Skip servers that are being updated already
 	if dockerLoader.serversUpdating.Get(server) {
@@ -304,53 +1147,398 @@ func (dockerLoader *DockerLoader) updateServer(wg *sync.WaitGroup, server string
 	}
 
 	log := logger()
-	log.Info("Sending configuration to", zap.String("server", server))
 
-	url := "http://" + server + ":2019/load"
+	if !dockerLoader.breakerAllows(server, time.Now()) {
+		log.Debug("Circuit open, skipping server", zap.String("server", server))
+		return
+	}
 
-	postBody, err := addAdminListen(dockerLoader.lastJSONConfig, "tcp/"+server+":2019")
+	adminConfig, err := createAdminConfig(dockerLoader.options, server)
+	if err != nil {
+		log.Error("Failed to create admin config for", zap.String("server", server), zap.Error(err))
+		observePush(server, false)
+		dockerLoader.recordServerStatus(server, version, err, time.Now())
+		dockerLoader.notifyPush(server, version, err)
+		return
+	}
+
+	postBody, err := addAdminListen(dockerLoader.lastJSONConfig, adminConfig)
 	if err != nil {
 		log.Error("Failed to add admin listen to", zap.String("server", server), zap.Error(err))
+		observePush(server, false)
+		dockerLoader.recordServerStatus(server, version, err, time.Now())
+		dockerLoader.notifyPush(server, version, err)
+		return
+	}
+
+	// Skip servers that were successfully sent the same config already
+	hash := sha256.Sum256(postBody)
+	if bytes.Equal(dockerLoader.serversHashes.Get(server), hash[:]) {
+		log.Debug("Configuration unchanged for", zap.String("server", server))
+		dockerLoader.serversVersions.Set(server, version)
 		return
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(postBody))
+	log.Info("Sending configuration to", zap.String("server", server))
+
+	configured := false
+	defer func() {
+		observePush(server, configured)
+		dockerLoader.recordPush(log, server, configured, time.Now())
+		if !configured {
+			// The server state is unknown, push it again even if the config doesn't change
+			dockerLoader.serversHashes.Delete(server)
+		}
+		dockerLoader.recordServerStatus(server, version, err, time.Now())
+		dockerLoader.notifyPush(server, version, err)
+	}()
+
+	if err = dockerLoader.sendConfigWithRetries(log, server, adminURL, postBody); err != nil {
+		return
+	}
+
+	// Leave the version behind to retry on next update if the server doesn't get healthy
+	if dockerLoader.options.ConfirmWithHealthProbe {
+		probeURL := adminURL + "/config/"
+		if healthProbeURL := dockerLoader.options.HealthProbeURL; healthProbeURL != "" {
+			probeURL = strings.ReplaceAll(healthProbeURL, "{server}", server)
+		}
+		if !dockerLoader.waitHealthProbe(log, server, probeURL, dockerLoader.options.HealthProbeTimeout) {
+			err = errHealthProbeFailed
+			return
+		}
+	}
+
+	dockerLoader.serversVersions.Set(server, version)
+	dockerLoader.serversHashes.Set(server, hash[:])
+	configured = true
+
+	log.Info("Successfully configured", zap.String("server", server))
+
+	if dockerLoader.options.VerifyAfterPush {
+		dockerLoader.verifyServerConfig(log, server, adminURL+"/config/", postBody)
+	}
+}
+
+// waitHealthProbe polls url until it responds with a 2xx status, failing after timeout
+func (dockerLoader *DockerLoader) waitHealthProbe(log *zap.Logger, server string, url string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		statusCode, err := dockerLoader.probeHealth(url)
+		if err == nil && statusCode >= 200 && statusCode < 300 {
+			log.Debug("Health probe passed", zap.String("server", server))
+			return true
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if err != nil {
+				log.Error("Health probe failed after configuring", zap.String("server", server), zap.Error(err))
+			} else {
+				log.Error("Health probe failed after configuring", zap.String("server", server), zap.Int("status code", statusCode))
+			}
+			return false
+		}
+		time.Sleep(min(healthProbeInterval, remaining))
+	}
+}
+
+// probeHealth requests url once with the credentials of the admin endpoint, limited by
+// AdminRequestTimeout, returning the status code of the response
+func (dockerLoader *DockerLoader) probeHealth(url string) (int, error) {
+	ctx := context.Background()
+	if timeout := dockerLoader.options.AdminRequestTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	setAdminAuth(dockerLoader.options, req)
+	resp, err := dockerLoader.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// sendConfig sends a configuration to the load endpoint of a server, at AdminLoadPath with
+// AdminLoadMethod. HTTPOnlyReload, ConditionalPush and CompressConfigPush override that endpoint,
+// in that order of precedence, always sending with POST. With HTTPOnlyReload, when only the http
+// app changed since the last configuration sent to the server, only the http app is replaced at
+// /config/apps/http, preserving the state of the other apps. With ConditionalPush, configurations
+// are sent to /config/, only applied when the configuration of the server has the etag read after
+// the last configuration sent to it. With CompressConfigPush, configurations are compressed and
+// sent to pushLoadPath, falling back to the load endpoint for servers without it
+func (dockerLoader *DockerLoader) sendConfig(ctx context.Context, log *zap.Logger, server string, adminURL string, postBody []byte) (retry bool, err error) {
+	url := adminURL + getAdminLoadPath(dockerLoader.options)
+	method := getAdminLoadMethod(dockerLoader.options)
+	body := postBody
+	compressed := false
+	if httpApp, ok := dockerLoader.httpOnlyReload(server, postBody); ok {
+		log.Debug("Only http app changed, replacing it", zap.String("server", server))
+		url = adminURL + "/config/apps/http"
+		method = http.MethodPost
+		body = httpApp
+	} else if dockerLoader.options.ConditionalPush {
+		url = adminURL + "/config/"
+		method = http.MethodPost
+	} else if dockerLoader.options.CompressConfigPush && !dockerLoader.serversNoGzip.Get(server) {
+		if body, err = gzipBody(postBody); err != nil {
+			log.Error("Failed to compress configuration for", zap.String("server", server), zap.Error(err))
+			return false, err
+		}
+		url = adminURL + pushLoadPath
+		method = http.MethodPost
+		compressed = true
+	}
+
+	if timeout := dockerLoader.options.AdminRequestTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
 	if err != nil {
 		log.Error("Failed to create request to", zap.String("server", server), zap.Error(err))
-		return
+		return false, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	setAdminAuth(dockerLoader.options, req)
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	etag := ""
+	if dockerLoader.options.ConditionalPush {
+		if etag = dockerLoader.serversEtags.Get(server); etag != "" {
+			req.Header.Set("If-Match", etag)
+		}
+	}
+	resp, err := dockerLoader.httpClient.Do(req)
 
 	if err != nil {
 		log.Error("Failed to send configuration to", zap.String("server", server), zap.Error(err))
-		return
+		return true, err
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Error("Failed to read response from", zap.String("server", server), zap.Error(err))
-		return
+		return true, err
+	}
+
+	if compressed && resp.StatusCode == http.StatusNotFound {
+		// Servers without docker proxy, or an older version, don't have the endpoint
+		log.Info("Server doesn't accept compressed configurations, sending them uncompressed", zap.String("server", server))
+		dockerLoader.serversNoGzip.Set(server, true)
+		return dockerLoader.sendConfig(ctx, log, server, adminURL, postBody)
+	}
+
+	if etag != "" && resp.StatusCode == http.StatusPreconditionFailed {
+		// Retried with the current etag, replacing the configuration changed by someone else
+		log.Warn("Server configuration changed since it was last sent, sending it again", zap.String("server", server))
+		dockerLoader.refreshEtag(ctx, log, server, adminURL)
+		return true, &pushError{statusCode: resp.StatusCode, body: bodyBytes}
 	}
 
 	if resp.StatusCode != 200 {
 		log.Error("Error response from server", zap.String("server", server), zap.Int("status code", resp.StatusCode), zap.ByteString("body", bodyBytes))
+		return resp.StatusCode >= 500, &pushError{statusCode: resp.StatusCode, body: bodyBytes}
+	}
+
+	if dockerLoader.options.HTTPOnlyReload {
+		dockerLoader.serversConfigs.Set(server, postBody)
+	}
+	if dockerLoader.options.ConditionalPush {
+		dockerLoader.refreshEtag(ctx, log, server, adminURL)
+	}
+	return false, nil
+}
+
+// refreshEtag stores the etag of the current configuration of a server, which the next
+// configuration sent to it with ConditionalPush must match. Without it, the next configuration
+// is sent unconditionally
+func (dockerLoader *DockerLoader) refreshEtag(ctx context.Context, log *zap.Logger, server string, adminURL string) {
+	dockerLoader.serversEtags.Delete(server)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", adminURL+"/config/", nil)
+	if err != nil {
+		log.Warn("Failed to get configuration etag of", zap.String("server", server), zap.Error(err))
 		return
 	}
+	setAdminAuth(dockerLoader.options, req)
+	resp, err := dockerLoader.httpClient.Do(req)
+	if err != nil {
+		log.Warn("Failed to get configuration etag of", zap.String("server", server), zap.Error(err))
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
 
-	dockerLoader.serversVersions.Set(server, version)
+	if etag := resp.Header.Get("Etag"); resp.StatusCode == 200 && etag != "" {
+		dockerLoader.serversEtags.Set(server, etag)
+	} else {
+		log.Warn("Failed to get configuration etag of", zap.String("server", server), zap.Int("status code", resp.StatusCode))
+	}
+}
 
-	log.Info("Successfully configured", zap.String("server", server))
+// sendConfigWithRetries sends the configuration to a server, retrying failures that may be
+// transient up to PushRetryAttempts attempts. All attempts share the PushTimeout, so a server
+// that doesn't respond can't hold the update of other servers. It returns the error of the last attempt
+func (dockerLoader *DockerLoader) sendConfigWithRetries(log *zap.Logger, server string, adminURL string, postBody []byte) error {
+	ctx := context.Background()
+	if dockerLoader.options.PushTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dockerLoader.options.PushTimeout)
+		defer cancel()
+	}
+
+	attempts := max(dockerLoader.options.PushRetryAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		retry, err := dockerLoader.sendConfig(ctx, log, server, adminURL, postBody)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= attempts {
+			return err
+		}
+
+		log.Info("Retrying to send configuration to", zap.String("server", server), zap.Int("attempt", attempt+1))
+		select {
+		case <-ctx.Done():
+			log.Error("Timed out sending configuration to", zap.String("server", server))
+			return err
+		case <-time.After(dockerLoader.options.PushRetryDelay):
+		}
+	}
 }
 
-func addAdminListen(configJSON []byte, listen string) ([]byte, error) {
+// httpOnlyReload returns the http app of postBody when HTTPOnlyReload is enabled and it's the only
+// difference from the last configuration sent to server
+func (dockerLoader *DockerLoader) httpOnlyReload(server string, postBody []byte) ([]byte, bool) {
+	if !dockerLoader.options.HTTPOnlyReload {
+		return nil, false
+	}
+	return onlyHTTPAppChanged(dockerLoader.serversConfigs.Get(server), postBody)
+}
+
+// gzipBody compresses a configuration sent to pushLoadPath
+func gzipBody(body []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// onlyHTTPAppChanged returns the http app of nextJSON if it is the only difference from previousJSON
+func onlyHTTPAppChanged(previousJSON []byte, nextJSON []byte) ([]byte, bool) {
+	if len(previousJSON) == 0 {
+		return nil, false
+	}
+
+	var previous, next map[string]interface{}
+	if err := json.Unmarshal(previousJSON, &previous); err != nil {
+		return nil, false
+	}
+	if err := json.Unmarshal(nextJSON, &next); err != nil {
+		return nil, false
+	}
+
+	previousApps, _ := previous["apps"].(map[string]interface{})
+	nextApps, _ := next["apps"].(map[string]interface{})
+	if previousApps == nil || nextApps == nil || previousApps["http"] == nil || nextApps["http"] == nil {
+		return nil, false
+	}
+
+	nextHTTPApp := nextApps["http"]
+	delete(previousApps, "http")
+	delete(nextApps, "http")
+	if !reflect.DeepEqual(previous, next) {
+		return nil, false
+	}
+
+	httpAppJSON, err := json.Marshal(nextHTTPApp)
+	if err != nil {
+		return nil, false
+	}
+	return httpAppJSON, true
+}
+
+// verifyServerConfig fetches the config currently running on a server and warns if it
+// doesn't match the config that was pushed to it
+func (dockerLoader *DockerLoader) verifyServerConfig(log *zap.Logger, server string, url string, expectedJSON []byte) bool {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		log.Warn("Failed to verify configuration of", zap.String("server", server), zap.Error(err))
+		return false
+	}
+	setAdminAuth(dockerLoader.options, req)
+	resp, err := dockerLoader.httpClient.Do(req)
+	if err != nil {
+		log.Warn("Failed to verify configuration of", zap.String("server", server), zap.Error(err))
+		return false
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Warn("Failed to verify configuration of", zap.String("server", server), zap.Error(err))
+		return false
+	}
+
+	if resp.StatusCode != 200 {
+		log.Warn("Failed to verify configuration of", zap.String("server", server), zap.Int("status code", resp.StatusCode), zap.ByteString("body", bodyBytes))
+		return false
+	}
+
+	var expected, actual interface{}
+	if err := json.Unmarshal(expectedJSON, &expected); err != nil {
+		log.Warn("Failed to verify configuration of", zap.String("server", server), zap.Error(err))
+		return false
+	}
+	if err := json.Unmarshal(bodyBytes, &actual); err != nil {
+		log.Warn("Failed to verify configuration of", zap.String("server", server), zap.Error(err))
+		return false
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		log.Warn("Server is not running the configuration sent to it", zap.String("server", server))
+		return false
+	}
+
+	log.Debug("Verified configuration of", zap.String("server", server))
+	return true
+}
+
+// addAdminListen sets the admin endpoint of a server in a config. Admin settings of the config,
+// like origins from the global admin option, are kept, only the listen address and, over https,
+// the identity and remote admin endpoint are replaced
+func addAdminListen(configJSON []byte, admin *caddy.AdminConfig) ([]byte, error) {
 	config := &caddy.Config{}
 	err := json.Unmarshal(configJSON, config)
 	if err != nil {
 		return nil, err
 	}
-	config.Admin = &caddy.AdminConfig{
-		Listen: listen,
+	if config.Admin == nil {
+		config.Admin = &caddy.AdminConfig{}
+	}
+	config.Admin.Listen = admin.Listen
+	if admin.Identity != nil {
+		config.Admin.Identity = admin.Identity
+	}
+	if admin.Remote != nil {
+		config.Admin.Remote = admin.Remote
 	}
 	return json.Marshal(config)
 }
@@ -0,0 +1,1445 @@
+package caddydockerproxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/generator"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const testCaddyfile = "example.com {\n" +
+	"	reverse_proxy 172.17.0.2\n" +
+	"}\n"
+
+const testConfigJSON = `{"apps":{"http":{"servers":{"srv0":{"listen":[":443"],"routes":[{"match":[{"host":["example.com"]}]}]}}}}}`
+
+func TestLogNewConfig_FullConfig(t *testing.T) {
+	loader := CreateDockerLoader(&config.Options{DebugCaddyfileLogging: true})
+	loader.lastVersion = 3
+
+	logs := captureLogs(func(log *zap.Logger) {
+		loader.logNewConfig(log, []byte(testCaddyfile), []byte(testConfigJSON))
+	})
+
+	assert.Contains(t, logs, "New Config JSON\t{\"version\": 3")
+	assert.Contains(t, logs, `\"apps\"`)
+	assert.Contains(t, logs, "New Caddyfile\t{\"version\": 3")
+	assert.Contains(t, logs, "reverse_proxy")
+	assert.Contains(t, logs, "New config\t{\"version\": 3")
+}
+
+func TestLogNewConfig_SummaryOnly(t *testing.T) {
+	loader := CreateDockerLoader(&config.Options{})
+	loader.lastVersion = 3
+
+	logs := captureLogs(func(log *zap.Logger) {
+		loader.logNewConfig(log, []byte(testCaddyfile), []byte(testConfigJSON))
+	})
+
+	assert.NotContains(t, logs, "New Config JSON")
+	assert.NotContains(t, logs, "reverse_proxy")
+	assert.NotContains(t, logs, `"apps"`)
+	assert.Contains(t, logs, "New config")
+	assert.Contains(t, logs, `"version": 3`)
+	assert.Contains(t, logs, `"sites": 1`)
+	assert.Contains(t, logs, `"caddyfileSize": 42`)
+	assert.Contains(t, logs, `"routes": 1`)
+	assert.Contains(t, logs, `"hash": "`)
+}
+
+func captureLogs(fn func(log *zap.Logger)) string {
+	var logsBuffer bytes.Buffer
+	encoderConfig := zap.NewDevelopmentEncoderConfig()
+	encoderConfig.TimeKey = ""
+	encoder := zapcore.NewConsoleEncoder(encoderConfig)
+	writer := bufio.NewWriter(&logsBuffer)
+	logger := zap.New(zapcore.NewCore(encoder, zapcore.AddSync(writer), zapcore.DebugLevel))
+	fn(logger)
+	writer.Flush()
+	return logsBuffer.String()
+}
+
+func TestUpdate_ForcedRefreshBumpsVersion(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":                     "forced.example.com",
+			"caddy.reverse_proxy":       "{{upstreams}}",
+			generator.ForceRefreshLabel: "true",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, nil)
+
+	loader.update()
+	assert.Equal(t, int64(1), loader.lastVersion)
+
+	loader.update()
+	assert.Equal(t, int64(2), loader.lastVersion)
+}
+
+func TestUpdate_UnchangedCaddyfileKeepsVersion(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "regular.example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, nil)
+
+	loader.update()
+	assert.Equal(t, int64(1), loader.lastVersion)
+
+	loader.update()
+	assert.Equal(t, int64(1), loader.lastVersion)
+
+	dockerClient.ContainersData = append(dockerClient.ContainersData, createContainer("172.17.0.3", map[string]string{
+		"caddy":               "other.example.com",
+		"caddy.reverse_proxy": "{{upstreams}}",
+	}))
+
+	loader.update()
+	assert.Equal(t, int64(2), loader.lastVersion)
+}
+
+func createTestLoader(t *testing.T, dockerClient docker.Client, customizeOptions func(*config.Options)) *DockerLoader {
+	CaddyfileAutosavePath = filepath.Join(t.TempDir(), "Caddyfile.autosave")
+
+	options := &config.Options{
+		LabelPrefix:     generator.DefaultLabelPrefix,
+		IngressNetworks: []string{"caddy"},
+		PollingInterval: time.Hour,
+	}
+	if customizeOptions != nil {
+		customizeOptions(options)
+	}
+
+	loader := CreateDockerLoader(options)
+	loader.dockerClients = []docker.Client{dockerClient}
+	loader.generator = generator.CreateGenerator(loader.dockerClients, &docker.UtilsMock{}, options)
+	loader.timer = time.AfterFunc(time.Hour, func() {})
+	t.Cleanup(func() { loader.timer.Stop() })
+	return loader
+}
+
+func createDockerClientMock() *docker.ClientMock {
+	return &docker.ClientMock{
+		NetworksData: []types.NetworkResource{
+			{ID: "caddy-id", Name: "caddy"},
+		},
+	}
+}
+
+func createContainer(ip string, labels map[string]string) types.Container {
+	return types.Container{
+		ID: "container-" + ip,
+		NetworkSettings: &types.SummaryNetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"caddy": {
+					IPAddress: ip,
+					NetworkID: "caddy-id",
+				},
+			},
+		},
+		Labels: labels,
+	}
+}
+
+func TestUpdate_IdenticalJSONKeepsVersion(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, nil)
+
+	loader.update()
+	assert.Equal(t, int64(1), loader.lastVersion)
+	configJSON := loader.lastJSONConfig
+
+	// Port 80 is the default port of upstreams, so the JSON config doesn't change
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams 80}}",
+		}),
+	}
+
+	loader.update()
+	assert.Equal(t, "example.com {\n\treverse_proxy 172.17.0.2:80\n}\n", string(loader.lastCaddyfile))
+	assert.Equal(t, configJSON, loader.lastJSONConfig)
+	assert.Equal(t, int64(1), loader.lastVersion)
+}
+
+func TestUpdate_RecoversFromCaddyfileFailingToAdapt(t *testing.T) {
+	var pushed []string
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pushed = append(pushed, string(body))
+	}))
+	defer admin.Close()
+	host, port, err := net.SplitHostPort(admin.Listener.Addr().String())
+	assert.NoError(t, err)
+
+	goodContainer := createContainer("172.17.0.2", map[string]string{
+		"caddy":               "example.com",
+		"caddy.reverse_proxy": "{{upstreams}}",
+	})
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{goodContainer}
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.AdminPort, _ = strconv.Atoi(port)
+	})
+	loader.serverResolver = &serverResolverMock{servers: []string{host}}
+
+	assert.True(t, loader.update())
+	assert.Equal(t, int64(1), loader.lastVersion)
+	assert.Len(t, pushed, 1)
+
+	dockerClient.ContainersData = []types.Container{goodContainer, createContainer("172.17.0.3", map[string]string{
+		"caddy":                   "other.example.com",
+		"caddy.unknown_directive": "value",
+	})}
+
+	// The Caddyfile failing to adapt fails every update instead of being considered unchanged
+	assert.False(t, loader.update())
+	assert.False(t, loader.update())
+	assert.Equal(t, int64(1), loader.lastVersion)
+	assert.Len(t, pushed, 1)
+
+	dockerClient.ContainersData = []types.Container{goodContainer, createContainer("172.17.0.3", map[string]string{
+		"caddy":               "other.example.com",
+		"caddy.reverse_proxy": "{{upstreams}}",
+	})}
+
+	assert.True(t, loader.update())
+	assert.Equal(t, int64(2), loader.lastVersion)
+	assert.Len(t, pushed, 2)
+	assert.Contains(t, pushed[1], "other.example.com")
+}
+
+func TestUpdate_ConcurrentWithEvents(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			loader.update()
+		}()
+		go func() {
+			defer wg.Done()
+			loader.timer.Reset(loader.eventsDebounce.delay(time.Now()))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, testCaddyfile, string(loader.lastCaddyfile))
+	assert.Equal(t, int64(1), loader.lastVersion)
+}
+
+func TestUpdate_MultipleDockerHosts(t *testing.T) {
+	labels := map[string]string{
+		"caddy":                      "example.com",
+		"caddy.reverse_proxy":        "{{upstreams}}",
+		"com.docker.compose.project": "app",
+		"com.docker.compose.service": "web",
+	}
+	hostA := createDockerClientMock()
+	hostA.ContainersData = []types.Container{createContainer("172.17.0.2", labels)}
+	hostB := createDockerClientMock()
+	hostB.ContainersData = []types.Container{
+		createContainer("172.17.0.2", labels),
+		createContainer("172.17.0.3", labels),
+	}
+	loader := createTestLoader(t, hostA, nil)
+	loader.dockerClients = []docker.Client{hostA, hostB}
+	loader.generator = generator.CreateGenerator(loader.dockerClients, &docker.UtilsMock{}, loader.options)
+
+	logs := captureLogs(func(log *zap.Logger) {
+		caddyfile, _, _ := loader.generator.GenerateCaddyfile(context.Background(), log)
+		assert.Equal(t, "example.com {\n\treverse_proxy 172.17.0.2 172.17.0.3\n}\n", string(caddyfile))
+	})
+	assert.NotContains(t, logs, "Route collision")
+}
+
+func TestPrintCaddyfile(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{createContainer("172.17.0.2", map[string]string{
+		"caddy":               "example.com",
+		"caddy.reverse_proxy": "{{upstreams 80}}",
+	})}
+	loader := createTestLoader(t, dockerClient, nil)
+
+	var output bytes.Buffer
+	assert.NoError(t, loader.printCaddyfile(zap.NewNop(), &output))
+	assert.Equal(t, "example.com {\n\treverse_proxy 172.17.0.2:80\n}\n", output.String())
+	assert.Equal(t, int64(0), loader.lastVersion)
+}
+
+func TestPrintCaddyfile_InvalidConfig(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{createContainer("172.17.0.2", map[string]string{
+		"caddy":                   "example.com",
+		"caddy.unknown_directive": "value",
+	})}
+	loader := createTestLoader(t, dockerClient, nil)
+
+	var output bytes.Buffer
+	logs := captureLogs(func(log *zap.Logger) {
+		assert.Error(t, loader.printCaddyfile(log, &output))
+	})
+	assert.Equal(t, "example.com {\n\tunknown_directive value\n}\n", output.String())
+	assert.Contains(t, logs, "Failed to convert caddyfile into json config")
+}
+
+// hungContainerListClient is a docker client whose container list only returns once ctx is done
+type hungContainerListClient struct {
+	*docker.ClientMock
+}
+
+func (client hungContainerListClient) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestUpdate_GenerationTimeoutKeepsPreviousConfig(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{createContainer("172.17.0.2", map[string]string{
+		"caddy":               "example.com",
+		"caddy.reverse_proxy": "{{upstreams 80}}",
+	})}
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.GenerationTimeout = 10 * time.Millisecond
+	})
+	loader.update()
+	previousCaddyfile := loader.lastCaddyfile
+	previousVersion := loader.lastVersion
+
+	loader.generator = generator.CreateGenerator([]docker.Client{hungContainerListClient{dockerClient}}, &docker.UtilsMock{}, loader.options)
+	assert.False(t, loader.update())
+	assert.Equal(t, previousCaddyfile, loader.lastCaddyfile)
+	assert.Equal(t, previousVersion, loader.lastVersion)
+}
+
+func TestMonitorEvents_MultipleDockerHosts(t *testing.T) {
+	hostA := createDockerClientMock()
+	hostA.EventsChannel = make(chan events.Message)
+	hostA.ErrorsChannel = make(chan error)
+	hostB := createDockerClientMock()
+	hostB.EventsChannel = make(chan events.Message)
+	hostB.ErrorsChannel = make(chan error)
+	loader := createTestLoader(t, hostA, func(options *config.Options) {
+		options.DockerSockets = []string{"tcp://host-a:2375", "tcp://host-b:2375"}
+		options.EventThrottleInterval = time.Millisecond
+	})
+	loader.dockerClients = []docker.Client{hostA, hostB}
+	updates := make(chan struct{}, 1)
+	loader.timer.Stop()
+	loader.timer = time.AfterFunc(time.Hour, func() {
+		updates <- struct{}{}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go loader.monitorEvents(ctx)
+
+	// Host B events are received while host A is connected
+	hostB.EventsChannel <- events.Message{Type: events.ContainerEventType, Action: events.ActionStart}
+	select {
+	case <-updates:
+	case <-time.After(time.Second):
+		assert.Fail(t, "Events of the second docker host didn't trigger an update")
+	}
+	assert.True(t, loader.eventsTracker.status().Connected["tcp://host-a:2375"])
+}
+
+func TestMonitorEvents_StopsOnMaxFailures(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ErrorsChannel = make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		dockerClient.ErrorsChannel <- errors.New("connection refused")
+	}
+	client := &eventsClientMock{ClientMock: dockerClient, calls: make(chan time.Time, 10)}
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.DockerSockets = []string{"unix:///var/run/docker.sock"}
+		options.EventsRetryBase = time.Millisecond
+		options.EventsRetryMax = time.Millisecond
+		options.EventsRetryResetAfter = time.Hour
+		options.EventsMaxFailures = 3
+		options.EventsStopOnMaxFailures = true
+	})
+	loader.dockerClients = []docker.Client{client}
+
+	done := make(chan struct{})
+	go func() {
+		loader.monitorEvents(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		assert.FailNow(t, "Didn't stop reconnecting to docker events")
+	}
+	assert.Len(t, client.calls, 3)
+}
+
+func TestTriggersUpdate_NetworkEvents(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	loader := createTestLoader(t, dockerClient, nil)
+	networkEvent := func(id string, name string) events.Message {
+		return events.Message{
+			Type:   events.NetworkEventType,
+			Action: events.ActionConnect,
+			Actor:  events.Actor{ID: id, Attributes: map[string]string{"name": name}},
+		}
+	}
+
+	assert.True(t, loader.triggersUpdate(networkEvent("caddy-id", "caddy")))
+	assert.False(t, loader.triggersUpdate(networkEvent("other-id", "other")))
+
+	// Ingress networks created after startup are looked up again
+	loader.update()
+	dockerClient.NetworksData = append(dockerClient.NetworksData, types.NetworkResource{ID: "caddy2-id", Name: "caddy2"})
+	loader.options.IngressNetworks = append(loader.options.IngressNetworks, "caddy2")
+	assert.True(t, loader.triggersUpdate(networkEvent("caddy2-id", "caddy2")))
+	loader.update()
+	assert.True(t, loader.generator.IsIngressNetwork("caddy2-id", ""))
+}
+
+func TestTriggersUpdate_ContainerEvents(t *testing.T) {
+	loader := createTestLoader(t, createDockerClientMock(), func(options *config.Options) {
+		options.ExtraLabelPrefixes = []string{"team"}
+	})
+	containerEvent := func(attributes map[string]string) events.Message {
+		return events.Message{
+			Type:   events.ContainerEventType,
+			Action: events.ActionStart,
+			Actor:  events.Actor{ID: "CONTAINER-ID", Attributes: attributes},
+		}
+	}
+
+	assert.True(t, loader.triggersUpdate(containerEvent(map[string]string{"name": "web", "caddy": "web.example.com"})))
+	assert.True(t, loader.triggersUpdate(containerEvent(map[string]string{"name": "web", "caddy_1.reverse_proxy": "{{upstreams}}"})))
+	assert.True(t, loader.triggersUpdate(containerEvent(map[string]string{"name": "web", "team.reverse_proxy": "{{upstreams}}"})))
+	assert.True(t, loader.triggersUpdate(containerEvent(map[string]string{"name": "task", "com.docker.swarm.service.id": "SERVICE-ID"})))
+	assert.True(t, loader.triggersUpdate(containerEvent(nil)))
+	assert.False(t, loader.triggersUpdate(containerEvent(map[string]string{"name": "db", "image": "postgres", "caddyfile": "x"})))
+}
+
+func TestStop_DoesNotLeakGoroutines(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.EventsChannel = make(chan events.Message)
+	dockerClient.ErrorsChannel = make(chan error)
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.DockerSockets = []string{"unix:///var/run/docker.sock"}
+		options.ReconcileCron = "0 3 * * *"
+	})
+	loader.timer.Stop()
+
+	// Settle goroutines started by previous tests
+	time.Sleep(10 * time.Millisecond)
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, loader.run(zap.NewNop()))
+		assert.NoError(t, loader.Stop())
+	}
+
+	// Timer callbacks that were already running may take a moment to return
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines)
+	assert.False(t, loader.update())
+}
+
+func TestUpdate_DumpsCaddyfile(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+	}
+	dumpPath := filepath.Join(t.TempDir(), "Caddyfile")
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.CaddyfileDumpPath = dumpPath
+	})
+
+	assert.True(t, loader.update())
+	dump, err := os.ReadFile(dumpPath)
+	assert.NoError(t, err)
+	assert.Equal(t, testCaddyfile, string(dump))
+	files, err := os.ReadDir(filepath.Dir(dumpPath))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	// Failing to write the dump doesn't abort the update
+	loader.options.CaddyfileDumpPath = filepath.Join(t.TempDir(), "missing", "Caddyfile")
+	dockerClient.ContainersData = []types.Container{}
+	assert.True(t, loader.update())
+	assert.Equal(t, int64(2), loader.lastVersion)
+}
+
+func TestUpdate_ValidateBeforePush(t *testing.T) {
+	pushes := 0
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			pushes++
+		}
+	}))
+	defer admin.Close()
+
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "http://example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.ValidateBeforePush = true
+	})
+	loader.serverResolver = &serverResolverMock{servers: []string{admin.Listener.Addr().String()}}
+	// Provisioning the trusted CA certificates fails when the file is missing
+	loader.validate = func(config *caddy.Config) error {
+		if bytes.Contains(config.AppsRaw["http"], []byte("/missing/ca.pem")) {
+			return errors.New("loading trusted CA certificates: no such file")
+		}
+		return nil
+	}
+
+	assert.True(t, loader.update())
+	assert.Equal(t, int64(1), loader.lastVersion)
+	assert.Equal(t, 1, pushes)
+	caddyfile := loader.lastCaddyfile
+	configJSON := loader.lastJSONConfig
+
+	// Adapts to JSON, but fails validation
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":                         "http://example.com",
+			"caddy.reverse_proxy":           "{{upstreams}}",
+			"caddy.reverse_proxy.transport": "http",
+			"caddy.reverse_proxy.transport.tls_trusted_ca_certs": "/missing/ca.pem",
+		}),
+	}
+
+	loader.update()
+	assert.True(t, loader.lastRejected)
+	assert.Equal(t, 1, pushes)
+	assert.Equal(t, caddyfile, loader.lastCaddyfile)
+	assert.Equal(t, configJSON, loader.lastJSONConfig)
+	assert.Equal(t, int64(1), loader.lastVersion)
+	assert.Error(t, loader.validateConfig(loader.lastJSONConfig[:10]))
+
+	loader.options.ValidateBeforePush = false
+	assert.NoError(t, loader.validateConfig([]byte(`invalid`)))
+}
+
+func TestUpdate_RetriesEmptyBoot(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.EmptyBootRetries = 3
+		options.EmptyBootRetryInterval = 10 * time.Millisecond
+	})
+	type retryResult struct {
+		caddyfile   []byte
+		bootRetries int
+	}
+	updated := make(chan retryResult, 1)
+	loader.timer.Stop()
+	loader.timer = time.AfterFunc(time.Hour, func() {
+		loader.updateMutex.Lock()
+		defer loader.updateMutex.Unlock()
+		loader.updateLocked()
+		updated <- retryResult{loader.lastCaddyfile, loader.bootRetries}
+	})
+
+	// The retry is armed by the update, but waits for the containers to be created
+	loader.updateMutex.Lock()
+	loader.updateLocked()
+	assert.Equal(t, generator.EmptyCaddyfile, string(loader.lastCaddyfile))
+	assert.Equal(t, 2, loader.bootRetries)
+
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+	}
+	loader.updateMutex.Unlock()
+
+	select {
+	case result := <-updated:
+		assert.Equal(t, testCaddyfile, string(result.caddyfile))
+		assert.Equal(t, 0, result.bootRetries)
+	case <-time.After(time.Second):
+		assert.Fail(t, "Generation wasn't retried")
+	}
+}
+
+func TestUpdate_EmptyBootRetriesExhausted(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.EmptyBootRetries = 2
+		options.EmptyBootRetryInterval = time.Hour
+	})
+
+	loader.update()
+	loader.update()
+	assert.Equal(t, 0, loader.bootRetries)
+
+	loader.update()
+	assert.Equal(t, 0, loader.bootRetries)
+}
+
+func TestVerifyServerConfig(t *testing.T) {
+	runningConfig := `{"apps":{"http":{"servers":{"srv0":{"listen":[":443"]}}}}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(runningConfig))
+	}))
+	defer server.Close()
+
+	loader := CreateDockerLoader(&config.Options{})
+
+	var verified bool
+	logs := captureLogs(func(log *zap.Logger) {
+		verified = loader.verifyServerConfig(log, "server", server.URL+"/config/", []byte(`{"apps": {"http": {"servers": {"srv0": {"listen": [":443"]}}}}}`))
+	})
+	assert.True(t, verified)
+	assert.NotContains(t, logs, "WARN")
+
+	runningConfig = `{"apps":{"http":{"servers":{"srv0":{"listen":[":80"]}}}}}`
+	logs = captureLogs(func(log *zap.Logger) {
+		verified = loader.verifyServerConfig(log, "server", server.URL+"/config/", []byte(`{"apps": {"http": {"servers": {"srv0": {"listen": [":443"]}}}}}`))
+	})
+	assert.False(t, verified)
+	assert.Contains(t, logs, `WARN	Server is not running the configuration sent to it	{"server": "server"}`)
+}
+
+func TestCreatePushClient_SourceAddr(t *testing.T) {
+	dialer := createPushDialer(net.ParseIP("127.0.0.1"))
+	assert.Equal(t, &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}, dialer.LocalAddr)
+
+	var remoteAddr string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+	}))
+	defer server.Close()
+
+	loader := CreateDockerLoader(&config.Options{PushSourceAddr: net.ParseIP("127.0.0.1")})
+	resp, err := loader.httpClient.Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", host)
+}
+
+func TestCreatePushClient_Default(t *testing.T) {
+	loader := CreateDockerLoader(&config.Options{AdminRequestTimeout: 5 * time.Second})
+
+	assert.NotSame(t, http.DefaultClient, loader.httpClient)
+	assert.Nil(t, loader.httpClient.Transport)
+	assert.Equal(t, 5*time.Second, loader.httpClient.Timeout)
+}
+
+func TestUpdateServer_HungServerTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer admin.Close()
+	defer close(release)
+
+	loader := CreateDockerLoader(&config.Options{AdminRequestTimeout: 10 * time.Millisecond})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+
+	logs := captureLogs(func(log *zap.Logger) {
+		retry, err := loader.sendConfig(context.Background(), log, "server", admin.URL, []byte(testConfigJSON))
+		assert.Error(t, err)
+		assert.True(t, retry)
+	})
+	assert.Contains(t, logs, `ERROR	Failed to send configuration to	{"server": "server", "error": "Post \"`+admin.URL+`/load\": context deadline exceeded"}`)
+
+	// Failed updates don't leave the server flagged as updating, so later updates retry it
+	loader.updateServerAt("server", admin.URL)
+	assert.False(t, loader.serversUpdating.Get("server"))
+	assert.Equal(t, int64(0), loader.serversVersions.Get("server"))
+}
+
+func TestSendConfig_HTTPOnlyChange(t *testing.T) {
+	var paths []string
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	loader := CreateDockerLoader(&config.Options{HTTPOnlyReload: true})
+
+	initialConfig := `{"apps":{"http":{"servers":{"srv0":{"listen":[":443"]}}},"tls":{"automation":{}}}}`
+	httpChangedConfig := `{"apps":{"http":{"servers":{"srv0":{"listen":[":80"]}}},"tls":{"automation":{}}}}`
+	tlsChangedConfig := `{"apps":{"http":{"servers":{"srv0":{"listen":[":80"]}}},"tls":{"automation":{"policies":[]}}}}`
+
+	_, err := loader.sendConfig(context.Background(), zap.NewNop(), "server", server.URL, []byte(initialConfig))
+	assert.NoError(t, err)
+	_, err = loader.sendConfig(context.Background(), zap.NewNop(), "server", server.URL, []byte(httpChangedConfig))
+	assert.NoError(t, err)
+	_, err = loader.sendConfig(context.Background(), zap.NewNop(), "server", server.URL, []byte(tlsChangedConfig))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"/load", "/config/apps/http", "/load"}, paths)
+	assert.Equal(t, `{"servers":{"srv0":{"listen":[":80"]}}}`, bodies[1])
+	assert.Equal(t, tlsChangedConfig, bodies[2])
+}
+
+func TestSendConfig_HTTPOnlyReloadDisabled(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer server.Close()
+
+	loader := CreateDockerLoader(&config.Options{})
+
+	loader.sendConfig(context.Background(), zap.NewNop(), "server", server.URL, []byte(`{"apps":{"http":{}}}`))
+	loader.sendConfig(context.Background(), zap.NewNop(), "server", server.URL, []byte(`{"apps":{"http":{"servers":{}}}}`))
+
+	assert.Equal(t, []string{"/load", "/load"}, paths)
+}
+
+func TestSendConfig_Compressed(t *testing.T) {
+	var paths []string
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		gzipReader, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(gzipReader)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	loader := CreateDockerLoader(&config.Options{CompressConfigPush: true})
+
+	_, err := loader.sendConfig(context.Background(), zap.NewNop(), "server", server.URL, []byte(testConfigJSON))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"/docker-proxy/load"}, paths)
+	assert.Equal(t, []string{testConfigJSON}, bodies)
+}
+
+func TestSendConfig_CompressedFallback(t *testing.T) {
+	var paths []string
+	var bodies []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/load", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, string(body))
+	})
+	mux.HandleFunc("/docker-proxy/load", func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		http.NotFound(w, r)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	loader := CreateDockerLoader(&config.Options{CompressConfigPush: true})
+
+	for i := 0; i < 2; i++ {
+		_, err := loader.sendConfig(context.Background(), zap.NewNop(), "server", server.URL, []byte(testConfigJSON))
+		assert.NoError(t, err)
+	}
+
+	// Servers without the endpoint are only tried once
+	assert.Equal(t, []string{"/docker-proxy/load", "/load", "/load"}, paths)
+	assert.Equal(t, []string{testConfigJSON, testConfigJSON}, bodies)
+}
+
+func TestSendConfig_Conditional(t *testing.T) {
+	var requests []string
+	currentConfig := ""
+	etag := func() string {
+		return fmt.Sprintf(`"/config/ %x"`, sha256.Sum256([]byte(currentConfig)))
+	}
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("If-Match"))
+		if r.Method == http.MethodGet {
+			w.Header().Set("Etag", etag())
+			return
+		}
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != etag() {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		currentConfig = string(body)
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{ConditionalPush: true, PushRetryAttempts: 2})
+
+	assert.NoError(t, loader.sendConfigWithRetries(zap.NewNop(), "server", admin.URL, []byte(`{"version":1}`)))
+	firstEtag := etag()
+
+	// Another controller changes the configuration
+	currentConfig = `{"version":"other"}`
+	otherEtag := etag()
+
+	assert.NoError(t, loader.sendConfigWithRetries(zap.NewNop(), "server", admin.URL, []byte(`{"version":2}`)))
+	assert.Equal(t, `{"version":2}`, currentConfig)
+	assert.Equal(t, etag(), loader.serversEtags.Get("server"))
+
+	assert.Equal(t, []string{
+		"POST /config/ ",
+		"GET /config/ ",
+		"POST /config/ " + firstEtag,
+		"GET /config/ ",
+		"POST /config/ " + otherEtag,
+		"GET /config/ ",
+	}, requests)
+}
+
+func TestUpdateServer_SkipsUnchangedConfig(t *testing.T) {
+	status := http.StatusOK
+	pushes := 0
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes++
+		w.WriteHeader(status)
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+	loader.updateServerAt("server", admin.URL)
+	assert.Equal(t, 1, pushes)
+
+	loader.lastVersion = 2
+	loader.updateServerAt("server", admin.URL)
+	assert.Equal(t, 1, pushes)
+	assert.Equal(t, int64(2), loader.serversVersions.Get("server"))
+
+	// After a failed push, the last successfully sent config is sent again
+	status = http.StatusBadRequest
+	loader.lastJSONConfig = []byte(`{"apps":{}}`)
+	loader.lastVersion = 3
+	loader.updateServerAt("server", admin.URL)
+	assert.Equal(t, 2, pushes)
+
+	status = http.StatusOK
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 4
+	loader.updateServerAt("server", admin.URL)
+	assert.Equal(t, 3, pushes)
+	assert.Equal(t, int64(4), loader.serversVersions.Get("server"))
+}
+
+func TestUpdateServer_RetriesTransientFailures(t *testing.T) {
+	attempts := 0
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{
+		PushRetryAttempts: 3,
+		PushRetryDelay:    time.Millisecond,
+	})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+
+	logs := captureLogs(func(log *zap.Logger) {
+		assert.NoError(t, loader.sendConfigWithRetries(log, "server", admin.URL, []byte(testConfigJSON)))
+	})
+	assert.Equal(t, 3, attempts)
+	assert.Contains(t, logs, `INFO	Retrying to send configuration to	{"server": "server", "attempt": 3}`)
+
+	loader.updateServerAt("server", admin.URL)
+	assert.Equal(t, int64(1), loader.serversVersions.Get("server"))
+}
+
+func TestUpdateServer_GivesUpAfterAttempts(t *testing.T) {
+	attempts := 0
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{
+		PushRetryAttempts: 2,
+		PushRetryDelay:    time.Millisecond,
+	})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+
+	loader.updateServerAt("server", admin.URL)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, int64(0), loader.serversVersions.Get("server"))
+}
+
+func TestUpdateServer_DoesNotRetryRejectedConfig(t *testing.T) {
+	attempts := 0
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{
+		PushRetryAttempts: 3,
+		PushRetryDelay:    time.Millisecond,
+	})
+
+	assert.Error(t, loader.sendConfigWithRetries(zap.NewNop(), "server", admin.URL, []byte(testConfigJSON)))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestUpdateServer_RetriesStopAtTimeout(t *testing.T) {
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{
+		PushRetryAttempts: 100,
+		PushRetryDelay:    time.Hour,
+		PushTimeout:       10 * time.Millisecond,
+	})
+
+	logs := captureLogs(func(log *zap.Logger) {
+		assert.Error(t, loader.sendConfigWithRetries(log, "server", admin.URL, []byte(testConfigJSON)))
+	})
+	assert.Contains(t, logs, `ERROR	Timed out sending configuration to	{"server": "server"}`)
+}
+
+func TestUpdateServer_HealthProbeFails(t *testing.T) {
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer admin.Close()
+	probe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer probe.Close()
+
+	loader := CreateDockerLoader(&config.Options{
+		ConfirmWithHealthProbe: true,
+		HealthProbeURL:         probe.URL,
+		HealthProbeTimeout:     10 * time.Millisecond,
+	})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+
+	loader.updateServerAt("server", admin.URL)
+	assert.Equal(t, int64(0), loader.serversVersions.Get("server"))
+
+	logs := captureLogs(func(log *zap.Logger) {
+		assert.False(t, loader.waitHealthProbe(log, "server", probe.URL, 0))
+	})
+	assert.Contains(t, logs, `ERROR	Health probe failed after configuring	{"server": "server", "status code": 503}`)
+}
+
+func TestUpdateServer_HealthProbePasses(t *testing.T) {
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer admin.Close()
+	probes := 0
+	probe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes++
+		if probes == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer probe.Close()
+
+	loader := CreateDockerLoader(&config.Options{
+		ConfirmWithHealthProbe: true,
+		HealthProbeURL:         probe.URL,
+		HealthProbeTimeout:     5 * time.Second,
+	})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+
+	loader.updateServerAt("server", admin.URL)
+
+	assert.Equal(t, int64(1), loader.serversVersions.Get("server"))
+	assert.Equal(t, 2, probes)
+}
+
+func TestUpdateServer_HealthProbeUsesAdminEndpoint(t *testing.T) {
+	probes := 0
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/config/" {
+			probes++
+		}
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{
+		ConfirmWithHealthProbe: true,
+		HealthProbeTimeout:     10 * time.Millisecond,
+		AdminAuthToken:         "secret",
+	})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+
+	loader.updateServerAt("server", admin.URL)
+
+	assert.Equal(t, int64(1), loader.serversVersions.Get("server"))
+	assert.Equal(t, 1, probes)
+}
+
+func TestWaitHealthProbe_AdminRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	probe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer probe.Close()
+	defer close(release)
+
+	loader := CreateDockerLoader(&config.Options{AdminRequestTimeout: 10 * time.Millisecond})
+
+	logs := captureLogs(func(log *zap.Logger) {
+		assert.False(t, loader.waitHealthProbe(log, "server", probe.URL, 0))
+	})
+	assert.Contains(t, logs, "context deadline exceeded")
+}
+
+func TestResolveDockerHost(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "")
+	host, source, err := resolveDockerHost(&config.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, client.DefaultDockerHost, host)
+	assert.Equal(t, "default", source)
+
+	t.Setenv("DOCKER_HOST", "tcp://10.0.0.2:2375")
+	host, source, err = resolveDockerHost(&config.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp://10.0.0.2:2375", host)
+	assert.Equal(t, "environment", source)
+
+	host, source, err = resolveDockerHost(&config.Options{DockerHost: "unix:///run/user/1000/docker.sock"})
+	assert.NoError(t, err)
+	assert.Equal(t, "unix:///run/user/1000/docker.sock", host)
+	assert.Equal(t, "option", source)
+
+	_, _, err = resolveDockerHost(&config.Options{DockerHost: "10.0.0.2"})
+	assert.ErrorContains(t, err, `docker host "10.0.0.2"`)
+}
+
+func TestRunInWaves(t *testing.T) {
+	servers := []string{"server1", "server2", "server3", "server4", "server5"}
+
+	var mutex sync.Mutex
+	pushes := map[string]time.Time{}
+	start := time.Now()
+	runInWaves(servers, 2, 50*time.Millisecond, 0, func(wg *sync.WaitGroup, server string) {
+		defer wg.Done()
+		mutex.Lock()
+		defer mutex.Unlock()
+		pushes[server] = time.Now()
+	})
+
+	assert.Len(t, pushes, 5)
+	assert.Less(t, pushes["server2"].Sub(start), 50*time.Millisecond)
+	assert.GreaterOrEqual(t, pushes["server3"].Sub(start), 50*time.Millisecond)
+	assert.GreaterOrEqual(t, pushes["server4"].Sub(start), 50*time.Millisecond)
+	assert.GreaterOrEqual(t, pushes["server5"].Sub(start), 100*time.Millisecond)
+	for _, server := range []string{"server3", "server4"} {
+		assert.GreaterOrEqual(t, pushes[server].Sub(pushes["server1"]), 50*time.Millisecond)
+		assert.GreaterOrEqual(t, pushes[server].Sub(pushes["server2"]), 50*time.Millisecond)
+		assert.GreaterOrEqual(t, pushes["server5"].Sub(pushes[server]), 50*time.Millisecond)
+	}
+}
+
+func TestRunInWaves_AllAtOnce(t *testing.T) {
+	servers := []string{"server1", "server2", "server3"}
+
+	var waiting sync.WaitGroup
+	waiting.Add(len(servers))
+	runInWaves(servers, 0, time.Hour, 0, func(wg *sync.WaitGroup, server string) {
+		defer wg.Done()
+		// Only completes if all servers are pushed concurrently
+		waiting.Done()
+		waiting.Wait()
+	})
+}
+
+func TestRunInWaves_Concurrency(t *testing.T) {
+	servers := []string{"server1", "server2", "server3", "server4", "server5", "server6", "server7"}
+
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	pushed := map[string]bool{}
+	runInWaves(servers, 0, time.Hour, 3, func(wg *sync.WaitGroup, server string) {
+		defer wg.Done()
+		mutex.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		pushed[server] = true
+		mutex.Unlock()
+	})
+
+	assert.Equal(t, 3, maxRunning)
+	assert.Len(t, pushed, len(servers))
+}
+
+func TestUpdate_DrainsRemovedRoutes(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+		createContainer("172.17.0.3", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+		createContainer("172.17.0.4", map[string]string{
+			"caddy":               "old.example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.RouteDrainPeriod = 50 * time.Millisecond
+	})
+	type drainResult struct {
+		caddyfile []byte
+		drained   bool
+	}
+	updated := make(chan drainResult, 1)
+	loader.timer.Stop()
+	loader.timer = time.AfterFunc(time.Hour, func() {
+		loader.updateMutex.Lock()
+		defer loader.updateMutex.Unlock()
+		loader.updateLocked()
+		updated <- drainResult{loader.lastCaddyfile, len(loader.drains) == 0}
+	})
+
+	loader.update()
+	assert.Equal(t, "example.com {\n"+
+		"	reverse_proxy 172.17.0.2 172.17.0.3\n"+
+		"}\n"+
+		"old.example.com {\n"+
+		"	reverse_proxy 172.17.0.4\n"+
+		"}\n", string(loader.lastCaddyfile))
+
+	// Removed upstreams stop getting requests, removed route is kept without upstreams, answering
+	// 503 while draining. The update arms the drain timer, which waits for the lock to be released
+	loader.updateMutex.Lock()
+	dockerClient.ContainersData = dockerClient.ContainersData[:1]
+	loader.updateLocked()
+	assert.Equal(t, testCaddyfile+
+		"old.example.com {\n"+
+		"	reverse_proxy\n"+
+		"}\n", string(loader.lastCaddyfile))
+	loader.updateMutex.Unlock()
+
+	select {
+	case result := <-updated:
+		assert.Equal(t, testCaddyfile, string(result.caddyfile))
+		assert.True(t, result.drained)
+	case <-time.After(time.Second):
+		assert.Fail(t, "Drained routes weren't removed")
+	}
+}
+
+func TestDrainRemovedRoutes_KeepsEachRouteForFullPeriod(t *testing.T) {
+	loader := createTestLoader(t, createDockerClientMock(), func(options *config.Options) {
+		options.RouteDrainPeriod = time.Minute
+	})
+	const a = "a.example.com {\n\treverse_proxy 10.0.0.1\n}\n"
+	const b = "b.example.com {\n\treverse_proxy 10.0.0.2\n}\n"
+	const drainedA = "a.example.com {\n\treverse_proxy\n}\n"
+	const drainedB = "b.example.com {\n\treverse_proxy\n}\n"
+	empty := []byte(generator.EmptyCaddyfile)
+	start := time.Now()
+
+	assert.Equal(t, a+b, string(loader.drainRemovedRoutes(zap.NewNop(), []byte(a+b), start)))
+	assert.Equal(t, drainedA+b, string(loader.drainRemovedRoutes(zap.NewNop(), []byte(b), start)))
+
+	// Removed halfway through the drain of a.example.com
+	halfway := start.Add(30 * time.Second)
+	assert.Equal(t, drainedA+drainedB, string(loader.drainRemovedRoutes(zap.NewNop(), empty, halfway)))
+	assert.Len(t, loader.drains, 2)
+
+	assert.Equal(t, drainedB, string(loader.drainRemovedRoutes(zap.NewNop(), empty, start.Add(time.Minute))))
+	assert.Equal(t, generator.EmptyCaddyfile, string(loader.drainRemovedRoutes(zap.NewNop(), empty, halfway.Add(time.Minute))))
+	assert.Empty(t, loader.drains)
+}
+
+type eventsClientMock struct {
+	*docker.ClientMock
+	calls chan time.Time
+}
+
+func (mock *eventsClientMock) Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error) {
+	mock.calls <- time.Now()
+	return mock.ClientMock.Events(ctx, options)
+}
+
+func TestNextPollingInterval(t *testing.T) {
+	loader := CreateDockerLoader(&config.Options{
+		PollingInterval:    10 * time.Second,
+		MaxPollingInterval: 35 * time.Second,
+	})
+	event := events.Message{Type: events.ContainerEventType, Action: events.ActionStart}
+	// Events are recorded after past polls and before future ones
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Minute)
+
+	// Without events polling stays at the base interval
+	loader.lastUpdateOK = true
+	assert.Equal(t, 10*time.Second, loader.nextPollingInterval(past))
+	assert.Equal(t, 10*time.Second, loader.nextPollingInterval(past))
+
+	// While events flow and updates succeed, it doubles up to the max
+	for _, expected := range []time.Duration{20 * time.Second, 35 * time.Second, 35 * time.Second} {
+		loader.eventsTracker.record("socket", event)
+		assert.Equal(t, expected, loader.nextPollingInterval(past))
+	}
+
+	// A failed update goes back to the base interval
+	loader.eventsTracker.record("socket", event)
+	loader.lastUpdateOK = false
+	assert.Equal(t, 10*time.Second, loader.nextPollingInterval(past))
+
+	// And so do polls without events since the previous one
+	loader.lastUpdateOK = true
+	loader.eventsTracker.record("socket", event)
+	assert.Equal(t, 20*time.Second, loader.nextPollingInterval(future))
+	assert.Equal(t, 10*time.Second, loader.nextPollingInterval(future.Add(time.Second)))
+}
+
+func TestNextPollingInterval_Fixed(t *testing.T) {
+	loader := CreateDockerLoader(&config.Options{PollingInterval: 10 * time.Second})
+	loader.lastUpdateOK = true
+
+	for i := 0; i < 3; i++ {
+		loader.eventsTracker.record("socket", events.Message{Type: events.ContainerEventType, Action: events.ActionStart})
+		assert.Equal(t, 10*time.Second, loader.nextPollingInterval(time.Now().Add(-time.Minute)))
+	}
+}
+
+func TestPollingJitter(t *testing.T) {
+	loader := CreateDockerLoader(&config.Options{PollingInterval: 10 * time.Second, PollingJitter: 20})
+
+	varied := false
+	for i := 0; i < 100; i++ {
+		interval := loader.jitter(10 * time.Second)
+		assert.GreaterOrEqual(t, interval, 8*time.Second)
+		assert.LessOrEqual(t, interval, 12*time.Second)
+		varied = varied || interval != 10*time.Second
+
+		delay := loader.initialPollingDelay()
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.LessOrEqual(t, delay, 2*time.Second)
+	}
+	assert.True(t, varied)
+}
+
+func TestPollingJitter_Disabled(t *testing.T) {
+	loader := CreateDockerLoader(&config.Options{PollingInterval: 10 * time.Second})
+
+	assert.Equal(t, 10*time.Second, loader.jitter(10*time.Second))
+	assert.Equal(t, time.Duration(0), loader.initialPollingDelay())
+}
+
+func TestEventsRetryDelay(t *testing.T) {
+	loader := createTestLoader(t, createDockerClientMock(), func(options *config.Options) {
+		options.EventsRetryBase = time.Second
+		options.EventsRetryMax = 30 * time.Second
+		options.EventsRetryResetAfter = time.Minute
+	})
+
+	assert.Equal(t, time.Second, loader.eventsRetryDelay(0, time.Millisecond))
+	assert.Equal(t, 2*time.Second, loader.eventsRetryDelay(time.Second, time.Millisecond))
+	assert.Equal(t, 16*time.Second, loader.eventsRetryDelay(8*time.Second, time.Millisecond))
+	assert.Equal(t, 30*time.Second, loader.eventsRetryDelay(16*time.Second, time.Millisecond))
+	assert.Equal(t, 30*time.Second, loader.eventsRetryDelay(30*time.Second, time.Millisecond))
+	assert.Equal(t, time.Second, loader.eventsRetryDelay(30*time.Second, time.Minute))
+}
+
+func TestMonitorEvents_BacksOffAndStops(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ErrorsChannel = make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		dockerClient.ErrorsChannel <- errors.New("connection reset")
+	}
+	client := &eventsClientMock{ClientMock: dockerClient, calls: make(chan time.Time, 10)}
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.DockerSockets = []string{"unix:///var/run/docker.sock"}
+		options.EventsRetryBase = 20 * time.Millisecond
+		options.EventsRetryMax = 40 * time.Millisecond
+		options.EventsRetryResetAfter = time.Hour
+	})
+	loader.dockerClients = []docker.Client{client}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		loader.monitorEvents(ctx)
+		close(done)
+	}()
+
+	calls := []time.Time{}
+	for len(calls) < 4 {
+		select {
+		case call := <-client.calls:
+			calls = append(calls, call)
+		case <-time.After(time.Second):
+			assert.FailNow(t, "Didn't reconnect to docker events")
+		}
+	}
+	assert.GreaterOrEqual(t, calls[1].Sub(calls[0]), 20*time.Millisecond)
+	assert.GreaterOrEqual(t, calls[2].Sub(calls[1]), 40*time.Millisecond)
+	assert.GreaterOrEqual(t, calls[3].Sub(calls[2]), 40*time.Millisecond)
+
+	// Stopping while connected returns without reconnecting
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		assert.Fail(t, "Didn't stop listening to docker events")
+	}
+	assert.Empty(t, client.calls)
+}
+
+func TestUpdateServer_SkipsExcludedServers(t *testing.T) {
+	requests := 0
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{ExcludedServers: []string{"10.0.1.*"}})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+
+	loader.updateServerAt("10.0.1.5", admin.URL)
+	assert.Equal(t, 0, requests)
+	assert.Equal(t, int64(0), loader.serversVersions.Get("10.0.1.5"))
+
+	loader.updateServerAt("10.0.2.5", admin.URL)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, int64(1), loader.serversVersions.Get("10.0.2.5"))
+
+	// Excluded servers don't hold readiness
+	assert.True(t, loader.serversConfigured([]string{"10.0.1.5", "10.0.2.5"}))
+}
+
+func TestUpdateOnTimer_MinUpdateInterval(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	loader := createTestLoader(t, dockerClient, func(options *config.Options) {
+		options.MinUpdateInterval = 10 * time.Second
+	})
+	loader.serverResolver = &serverResolverMock{servers: []string{}}
+	now := time.Now()
+
+	assert.True(t, loader.updateOnTimer(now))
+	assert.Equal(t, int64(1), loader.lastVersion)
+
+	// Changes arriving within the interval are applied once it elapses
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams 80}}",
+		}),
+	}
+	assert.False(t, loader.updateOnTimer(now.Add(time.Second)))
+	assert.Equal(t, int64(1), loader.lastVersion)
+
+	assert.True(t, loader.updateOnTimer(now.Add(11*time.Second)))
+	assert.Equal(t, int64(2), loader.lastVersion)
+	assert.Contains(t, string(loader.lastCaddyfile), "example.com")
+}
+
+func TestUpdateOnTimer_MinUpdateIntervalDisabled(t *testing.T) {
+	loader := createTestLoader(t, createDockerClientMock(), nil)
+	loader.serverResolver = &serverResolverMock{servers: []string{}}
+	now := time.Now()
+
+	assert.True(t, loader.updateOnTimer(now))
+	assert.True(t, loader.updateOnTimer(now))
+}
+
+func TestAddAdminListen_KeepsAdminSettings(t *testing.T) {
+	configJSON := `{"admin":{"listen":"localhost:2019","enforce_origin":true,"origins":["controller.internal"]},"apps":{}}`
+
+	postBody, err := addAdminListen([]byte(configJSON), &caddy.AdminConfig{Listen: "tcp/10.0.0.2:2019"})
+	assert.NoError(t, err)
+
+	config := caddy.Config{}
+	assert.NoError(t, json.Unmarshal(postBody, &config))
+	assert.Equal(t, "tcp/10.0.0.2:2019", config.Admin.Listen)
+	assert.True(t, config.Admin.EnforceOrigin)
+	assert.Equal(t, []string{"controller.internal"}, config.Admin.Origins)
+}
+
+func TestAddAdminListen_WithoutAdminSettings(t *testing.T) {
+	postBody, err := addAdminListen([]byte(testConfigJSON), &caddy.AdminConfig{Listen: "tcp/10.0.0.2:2019"})
+	assert.NoError(t, err)
+
+	config := caddy.Config{}
+	assert.NoError(t, json.Unmarshal(postBody, &config))
+	assert.Equal(t, &caddy.AdminConfig{Listen: "tcp/10.0.0.2:2019"}, config.Admin)
+}
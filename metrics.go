@@ -0,0 +1,55 @@
+package caddydockerproxy
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics are registered in the default prometheus registry, served by caddy metrics handler
+var dockerProxyMetrics = struct {
+	generations        prometheus.Counter
+	generationDuration prometheus.Histogram
+	pushes             *prometheus.CounterVec
+	configVersion      prometheus.Gauge
+}{
+	generations: promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "caddy",
+		Subsystem: "docker_proxy",
+		Name:      "caddyfile_generations_total",
+		Help:      "Counter of Caddyfile generations.",
+	}),
+	generationDuration: promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "caddy",
+		Subsystem: "docker_proxy",
+		Name:      "caddyfile_generation_duration_seconds",
+		Help:      "Histogram of Caddyfile generation durations.",
+		Buckets:   prometheus.DefBuckets,
+	}),
+	pushes: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "caddy",
+		Subsystem: "docker_proxy",
+		Name:      "config_pushes_total",
+		Help:      "Counter of configuration pushes to servers by result.",
+	}, []string{"server", "result"}),
+	configVersion: promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "caddy",
+		Subsystem: "docker_proxy",
+		Name:      "config_version",
+		Help:      "Version of the last configuration generated.",
+	}),
+}
+
+func observeGeneration(duration time.Duration) {
+	dockerProxyMetrics.generations.Inc()
+	dockerProxyMetrics.generationDuration.Observe(duration.Seconds())
+}
+
+func observePush(server string, configured bool) {
+	result := "failure"
+	if configured {
+		result = "success"
+	}
+	dockerProxyMetrics.pushes.WithLabelValues(server, result).Inc()
+}
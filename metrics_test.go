@@ -0,0 +1,50 @@
+package caddydockerproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_Update(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+	}
+	loader := createTestLoader(t, dockerClient, nil)
+	generations := testutil.ToFloat64(dockerProxyMetrics.generations)
+
+	loader.update()
+
+	assert.Equal(t, generations+1, testutil.ToFloat64(dockerProxyMetrics.generations))
+	assert.Equal(t, float64(1), testutil.ToFloat64(dockerProxyMetrics.configVersion))
+}
+
+func TestMetrics_Pushes(t *testing.T) {
+	status := http.StatusOK
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+
+	loader.updateServerAt("metrics-server", admin.URL)
+	status = http.StatusBadRequest
+	loader.lastJSONConfig = []byte(`{"apps":{}}`)
+	loader.lastVersion = 2
+	loader.updateServerAt("metrics-server", admin.URL)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(dockerProxyMetrics.pushes.WithLabelValues("metrics-server", "success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(dockerProxyMetrics.pushes.WithLabelValues("metrics-server", "failure")))
+}
@@ -4,6 +4,7 @@ import "github.com/caddyserver/caddy/v2"
 
 func init() {
 	caddy.RegisterModule(CaddyDockerProxy{})
+	caddy.RegisterModule(AdminAPI{})
 }
 
 // Caddy docker proxy module
@@ -0,0 +1,148 @@
+package caddydockerproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/caddyfile"
+)
+
+// redactedValue replaces sensitive values in logged configs
+const redactedValue = "REDACTED"
+
+// redactedHeaderDirectives set headers, the values of sensitive headers are redacted
+var redactedHeaderDirectives = map[string]bool{
+	"header":         true,
+	"header_up":      true,
+	"header_down":    true,
+	"request_header": true,
+}
+
+// redactedHeaders are headers whose values are redacted
+var redactedHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+}
+
+// redactedJSONKeys are keys of JSON configs whose values are redacted: passwords of
+// http_basic accounts, DNS provider tokens and private keys
+var redactedJSONKeys = map[string]bool{
+	"password":  true,
+	"api_token": true,
+	"key":       true,
+}
+
+// redactCaddyfile returns a copy of a Caddyfile for logging, with basicauth credentials, DNS provider
+// arguments of tls, sensitive header values and all arguments of extraDirectives redacted
+func redactCaddyfile(content []byte, extraDirectives []string) []byte {
+	container, err := caddyfile.Unmarshal(content)
+	if err != nil {
+		return []byte("# Caddyfile redacted, failed to parse it: " + err.Error() + "\n")
+	}
+	directives := map[string]bool{}
+	for _, directive := range extraDirectives {
+		directives[strings.TrimSpace(directive)] = true
+	}
+	for _, block := range container.Children {
+		redactBlocks(block.Container, directives)
+	}
+	return container.Marshal()
+}
+
+func redactBlocks(container *caddyfile.Container, extraDirectives map[string]bool) {
+	for _, block := range container.Children {
+		if len(block.Keys) == 0 {
+			continue
+		}
+		directive := block.Keys[0]
+		switch {
+		case extraDirectives[directive]:
+			redactArguments(block, 1)
+			continue
+		case directive == "basicauth" || directive == "basic_auth":
+			// Accounts are subdirectives with the user followed by the password hash
+			for _, account := range block.Children {
+				redactArguments(account, 1)
+			}
+			continue
+		case directive == "dns":
+			// The first argument is the DNS provider, followed by its credentials
+			redactArguments(block, 2)
+			continue
+		case redactedHeaderDirectives[directive]:
+			redactHeaders(block)
+		}
+		redactBlocks(block.Container, extraDirectives)
+	}
+}
+
+// redactHeaders redacts values of sensitive headers set by block, or by its subdirectives
+// when it has any
+func redactHeaders(block *caddyfile.Block) {
+	for i := 1; i < len(block.Keys)-1; i++ {
+		if redactedHeaders[strings.ToLower(strings.TrimLeft(block.Keys[i], "+-?>"))] {
+			redactKeys(block.Keys[i+1:])
+			break
+		}
+	}
+	for _, child := range block.Children {
+		if len(child.Keys) > 0 && redactedHeaders[strings.ToLower(strings.TrimLeft(child.Keys[0], "+-?>"))] {
+			redactKeys(child.Keys[1:])
+		}
+	}
+}
+
+// redactArguments redacts keys of block from index start, and all arguments of its subdirectives
+func redactArguments(block *caddyfile.Block, start int) {
+	if start < len(block.Keys) {
+		redactKeys(block.Keys[start:])
+	}
+	for _, child := range block.Children {
+		redactArguments(child, 1)
+	}
+}
+
+func redactKeys(keys []string) {
+	for i := range keys {
+		keys[i] = redactedValue
+	}
+}
+
+// redactConfigJSON returns a copy of a JSON config for logging, with values of sensitive keys,
+// sensitive header values and values of extraKeys redacted
+func redactConfigJSON(configJSON []byte, extraKeys []string) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(configJSON))
+	decoder.UseNumber()
+	var config interface{}
+	if err := decoder.Decode(&config); err != nil {
+		return []byte(`"JSON config redacted, failed to parse it"`)
+	}
+	keys := map[string]bool{}
+	for _, key := range extraKeys {
+		keys[strings.TrimSpace(key)] = true
+	}
+	redactedJSON, err := json.Marshal(redactJSONValue(config, keys))
+	if err != nil {
+		return []byte(`"JSON config redacted, failed to marshal it"`)
+	}
+	return redactedJSON
+}
+
+func redactJSONValue(value interface{}, extraKeys map[string]bool) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if redactedJSONKeys[key] || extraKeys[key] || redactedHeaders[strings.ToLower(key)] {
+				value[key] = redactedValue
+			} else {
+				value[key] = redactJSONValue(child, extraKeys)
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = redactJSONValue(child, extraKeys)
+		}
+	}
+	return value
+}
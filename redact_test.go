@@ -0,0 +1,55 @@
+package caddydockerproxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactCaddyfile(t *testing.T) {
+	caddyfile := "example.com {\n" +
+		"	basicauth /admin/* {\n" +
+		"		admin $2a$14$Zkx19XLiW6VYouLHR5NmfOFU0z2GTNmpkT/5qqR7hx4IjWJPDhjvG\n" +
+		"	}\n" +
+		"	header Authorization \"Bearer secret-token\"\n" +
+		"	reverse_proxy 172.17.0.2 {\n" +
+		"		header_up X-Api-Key api-key\n" +
+		"		header_up Authorization \"Basic dXNlcjpwYXNz\"\n" +
+		"	}\n" +
+		"	tls {\n" +
+		"		dns cloudflare cloudflare-token\n" +
+		"	}\n" +
+		"}\n"
+
+	content := []byte(caddyfile)
+	redacted := string(redactCaddyfile(content, []string{"header_up"}))
+
+	assert.Equal(t, "example.com {\n"+
+		"	basicauth /admin/* {\n"+
+		"		admin REDACTED\n"+
+		"	}\n"+
+		"	header Authorization REDACTED\n"+
+		"	reverse_proxy 172.17.0.2 {\n"+
+		"		header_up REDACTED REDACTED\n"+
+		"		header_up REDACTED REDACTED\n"+
+		"	}\n"+
+		"	tls {\n"+
+		"		dns cloudflare REDACTED\n"+
+		"	}\n"+
+		"}\n", redacted)
+	assert.Equal(t, caddyfile, string(content))
+}
+
+func TestRedactConfigJSON(t *testing.T) {
+	configJSON := `{"apps":{"http":{"servers":{"srv0":{"listen":[":443"],"routes":[{"handle":[` +
+		`{"handler":"authentication","providers":{"http_basic":{"accounts":[{"username":"admin","password":"hash"}]}}},` +
+		`{"handler":"headers","response":{"set":{"Authorization":["Bearer secret-token"],"X-Frame-Options":["DENY"]}}},` +
+		`{"handler":"reverse_proxy","upstreams":[{"dial":"172.17.0.2:80"}],"custom_secret":"value"}]}]}}}}}`
+
+	redacted := string(redactConfigJSON([]byte(configJSON), []string{"custom_secret"}))
+
+	assert.JSONEq(t, `{"apps":{"http":{"servers":{"srv0":{"listen":[":443"],"routes":[{"handle":[`+
+		`{"handler":"authentication","providers":{"http_basic":{"accounts":[{"username":"admin","password":"REDACTED"}]}}},`+
+		`{"handler":"headers","response":{"set":{"Authorization":"REDACTED","X-Frame-Options":["DENY"]}}},`+
+		`{"handler":"reverse_proxy","upstreams":[{"dial":"172.17.0.2:80"}],"custom_secret":"REDACTED"}]}]}}}}}`, redacted)
+}
@@ -0,0 +1,31 @@
+package caddydockerproxy
+
+import (
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+)
+
+// ServerResolver resolves the servers a controller pushes configurations to, from the
+// generated Caddyfile and the servers found by the generator through the controlled servers label
+type ServerResolver interface {
+	ResolveServers(caddyfile []byte, controlledServers []string, dockerClients []docker.Client) ([]string, error)
+}
+
+type controlledServersResolver struct{}
+
+// CreateControlledServersResolver creates the default ServerResolver,
+// returning the servers found by the generator
+func CreateControlledServersResolver() ServerResolver {
+	return &controlledServersResolver{}
+}
+
+func (resolver *controlledServersResolver) ResolveServers(caddyfile []byte, controlledServers []string, dockerClients []docker.Client) ([]string, error) {
+	return controlledServers, nil
+}
+
+var registeredServerResolver = CreateControlledServersResolver()
+
+// RegisterServerResolver replaces the ServerResolver used by docker loaders created afterwards.
+// Call it from the init function of a custom Caddy build to discover servers in other ways
+func RegisterServerResolver(resolver ServerResolver) {
+	registeredServerResolver = resolver
+}
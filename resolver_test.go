@@ -0,0 +1,87 @@
+package caddydockerproxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/docker"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type serverResolverMock struct {
+	servers           []string
+	err               error
+	caddyfile         []byte
+	controlledServers []string
+	dockerClients     []docker.Client
+}
+
+func (resolver *serverResolverMock) ResolveServers(caddyfile []byte, controlledServers []string, dockerClients []docker.Client) ([]string, error) {
+	resolver.caddyfile = caddyfile
+	resolver.controlledServers = controlledServers
+	resolver.dockerClients = dockerClients
+	return resolver.servers, resolver.err
+}
+
+func TestResolveServers_Default(t *testing.T) {
+	loader := CreateDockerLoader(createTestLoader(t, createDockerClientMock(), nil).options)
+
+	servers := loader.resolveServers(zap.NewNop(), nil, []string{"10.0.0.1", "localhost"})
+
+	assert.Equal(t, []string{"10.0.0.1", "localhost"}, servers)
+}
+
+func TestResolveServers_CustomResolver(t *testing.T) {
+	resolver := &serverResolverMock{servers: []string{"srv1.example.com", "srv2.example.com"}}
+	loader := createTestLoader(t, createDockerClientMock(), nil)
+	loader.serverResolver = resolver
+
+	servers := loader.resolveServers(zap.NewNop(), []byte(testCaddyfile), []string{"10.0.0.1"})
+
+	assert.Equal(t, []string{"srv1.example.com", "srv2.example.com"}, servers)
+	assert.Equal(t, testCaddyfile, string(resolver.caddyfile))
+	assert.Equal(t, []string{"10.0.0.1"}, resolver.controlledServers)
+	assert.Equal(t, loader.dockerClients, resolver.dockerClients)
+}
+
+func TestResolveServers_ResolverFails(t *testing.T) {
+	loader := createTestLoader(t, createDockerClientMock(), nil)
+	loader.serverResolver = &serverResolverMock{err: errors.New("SRV lookup failed")}
+
+	logs := captureLogs(func(log *zap.Logger) {
+		servers := loader.resolveServers(log, nil, []string{"10.0.0.1"})
+		assert.Equal(t, []string{"10.0.0.1"}, servers)
+	})
+
+	assert.Contains(t, logs, `ERROR	Failed to resolve servers, using controlled servers	{"error": "SRV lookup failed"}`)
+}
+
+func TestUpdate_UsesServerResolver(t *testing.T) {
+	dockerClient := createDockerClientMock()
+	dockerClient.ContainersData = []types.Container{
+		createContainer("172.17.0.2", map[string]string{
+			"caddy":               "example.com",
+			"caddy.reverse_proxy": "{{upstreams}}",
+		}),
+	}
+	resolver := &serverResolverMock{servers: []string{}}
+	loader := createTestLoader(t, dockerClient, nil)
+	loader.serverResolver = resolver
+
+	loader.update()
+
+	assert.Equal(t, testCaddyfile, string(resolver.caddyfile))
+	assert.Empty(t, resolver.controlledServers)
+}
+
+func TestRegisterServerResolver(t *testing.T) {
+	resolver := &serverResolverMock{}
+	RegisterServerResolver(resolver)
+	t.Cleanup(func() { RegisterServerResolver(CreateControlledServersResolver()) })
+
+	loader := CreateDockerLoader(createTestLoader(t, createDockerClientMock(), nil).options)
+
+	assert.Same(t, resolver, loader.serverResolver)
+}
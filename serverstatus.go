@@ -0,0 +1,27 @@
+package caddydockerproxy
+
+import "time"
+
+// ServerStatus is the result of the configurations sent to a server, kept for the admin API.
+// Errors are kept after later successful pushes, their time tells whether they are still current
+type ServerStatus struct {
+	Version     int64      `json:"version"`
+	LastPush    *time.Time `json:"last_push,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// recordServerStatus updates the status of server with the result of sending it version,
+// in a single map update, so readers see either the previous or the new status
+func (dockerLoader *DockerLoader) recordServerStatus(server string, version int64, err error, now time.Time) {
+	dockerLoader.serversStatuses.Update(server, func(status ServerStatus) ServerStatus {
+		if err != nil {
+			status.LastError = err.Error()
+			status.LastErrorAt = &now
+		} else {
+			status.Version = version
+			status.LastPush = &now
+		}
+		return status
+	})
+}
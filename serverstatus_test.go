@@ -0,0 +1,40 @@
+package caddydockerproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateServer_RecordsStatus(t *testing.T) {
+	var healthy atomic.Bool
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+
+	loader.updateServerAt("server", admin.URL)
+	status := loader.serversStatuses.Get("server")
+	assert.Equal(t, int64(0), status.Version)
+	assert.Nil(t, status.LastPush)
+	assert.Contains(t, status.LastError, "400")
+	assert.NotNil(t, status.LastErrorAt)
+
+	healthy.Store(true)
+	loader.updateServerAt("server", admin.URL)
+	status = loader.serversStatuses.Get("server")
+	assert.Equal(t, int64(1), status.Version)
+	assert.NotNil(t, status.LastPush)
+	assert.False(t, status.LastPush.Before(*status.LastErrorAt))
+	assert.Contains(t, status.LastError, "400")
+}
@@ -0,0 +1,76 @@
+package caddydockerproxy
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"go.uber.org/zap"
+)
+
+// srvLookupTimeout limits how long an update waits for the SRV record of servers
+const srvLookupTimeout = 5 * time.Second
+
+// srvLookup resolves SRV records, replaced in tests
+type srvLookup func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+// addSRVServers combines servers with the targets of the SRV record ServersSRV, merging them or
+// replacing servers depending on ServersSRVMode. When the record can't be resolved, the targets
+// of the last successful lookup are used, so a DNS outage doesn't stop configuring servers
+func (dockerLoader *DockerLoader) addSRVServers(log *zap.Logger, servers []string) []string {
+	name := dockerLoader.options.ServersSRV
+	if name == "" {
+		return servers
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), srvLookupTimeout)
+	defer cancel()
+	targets, err := lookupSRVServers(ctx, dockerLoader.lookupSRV, name)
+	if err != nil {
+		log.Error("Failed to resolve servers SRV record, using last targets", zap.String("name", name), zap.Strings("targets", dockerLoader.lastSRVServers), zap.Error(err))
+		targets = dockerLoader.lastSRVServers
+	} else {
+		dockerLoader.lastSRVServers = targets
+	}
+
+	if dockerLoader.options.ServersSRVMode == config.ServersSRVReplace {
+		return targets
+	}
+	merged := append([]string{}, servers...)
+	for _, target := range targets {
+		if !hasServer(merged, target) {
+			merged = append(merged, target)
+		}
+	}
+	return merged
+}
+
+// lookupSRVServers returns the targets of the SRV record name as host:port addresses, sorted
+func lookupSRVServers(ctx context.Context, lookup srvLookup, name string) ([]string, error) {
+	_, records, err := lookup(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+	targets := []string{}
+	for _, record := range records {
+		target := net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port)))
+		if !hasServer(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+func hasServer(servers []string, server string) bool {
+	for _, existing := range servers {
+		if existing == server {
+			return true
+		}
+	}
+	return false
+}
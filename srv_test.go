@@ -0,0 +1,92 @@
+package caddydockerproxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type srvLookupMock struct {
+	records []*net.SRV
+	err     error
+	names   []string
+}
+
+func (mock *srvLookupMock) lookup(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	mock.names = append(mock.names, name)
+	return name, mock.records, mock.err
+}
+
+func TestResolveServers_SRV(t *testing.T) {
+	lookup := &srvLookupMock{records: []*net.SRV{
+		{Target: "caddy-2.example.com.", Port: 2019},
+		{Target: "caddy-1.example.com.", Port: 2020},
+		{Target: "caddy-2.example.com.", Port: 2019},
+	}}
+	loader := CreateDockerLoader(&config.Options{ServersSRV: "_caddy-admin._tcp.example.com"})
+	loader.lookupSRV = lookup.lookup
+
+	servers := loader.resolveServers(zap.NewNop(), nil, []string{"10.0.0.2", "caddy-1.example.com:2020"})
+	assert.Equal(t, []string{"10.0.0.2", "caddy-1.example.com:2020", "caddy-2.example.com:2019"}, servers)
+	assert.Equal(t, []string{"_caddy-admin._tcp.example.com"}, lookup.names)
+
+	loader.options.ServersSRVMode = config.ServersSRVReplace
+	servers = loader.resolveServers(zap.NewNop(), nil, []string{"10.0.0.2"})
+	assert.Equal(t, []string{"caddy-1.example.com:2020", "caddy-2.example.com:2019"}, servers)
+
+	// Last targets are kept when the record can't be resolved
+	lookup.err = errors.New("no such host")
+	logs := captureLogs(func(log *zap.Logger) {
+		servers = loader.resolveServers(log, nil, []string{"10.0.0.2"})
+	})
+	assert.Equal(t, []string{"caddy-1.example.com:2020", "caddy-2.example.com:2019"}, servers)
+	assert.Contains(t, logs, "Failed to resolve servers SRV record, using last targets")
+}
+
+func TestResolveServers_NoSRV(t *testing.T) {
+	lookup := &srvLookupMock{}
+	loader := CreateDockerLoader(&config.Options{})
+	loader.lookupSRV = lookup.lookup
+
+	servers := loader.resolveServers(zap.NewNop(), nil, []string{"10.0.0.2"})
+	assert.Equal(t, []string{"10.0.0.2"}, servers)
+	assert.Empty(t, lookup.names)
+}
+
+func TestUpdateServer_HostPort(t *testing.T) {
+	var paths []string
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer admin.Close()
+
+	adminURL, _ := url.Parse(admin.URL)
+	loader := CreateDockerLoader(&config.Options{})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	loader.updateServer(&wg, adminURL.Host)
+
+	assert.Equal(t, []string{"/load"}, paths)
+	assert.Equal(t, int64(1), loader.serversVersions.Get(adminURL.Host))
+
+	adminConfig, err := createAdminConfig(loader.options, adminURL.Host)
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp/"+adminURL.Host, adminConfig.Listen)
+
+	// Bare IPv6 addresses use the admin port
+	host, port := splitAdminAddress(loader.options, "fd00::1")
+	assert.Equal(t, "fd00::1", host)
+	assert.Equal(t, "2019", port)
+}
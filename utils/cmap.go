@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"sync"
+)
+
+// CMap is a concurrent map implementation of map[string]V
+type CMap[V any] struct {
+	mutex    sync.RWMutex
+	internal map[string]V
+}
+
+// StringInt64CMap is a concurrent map implementation of map[string]int64
+type StringInt64CMap = CMap[int64]
+
+// StringBoolCMap is a concurrent map implementation of map[string]bool
+type StringBoolCMap = CMap[bool]
+
+// StringBytesCMap is a concurrent map implementation of map[string][]byte
+type StringBytesCMap = CMap[[]byte]
+
+// NewCMap creates an empty concurrent map
+func NewCMap[V any]() *CMap[V] {
+	return &CMap[V]{
+		mutex:    sync.RWMutex{},
+		internal: map[string]V{},
+	}
+}
+
+func NewStringInt64CMap() *StringInt64CMap {
+	return NewCMap[int64]()
+}
+
+func NewStringBoolCMap() *StringBoolCMap {
+	return NewCMap[bool]()
+}
+
+func NewStringBytesCMap() *StringBytesCMap {
+	return NewCMap[[]byte]()
+}
+
+// Set map value
+func (m *CMap[V]) Set(key string, value V) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.internal[key] = value
+}
+
+// Get map value or default
+func (m *CMap[V]) Get(key string) V {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.internal[key]
+}
+
+// Update replaces a map value with the result of update, called with the current value or default
+// while holding the lock, so readers never see a partial update and concurrent updates aren't lost
+func (m *CMap[V]) Update(key string, update func(V) V) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.internal[key] = update(m.internal[key])
+}
+
+// Delete map value
+func (m *CMap[V]) Delete(key string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.internal, key)
+}
+
+// Clear map values
+func (m *CMap[V]) Clear() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	clear(m.internal)
+}
+
+// Len returns the number of map values
+func (m *CMap[V]) Len() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.internal)
+}
+
+// Snapshot returns a copy of map values. Values referencing memory, like slices,
+// still share it with the map
+func (m *CMap[V]) Snapshot() map[string]V {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	snapshot := make(map[string]V, len(m.internal))
+	for key, value := range m.internal {
+		snapshot[key] = value
+	}
+	return snapshot
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringInt64CMap_Snapshot(t *testing.T) {
+	m := NewStringInt64CMap()
+	m.Set("server1", 1)
+	m.Set("server2", 2)
+
+	snapshot := m.Snapshot()
+	snapshot["server1"] = 10
+	delete(snapshot, "server2")
+
+	assert.Equal(t, 2, m.Len())
+	assert.Equal(t, map[string]int64{"server1": 1, "server2": 2}, m.Snapshot())
+}
+
+func TestStringBoolCMap_Snapshot(t *testing.T) {
+	m := NewStringBoolCMap()
+	m.Set("server1", true)
+	m.Set("server2", false)
+	m.Delete("server2")
+
+	snapshot := m.Snapshot()
+	snapshot["server3"] = true
+
+	assert.Equal(t, 1, m.Len())
+	assert.Equal(t, map[string]bool{"server1": true}, m.Snapshot())
+}
+
+func TestCMap_Clear(t *testing.T) {
+	m := NewCMap[string]()
+	m.Set("server1", "a")
+	m.Set("server2", "b")
+
+	m.Clear()
+
+	assert.Equal(t, 0, m.Len())
+	assert.Equal(t, "", m.Get("server1"))
+}
+
+func TestCMap_Update(t *testing.T) {
+	m := NewStringInt64CMap()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Update("server1", func(value int64) int64 { return value + 1 })
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(100), m.Get("server1"))
+}
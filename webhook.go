@@ -0,0 +1,100 @@
+package caddydockerproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var errHealthProbeFailed = errors.New("health probe failed after configuring")
+
+// webhookClient sends push notifications, separate from the admin client that may use client certificates
+var webhookClient = &http.Client{}
+
+// pushError is the error response of a server to a configuration
+type pushError struct {
+	statusCode int
+	body       []byte
+}
+
+func (err *pushError) Error() string {
+	return fmt.Sprintf("status code %d: %s", err.statusCode, err.body)
+}
+
+// PushNotification is the JSON body POSTed to the push webhook
+type PushNotification struct {
+	Server     string `json:"server"`
+	Status     string `json:"status"`
+	Version    int64  `json:"version"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// notifyPush POSTs the result of sending a configuration to a server to the push webhook, when
+// configured. Failures are always notified and successes only with PushWebhookOnSuccess.
+// The request runs in the background, so a slow webhook doesn't hold updates
+func (dockerLoader *DockerLoader) notifyPush(server string, version int64, err error) {
+	url := dockerLoader.options.PushWebhookURL
+	if url == "" || (err == nil && !dockerLoader.options.PushWebhookOnSuccess) {
+		return
+	}
+
+	notification := PushNotification{
+		Server:  server,
+		Status:  "succeeded",
+		Version: version,
+	}
+	if err != nil {
+		notification.Status = "failed"
+		notification.Error = err.Error()
+		var responseErr *pushError
+		if errors.As(err, &responseErr) {
+			notification.StatusCode = responseErr.statusCode
+		}
+	}
+
+	go sendPushNotification(url, dockerLoader.options.PushWebhookTimeout, notification)
+}
+
+func sendPushNotification(url string, timeout time.Duration, notification PushNotification) {
+	log := logger()
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		log.Warn("Failed to marshal push notification", zap.Error(err))
+		return
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		log.Warn("Failed to create push notification request", zap.Error(err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		log.Warn("Failed to send push notification", zap.String("server", notification.Server), zap.Error(err))
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Warn("Error response to push notification", zap.String("server", notification.Server), zap.Int("status code", resp.StatusCode))
+	}
+}
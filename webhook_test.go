@@ -0,0 +1,109 @@
+package caddydockerproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lucaslorentz/caddy-docker-proxy/v2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func createWebhookMock() (*httptest.Server, chan PushNotification) {
+	notifications := make(chan PushNotification, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification PushNotification
+		json.NewDecoder(r.Body).Decode(&notification)
+		notifications <- notification
+	}))
+	return webhook, notifications
+}
+
+func receiveNotification(t *testing.T, notifications chan PushNotification) PushNotification {
+	select {
+	case notification := <-notifications:
+		return notification
+	case <-time.After(5 * time.Second):
+		t.Fatal("push notification not received")
+		return PushNotification{}
+	}
+}
+
+func TestNotifyPush_Failure(t *testing.T) {
+	webhook, notifications := createWebhookMock()
+	defer webhook.Close()
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid config"))
+	}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{PushWebhookURL: webhook.URL})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 3
+
+	loader.updateServerAt("server", admin.URL)
+
+	assert.Equal(t, PushNotification{
+		Server:     "server",
+		Status:     "failed",
+		Version:    3,
+		StatusCode: 400,
+		Error:      "status code 400: invalid config",
+	}, receiveNotification(t, notifications))
+}
+
+func TestNotifyPush_Success(t *testing.T) {
+	webhook, notifications := createWebhookMock()
+	defer webhook.Close()
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer admin.Close()
+
+	loader := CreateDockerLoader(&config.Options{PushWebhookURL: webhook.URL})
+	loader.lastJSONConfig = []byte(testConfigJSON)
+	loader.lastVersion = 1
+
+	// Successes aren't notified by default
+	loader.updateServerAt("server", admin.URL)
+	assert.Equal(t, int64(1), loader.serversVersions.Get("server"))
+
+	loader.options.PushWebhookOnSuccess = true
+	loader.lastJSONConfig = []byte(`{"apps":{}}`)
+	loader.lastVersion = 2
+	loader.updateServerAt("server", admin.URL)
+
+	assert.Equal(t, PushNotification{
+		Server:  "server",
+		Status:  "succeeded",
+		Version: 2,
+	}, receiveNotification(t, notifications))
+	assert.Empty(t, notifications)
+}
+
+func TestNotifyPush_SlowWebhookDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer webhook.Close()
+	defer close(release)
+
+	loader := CreateDockerLoader(&config.Options{
+		PushWebhookURL:     webhook.URL,
+		PushWebhookTimeout: time.Hour,
+	})
+
+	done := make(chan struct{})
+	go func() {
+		loader.notifyPush("server", 1, errHealthProbeFailed)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("notifyPush blocked on the webhook")
+	}
+}